@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Address Standardization ---
+// ---------------------------------------------------------------------
+
+// Columns listed in NormalizeOptions.AddressColumns are keyed by their standardized address,
+// so any algorithm compares addresses rather than their spelling: punctuation is dropped,
+// street types, directions and unit designators are spelled out ("St" -> "street", "N" ->
+// "north"), and the unit moves to the end, so "Apt 5, 12 N Main St." and "12 North Main
+// Street #5" both key as "12 north main street unit 5". An abbreviation with two readings
+// always takes the same one ("St" is "street" even in "St Johns Rd"), which is harmless as
+// both sides of a match are read alike. Address keys are always lower case.
+
+// addressAbbreviations spells out the abbreviations of street types and directions.
+var addressAbbreviations = map[string]string{
+	"st": "street", "str": "street", "rd": "road", "ave": "avenue", "av": "avenue",
+	"blvd": "boulevard", "dr": "drive", "ln": "lane", "ct": "court", "pl": "place",
+	"sq": "square", "hwy": "highway", "pkwy": "parkway", "fwy": "freeway", "cres": "crescent",
+	"ter": "terrace", "terr": "terrace", "cir": "circle", "pde": "parade", "cl": "close",
+	"grv": "grove", "gdns": "gardens", "mt": "mount", "ctr": "centre", "trl": "trail",
+	"aly": "alley", "expy": "expressway", "bldg": "building",
+	"n": "north", "s": "south", "e": "east", "w": "west",
+	"ne": "northeast", "nw": "northwest", "se": "southeast", "sw": "southwest",
+}
+
+// addressUnitWords introduce a unit number; each is keyed as "unit".
+var addressUnitWords = map[string]bool{
+	"apt": true, "apartment": true, "unit": true, "suite": true, "ste": true,
+	"flat": true, "rm": true, "room": true,
+}
+
+// canonicalAddress returns the standardized form of an address.
+func canonicalAddress(v string) string {
+	fields := strings.FieldsFunc(strings.ToLower(v), func(r rune) bool {
+		return notAlphanumeric(r) && r != '#' && r != '/'
+	})
+	var words, units []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case strings.HasPrefix(f, "#"): // "#5", or "#" then "5"
+			id := strings.TrimLeft(f, "#")
+			if id == "" && i+1 < len(fields) {
+				i++
+				id = strings.TrimLeft(fields[i], "#")
+			}
+			if id != "" {
+				units = append(units, id)
+			}
+		case addressUnitWords[f] && i+1 < len(fields):
+			i++
+			units = append(units, strings.TrimLeft(fields[i], "#"))
+		case strings.Contains(f, "/"):
+			// "5/12 Main St" is unit 5 of number 12; any other slash separates words.
+			unit, number, _ := strings.Cut(f, "/")
+			if len(words) == 0 && startsWithDigit(unit) && startsWithDigit(number) && !strings.Contains(number, "/") {
+				units = append(units, unit)
+				words = append(words, number)
+				continue
+			}
+			for _, part := range strings.Split(f, "/") {
+				if part != "" {
+					words = append(words, addressWord(part))
+				}
+			}
+		default:
+			words = append(words, addressWord(f))
+		}
+	}
+	for _, unit := range units {
+		if unit != "" {
+			words = append(words, "unit", unit)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// addressWord spells out an abbreviated word of an address.
+func addressWord(w string) string {
+	if full, ok := addressAbbreviations[w]; ok {
+		return full
+	}
+	return w
+}
+
+// startsWithDigit reports whether s begins with an ASCII digit.
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
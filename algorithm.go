@@ -0,0 +1,430 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------------------------------------------------------------------
+// --- Match Algorithms ---
+// ---------------------------------------------------------------------
+
+// Values for MatchRequest.Algorithm. An empty algorithm keeps the legacy behavior:
+// levenshtein when UseFuzzy is set, exact otherwise.
+const (
+	algorithmExact       = "exact"
+	algorithmLevenshtein = "levenshtein"
+	algorithmToken       = "token"
+	algorithmJaroWinkler = "jaro-winkler"
+	algorithmPhonetic    = "phonetic"
+	algorithmNGram       = "ngram"
+	algorithmTokenSort   = "token-sort"
+	algorithmTokenSet    = "token-set"
+	algorithmTFIDF       = "tfidf"
+	algorithmDamerau     = "damerau"
+	algorithmNumeric     = "numeric"
+	algorithmDate        = "date"
+	algorithmPhone       = "phone"
+	algorithmEmail       = "email"
+)
+
+// scoreParams carries the request settings the algorithms use when scoring a pair.
+type scoreParams struct {
+	threshold     int     // MatchRequest.FuzzyThreshold
+	minTokenLen   int     // MatchRequest.MinTokenLen
+	ngramSize     int     // MatchRequest.NGramSize, defaulted
+	ngramJaccard  bool    // MatchRequest.NGramMeasure is jaccard rather than dice
+	minSimilarity float64 // MatchRequest.MinSimilarity
+	toleranceAbs  float64 // MatchRequest.Tolerance as an amount
+	toleranceRel  float64 // MatchRequest.Tolerance as a fraction of the larger value
+	dateWindow    int     // MatchRequest.DateWindow
+	monthFirst    bool    // MatchRequest.DateOrder is mdy
+	phoneRegion   string  // MatchRequest.PhoneRegion, defaulted
+
+	emailIgnoreTags bool // MatchRequest.EmailIgnoreTags
+	emailIgnoreDots bool // MatchRequest.EmailIgnoreDots
+}
+
+// newScoreParams collects the scoring settings of a request.
+func newScoreParams(req MatchRequest) scoreParams {
+	p := scoreParams{
+		threshold:     req.FuzzyThreshold,
+		minTokenLen:   req.MinTokenLen,
+		ngramSize:     req.NGramSize,
+		ngramJaccard:  req.NGramMeasure == ngramJaccard,
+		minSimilarity: req.MinSimilarity,
+		dateWindow:    req.DateWindow,
+		monthFirst:    req.DateOrder == dateOrderMDY,
+		phoneRegion:   strings.ToUpper(req.PhoneRegion),
+
+		emailIgnoreTags: req.EmailIgnoreTags,
+		emailIgnoreDots: req.EmailIgnoreDots,
+	}
+	if p.ngramSize == 0 {
+		p.ngramSize = ngramDefaultSize
+	}
+	if p.phoneRegion == "" {
+		p.phoneRegion = defaultPhoneRegion
+	}
+	p.toleranceAbs, p.toleranceRel, _ = parseTolerance(req.Tolerance) // validated by validateAlgorithmOptions
+	return p
+}
+
+// fuzzyAlgorithm scores candidate pairs that did not match exactly. score reports whether two
+// normalized keys match under the threshold, with the edit distance (for the "distance"
+// similarity format) and a 0-1 similarity ratio. Every algorithm applies the threshold the
+// same way, a pair matching when (1-ratio)*100 <= threshold, except that ngram uses
+// MatchRequest.MinSimilarity instead when it is set, numeric uses MatchRequest.Tolerance,
+// date uses MatchRequest.DateWindow, and phone and email match equal numbers and addresses only.
+type fuzzyAlgorithm struct {
+	score scoreFunc
+
+	// column, when set, is called once per sheet2 column before it is scored and returns the
+	// score function for that column, for algorithms that weigh a pair against the column's
+	// contents as a whole.
+	column func(ix *matchIndex, c int, p scoreParams) scoreFunc
+
+	// lengthBlocked means a pair can only match when the key lengths are close enough, so
+	// candidates may come from matchIndex.fuzzyCandidates instead of a full scan.
+	lengthBlocked bool
+}
+
+// scoreFunc scores a pair of normalized keys; see fuzzyAlgorithm.
+type scoreFunc func(key1, key2 string, p scoreParams) (dist int, ratio float64, ok bool)
+
+// columnScorer returns the score function for sheet2 column c of the index.
+func (alg *fuzzyAlgorithm) columnScorer(ix *matchIndex, c int, p scoreParams) scoreFunc {
+	if alg.column == nil {
+		return alg.score
+	}
+	return alg.column(ix, c, p)
+}
+
+// canonicalColumn returns a score function for sheet2 column c that matches keys whose
+// canonical forms under canon are equal, "" standing for a key that has none. The column's
+// forms are computed once up front and the sheet1 key's is kept until the key changes.
+func canonicalColumn(ix *matchIndex, c int, canon func(string) string) scoreFunc {
+	forms := make(map[string]string)
+	for _, keys := range ix.keys {
+		if c < len(keys) && keys[c] != "" {
+			if _, seen := forms[keys[c]]; !seen {
+				forms[keys[c]] = canon(keys[c])
+			}
+		}
+	}
+
+	var last1, form1 string
+	return func(key1, key2 string, p scoreParams) (int, float64, bool) {
+		if key1 != last1 {
+			last1, form1 = key1, canon(key1)
+		}
+		if form1 == "" || forms[key2] != form1 {
+			return 0, 0, false
+		}
+		return 0, 1, true
+	}
+}
+
+// fuzzyAlgorithms holds every algorithm with a fuzzy pass; "exact" has none.
+var fuzzyAlgorithms = map[string]*fuzzyAlgorithm{
+	algorithmLevenshtein: {score: levenshteinScore, lengthBlocked: true},
+	algorithmToken:       {score: tokenScore},
+	algorithmJaroWinkler: {score: jaroWinklerScore},
+	algorithmPhonetic:    {score: phoneticScore},
+	algorithmNGram:       {score: ngramScore},
+	algorithmTokenSort:   {score: tokenSortScore},
+	algorithmTokenSet:    {score: tokenSetScore},
+	algorithmTFIDF:       {column: tfidfColumn},
+	algorithmDamerau:     {score: damerauScore, lengthBlocked: true},
+	algorithmNumeric:     {score: numericScore},
+	algorithmDate:        {column: dateColumn},
+	algorithmPhone:       {column: phoneColumn},
+	algorithmEmail:       {column: emailColumn},
+}
+
+// resolveAlgorithm returns the canonical algorithm name for a request, rejecting unknown values.
+func resolveAlgorithm(req MatchRequest) (string, error) {
+	switch req.Algorithm {
+	case "":
+		if req.UseFuzzy {
+			return algorithmLevenshtein, nil
+		}
+		return algorithmExact, nil
+	case algorithmExact:
+		return algorithmExact, nil
+	}
+	if _, ok := fuzzyAlgorithms[req.Algorithm]; ok {
+		return req.Algorithm, nil
+	}
+	names := []string{algorithmExact}
+	for name := range fuzzyAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown algorithm '%s' (expected one of %s)", req.Algorithm, strings.Join(names, ", "))
+}
+
+// validateAlgorithmOptions rejects algorithm settings out of range.
+func validateAlgorithmOptions(req MatchRequest) error {
+	if err := validateNGramOptions(req); err != nil {
+		return err
+	}
+	if _, _, err := parseTolerance(req.Tolerance); err != nil {
+		return err
+	}
+	if err := validateDateOptions(req); err != nil {
+		return err
+	}
+	return validatePhoneOptions(req)
+}
+
+func levenshteinScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	dist, ok := fuzzyKeyDistance(key1, key2, p.threshold)
+	if !ok {
+		return 0, 0, false
+	}
+	return dist, editRatio(dist, key1, key2), true
+}
+
+// damerauScore is levenshteinScore with adjacent transpositions costing one edit, so
+// "recieve" is one edit from "receive" rather than two.
+func damerauScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	if key1 == key2 {
+		return 0, 1, true
+	}
+	if key1 == "" || key2 == "" || p.threshold < 0 {
+		return 0, 0, false
+	}
+	maxDist := max(len(key1), len(key2)) * p.threshold / 100
+	if gap := len(key1) - len(key2); gap > maxDist || -gap > maxDist {
+		return 0, 0, false
+	}
+	dist := damerauDistance(key1, key2)
+	if dist > maxDist {
+		return 0, 0, false
+	}
+	return dist, editRatio(dist, key1, key2), true
+}
+
+// damerauDistance returns the optimal string alignment distance between two strings: the
+// Levenshtein distance with the swap of two adjacent bytes counted as one edit, provided no
+// substring is edited twice.
+func damerauDistance(s1, s2 string) int {
+	if len(s1) == 0 {
+		return len(s2)
+	}
+	if len(s2) == 0 {
+		return len(s1)
+	}
+	// Three DP rows: the previous two, for transpositions, and the current one.
+	v0 := make([]int, len(s2)+1)
+	v1 := make([]int, len(s2)+1)
+	v2 := make([]int, len(s2)+1)
+	for j := range v1 {
+		v1[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		v2[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := 1
+			if s1[i-1] == s2[j-1] {
+				cost = 0
+			}
+			v2[j] = min(v2[j-1]+1, v1[j]+1, v1[j-1]+cost)
+			if i > 1 && j > 1 && s1[i-1] == s2[j-2] && s1[i-2] == s2[j-1] && v0[j-2]+1 < v2[j] {
+				v2[j] = v0[j-2] + 1
+			}
+		}
+		v0, v1, v2 = v1, v2, v0
+	}
+	return v1[len(s2)]
+}
+
+// tokenScore compares keys as sets of alphanumeric tokens using Jaccard similarity, so word
+// order and punctuation do not matter ("Acme, Inc." vs "inc acme" is identical). Tokens shorter
+// than MinTokenLen runes are ignored.
+func tokenScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	tokens1, tokens2 := tokenSet(key1, p.minTokenLen), tokenSet(key2, p.minTokenLen)
+	if len(tokens1) == 0 || len(tokens2) == 0 {
+		return 0, 0, false
+	}
+	shared := 0
+	for t := range tokens1 {
+		if _, ok := tokens2[t]; ok {
+			shared++
+		}
+	}
+	ratio := float64(shared) / float64(len(tokens1)+len(tokens2)-shared)
+	if (1-ratio)*100 > float64(p.threshold) {
+		return 0, 0, false
+	}
+	return levenshteinDistance(key1, key2), ratio, true
+}
+
+// tokenSet splits a key on anything that is not a letter or digit, dropping tokens shorter than minLen runes.
+func tokenSet(key string, minLen int) map[string]struct{} {
+	fields := strings.FieldsFunc(key, notAlphanumeric)
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if utf8.RuneCountInString(f) >= minLen {
+			set[f] = struct{}{}
+		}
+	}
+	return set
+}
+
+// tokenSortScore compares keys by edit distance once their tokens are sorted, so "smith, john"
+// and "john smith" are identical, while a misspelt token still costs only its edits.
+func tokenSortScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	sorted1 := strings.Join(sortedTokens(tokenSet(key1, p.minTokenLen)), " ")
+	sorted2 := strings.Join(sortedTokens(tokenSet(key2, p.minTokenLen)), " ")
+	if sorted1 == "" || sorted2 == "" {
+		return 0, 0, false
+	}
+	dist := levenshteinDistance(sorted1, sorted2)
+	return thresholdRatio(dist, editRatio(dist, sorted1, sorted2), p)
+}
+
+// tokenSetScore compares keys as fuzzywuzzy's token set ratio does: the sorted tokens the keys
+// share, alone and followed by each key's remaining tokens, are compared three ways and the
+// best ratio counts. A key whose tokens all appear in the other therefore scores 1, so
+// "john smith" matches "mr john smith jr".
+func tokenSetScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	tokens1, tokens2 := tokenSet(key1, p.minTokenLen), tokenSet(key2, p.minTokenLen)
+	if len(tokens1) == 0 || len(tokens2) == 0 {
+		return 0, 0, false
+	}
+	var shared, only1, only2 []string
+	for t := range tokens1 {
+		if _, ok := tokens2[t]; ok {
+			shared = append(shared, t)
+		} else {
+			only1 = append(only1, t)
+		}
+	}
+	for t := range tokens2 {
+		if _, ok := tokens1[t]; !ok {
+			only2 = append(only2, t)
+		}
+	}
+	sort.Strings(shared)
+	sort.Strings(only1)
+	sort.Strings(only2)
+	base := strings.Join(shared, " ")
+	with1 := strings.TrimSpace(base + " " + strings.Join(only1, " "))
+	with2 := strings.TrimSpace(base + " " + strings.Join(only2, " "))
+
+	bestDist, bestRatio := 0, -1.0
+	for _, pair := range [][2]string{{base, with1}, {base, with2}, {with1, with2}} {
+		if pair[0] == "" {
+			continue // no shared tokens
+		}
+		dist := levenshteinDistance(pair[0], pair[1])
+		if ratio := editRatio(dist, pair[0], pair[1]); ratio > bestRatio {
+			bestDist, bestRatio = dist, ratio
+		}
+	}
+	return thresholdRatio(bestDist, bestRatio, p)
+}
+
+// sortedTokens returns the tokens of a set in order.
+func sortedTokens(set map[string]struct{}) []string {
+	tokens := make([]string, 0, len(set))
+	for t := range set {
+		tokens = append(tokens, t)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// thresholdRatio applies the threshold rule to a scored pair.
+func thresholdRatio(dist int, ratio float64, p scoreParams) (int, float64, bool) {
+	if (1-ratio)*100 > float64(p.threshold) {
+		return 0, 0, false
+	}
+	return dist, ratio, true
+}
+
+// Jaro-Winkler settings: the weight given to each rune of common prefix, the longest prefix
+// counted, and the Jaro similarity a pair needs before the prefix counts at all.
+const (
+	jaroWinklerScale     = 0.1
+	jaroWinklerMaxPrefix = 4
+	jaroWinklerBoostFrom = 0.7
+)
+
+// jaroWinklerScore compares keys by Jaro-Winkler similarity, which counts the runes two keys
+// share in nearly the same positions and favours a common prefix, so "Johnson & Sons Ltd" and
+// "Johnson and Sons" score well where the edit distance of the tails would sink them. Its 0-1
+// similarity is the ratio, matched against the threshold as for every algorithm: threshold 10
+// accepts a similarity of 0.90 or more.
+func jaroWinklerScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	ratio := jaroWinkler([]rune(key1), []rune(key2))
+	if (1-ratio)*100 > float64(p.threshold) {
+		return 0, 0, false
+	}
+	return levenshteinDistance(key1, key2), ratio, true
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two rune strings, 1 for identical ones.
+func jaroWinkler(s1, s2 []rune) float64 {
+	if len(s1) == 0 && len(s2) == 0 {
+		return 1
+	}
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+	window := max(len(s1), len(s2))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matched1 := make([]bool, len(s1))
+	matched2 := make([]bool, len(s2))
+	matches := 0
+	for i, r := range s1 {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(s2) {
+			hi = len(s2)
+		}
+		for j := lo; j < hi; j++ {
+			if !matched2[j] && s2[j] == r {
+				matched1[i], matched2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	// Transpositions are matched runes out of order, counted in pairs.
+	transposed, j := 0, 0
+	for i, r := range s1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[j] {
+			j++
+		}
+		if s2[j] != r {
+			transposed++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transposed)/2)/m) / 3
+	if jaro <= jaroWinklerBoostFrom {
+		return jaro
+	}
+	prefix := 0
+	for prefix < jaroWinklerMaxPrefix && prefix < len(s1) && prefix < len(s2) && s1[prefix] == s2[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*jaroWinklerScale*(1-jaro)
+}
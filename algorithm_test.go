@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// matchesPair reports whether a request matches a single value a against a single value b.
+func matchesPair(t *testing.T, req MatchRequest, a, b string) bool {
+	t.Helper()
+	req.Sheet1, req.Sheet2 = "A", "B"
+	sheet1 := SheetData{Headers: []string{"Value"}, Rows: [][]string{{a}}}
+	sheet2 := SheetData{Headers: []string{"Value"}, Rows: [][]string{{b}}}
+	groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(groups) > 0
+}
+
+func TestMatchStrategies(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       MatchRequest
+		a, b      string
+		wantMatch bool
+	}{
+		{"exact folds case", MatchRequest{Algorithm: algorithmExact}, "Acme Inc.", "acme inc.", true},
+		{"exact needs the same characters", MatchRequest{Algorithm: algorithmExact}, "Acme Inc.", "Acme Inc", false},
+		{"exact with alphanumericOnly ignores punctuation", MatchRequest{Algorithm: algorithmExact, Normalize: NormalizeOptions{AlphanumericOnly: true}}, "Acme,  Inc.", "Acme Inc", true},
+		{"levenshtein within the threshold", MatchRequest{Algorithm: algorithmLevenshtein, FuzzyThreshold: 20}, "Acme Inc.", "Acme Inc", true},
+		{"levenshtein beyond the threshold", MatchRequest{Algorithm: algorithmLevenshtein, FuzzyThreshold: 10}, "Acme Inc.", "Acme Inc", false},
+		{"useFuzzy without an algorithm is levenshtein", MatchRequest{UseFuzzy: true, FuzzyThreshold: 20}, "Acme Inc.", "Acme Inc", true},
+		{"levenshtein is thrown by word order", MatchRequest{Algorithm: algorithmLevenshtein, FuzzyThreshold: 20}, "Acme Inc.", "Inc, Acme", false},
+		{"token ignores word order and punctuation", MatchRequest{Algorithm: algorithmToken}, "Acme Inc.", "Inc, Acme", true},
+		{"token overlap within the threshold", MatchRequest{Algorithm: algorithmToken, FuzzyThreshold: 50}, "Acme Widgets Inc", "Acme Widgets Ltd", true},
+		{"token overlap beyond the threshold", MatchRequest{Algorithm: algorithmToken, FuzzyThreshold: 40}, "Acme Widgets Inc", "Acme Widgets Ltd", false},
+		// abecdfgh has three runes out of order, half transpositions: Jaro 0.9375, Jaro-Winkler 0.95.
+		{"jaro-winkler counts an odd transposition as a half", MatchRequest{Algorithm: algorithmJaroWinkler, FuzzyThreshold: 6}, "abcdefgh", "abecdfgh", true},
+		{"jaro-winkler does not round a half transposition away", MatchRequest{Algorithm: algorithmJaroWinkler, FuzzyThreshold: 4}, "abcdefgh", "abecdfgh", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesPair(t, tt.req, tt.a, tt.b); got != tt.wantMatch {
+				t.Fatalf("%q and %q matched: %t, want %t", tt.a, tt.b, got, tt.wantMatch)
+			}
+		})
+	}
+
+	putSheets(t, map[string]SheetData{"strategy/A": {Headers: []string{"Value"}, Rows: [][]string{{"x"}}}})
+	w := serveJSON(matchHandler, "POST", "/api/match", MatchRequest{Sheet1: "strategy/A", Sheet2: "strategy/A", Algorithm: "soundex"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown algorithm 'soundex'") {
+		t.Errorf("unknown algorithm: %d %q, want 400", w.Code, w.Body)
+	}
+}
+
+func TestMinTokenLen(t *testing.T) {
+	tests := []struct {
+		name        string
+		algorithm   string
+		threshold   int
+		minTokenLen int
+		a, b        string
+		wantMatch   bool
+	}{
+		{"short tokens make a spurious token overlap", algorithmToken, 50, 0, "a b Acme", "a b Widget", true},
+		{"dropping them removes it", algorithmToken, 50, 2, "a b Acme", "a b Widget", false},
+		{"short tokens hide a token overlap", algorithmToken, 20, 0, "Acme of London", "Acme London", false},
+		{"dropping them reveals it", algorithmToken, 20, 3, "Acme of London", "Acme London", true},
+		{"short tokens make a spurious token-set match", algorithmTokenSet, 60, 0, "a b Acme", "a b Widget", true},
+		{"dropping them removes it from token-set too", algorithmTokenSet, 60, 2, "a b Acme", "a b Widget", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := MatchRequest{Algorithm: tt.algorithm, FuzzyThreshold: tt.threshold, MinTokenLen: tt.minTokenLen}
+			if got := matchesPair(t, req, tt.a, tt.b); got != tt.wantMatch {
+				t.Fatalf("%q and %q matched: %t, want %t", tt.a, tt.b, got, tt.wantMatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// AlignRequest checks that two sheets agree row-for-row on a key column. Unlike
+// /api/match this is positional: row N of sheet1 is only compared with row N of sheet2.
+type AlignRequest struct {
+	Sheet1         string           `json:"sheet1"`
+	Sheet2         string           `json:"sheet2"`
+	Column         string           `json:"column"`
+	Column2        string           `json:"column2"`        // optional, defaults to Column
+	FuzzyThreshold int              `json:"fuzzyThreshold"` // >0 flags differing values within this threshold as close
+	Normalize      NormalizeOptions `json:"normalize"`
+}
+
+// MisalignedRow is a row position where the two sheets disagree.
+type MisalignedRow struct {
+	Row        int     `json:"row"`            // 1-based Excel row number in sheet1
+	Row2       int     `json:"row2,omitempty"` // sheet2's row number, when its header row differs
+	Val1       string  `json:"val1"`
+	Val2       string  `json:"val2"`
+	Close      bool    `json:"close"`      // different, but a fuzzy match under FuzzyThreshold
+	Similarity float64 `json:"similarity"` // percentage
+}
+
+type AlignResult struct {
+	Compared   int             `json:"compared"` // rows present in both sheets
+	Aligned    int             `json:"aligned"`
+	Misaligned []MisalignedRow `json:"misaligned"`
+	ExtraRows1 int             `json:"extraRows1"` // rows past the end of sheet2
+	ExtraRows2 int             `json:"extraRows2"` // rows past the end of sheet1
+}
+
+// alignSheets compares column col1 of sheet1 with col2 of sheet2 position by position.
+func alignSheets(req AlignRequest, sheet1, sheet2 SheetData, col1, col2 int) AlignResult {
+	key1 := req.Normalize.sheetColumnNormalizer(sheet1, col1)
+	key2 := req.Normalize.sheetColumnNormalizer(sheet2, col2)
+
+	n := len(sheet1.Rows)
+	if len(sheet2.Rows) < n {
+		n = len(sheet2.Rows)
+	}
+	result := AlignResult{
+		Compared:   n,
+		Misaligned: make([]MisalignedRow, 0),
+		ExtraRows1: len(sheet1.Rows) - n,
+		ExtraRows2: len(sheet2.Rows) - n,
+	}
+	for i := 0; i < n; i++ {
+		val1, val2 := cellValue(sheet1.Rows[i], col1), cellValue(sheet2.Rows[i], col2)
+		k1, k2 := key1(val1), key2(val2)
+		if k1 == k2 {
+			result.Aligned++
+			continue
+		}
+		dist, ratio := keySimilarity(k1, k2)
+		row2 := 0
+		if sheet2.rowNumber(i) != sheet1.rowNumber(i) {
+			row2 = sheet2.rowNumber(i)
+		}
+		result.Misaligned = append(result.Misaligned, MisalignedRow{
+			Row:        sheet1.rowNumber(i),
+			Row2:       row2,
+			Val1:       val1,
+			Val2:       val2,
+			Close:      req.FuzzyThreshold > 0 && isFuzzyKeyMatch(k1, k2, req.FuzzyThreshold),
+			Similarity: formatSimilarity(similarityPercentage, dist, ratio),
+		})
+	}
+	return result
+}
+
+// alignHandler serves /api/align.
+func alignHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling alignment check request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := AlignRequest{Normalize: profileDefaults(r)}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Column == "" {
+		http.Error(w, "column is required.", http.StatusBadRequest)
+		return
+	}
+	if req.Column2 == "" {
+		req.Column2 = req.Column
+	}
+
+	sheet1, sheet2, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
+		return
+	}
+	col1, col2 := findColumn(sheet1.Headers, req.Column), findColumn(sheet2.Headers, req.Column2)
+	if col1 < 0 || col2 < 0 {
+		http.Error(w, fmt.Sprintf("Column not found (sheet1: '%s', sheet2: '%s').", req.Column, req.Column2), http.StatusBadRequest)
+		return
+	}
+
+	result := alignSheets(req, sheet1, sheet2, col1, col2)
+	log.Printf("INFO: Alignment check complete. %d/%d rows aligned, %d misaligned.", result.Aligned, result.Compared, len(result.Misaligned))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAlignSheets(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"align/A":   {Headers: []string{"Name"}, Rows: [][]string{{"Apple"}, {"Banana"}, {"Cherry"}, {"Date"}}},
+		"align/B":   {Headers: []string{"Fruit"}, Rows: [][]string{{"apple"}, {"Cherry"}, {"Date"}}},
+		"align/C":   {Headers: []string{"Name"}, Rows: [][]string{{"Apple"}, {"Bananas"}, {"Cherry"}, {"Date"}, {"Elder"}}},
+		"align/Off": {Headers: []string{"Name"}, Rows: [][]string{{"Apple"}, {"Bananas"}}, sheetLayout: sheetLayout{HeaderRow: 2}},
+	})
+	tests := []struct {
+		name       string
+		req        AlignRequest
+		wantStatus int
+		want       AlignResult
+	}{
+		{"a dropped row misaligns everything after it", AlignRequest{Sheet1: "align/A", Sheet2: "align/B", Column: "Name", Column2: "Fruit"}, http.StatusOK,
+			AlignResult{Compared: 3, Aligned: 1, ExtraRows1: 1, Misaligned: []MisalignedRow{
+				{Row: 3, Val1: "Banana", Val2: "Cherry", Similarity: 0},
+				{Row: 4, Val1: "Cherry", Val2: "Date", Similarity: 0},
+			}}},
+		{"a near miss is flagged close", AlignRequest{Sheet1: "align/A", Sheet2: "align/C", Column: "Name", FuzzyThreshold: 20}, http.StatusOK,
+			AlignResult{Compared: 4, Aligned: 3, ExtraRows2: 1, Misaligned: []MisalignedRow{
+				{Row: 3, Val1: "Banana", Val2: "Bananas", Close: true, Similarity: 85.71},
+			}}},
+		{"sheet2's row is reported when its header row differs", AlignRequest{Sheet1: "align/A", Sheet2: "align/Off", Column: "Name"}, http.StatusOK,
+			AlignResult{Compared: 2, Aligned: 1, ExtraRows1: 2, Misaligned: []MisalignedRow{
+				{Row: 3, Row2: 4, Val1: "Banana", Val2: "Bananas", Similarity: 85.71},
+			}}},
+		{"a missing column is refused", AlignRequest{Sheet1: "align/A", Sheet2: "align/B", Column: "Name"}, http.StatusBadRequest, AlignResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(alignHandler, "POST", "/api/align", tt.req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got AlignResult
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,12 +4,22 @@ let sheetNames = [];
 let selectedSheets = [];
 let allMatches = []; // Stores the results from the last successful match run
 let sheetDataCache = {}; // Cache to store full sheet data fetched from /api/data
+let session = sessionStorage.getItem('edmsSession'); // Session token issued by the first upload
 
 /**
- * Utility to fetch data from the Go API.
+ * Utility to fetch data from the Go API. Every call carries the session, so this tab only
+ * sees its own uploads.
  */
 async function fetchData(url, options = {}) {
+    if (session) {
+        options.headers = Object.assign({}, options.headers, { 'X-EDMS-Session': session });
+    }
     const response = await fetch(url, options);
+    const issued = response.headers.get('X-EDMS-Session');
+    if (issued && issued !== session) {
+        session = issued;
+        sessionStorage.setItem('edmsSession', session);
+    }
     const result = await response.json();
 
     if (response.status !== 200) {
@@ -31,11 +41,14 @@ window.handleFileUpload = async function() {
 
     const formData = new FormData();
     formData.append('excelFile', file);
+    // Each workbook is its own dataset, so sheets from several files can be matched together.
+    formData.append('dataset', file.name.replace(/\.[^.]+$/, '').replace(/\//g, '_'));
 
     try {
         const result = await fetchData('/api/upload', { method: 'POST', body: formData });
         
-        sheetNames = result.sheetNames;
+        const prefix = result.dataset + '/';
+        sheetNames = sheetNames.filter(name => !name.startsWith(prefix)).concat(result.sheetNames);
         sheetDataCache = {}; // Clear cache on new file
         allMatches = []; // Clear matches
         
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- ZIP Archives ---
+// ---------------------------------------------------------------------
+
+// maxArchiveBytes caps the total uncompressed size read from a ZIP upload, so a small
+// archive cannot expand without bound.
+const maxArchiveBytes = 1 << 30
+
+// parseZipArchive reads every spreadsheet in a ZIP upload. Each file's sheets are named
+// "file/sheet" (the file's path without extension); a delimited, JSON or Parquet file is a single sheet named
+// "file". Entries of other types, and files that fail to parse, are reported in sheetErrors.
+// Archives are always parsed eagerly.
+func parseZipArchive(data []byte, opts uploadOptions) (parsedUpload, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return parsedUpload{}, err
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData),
+		names:       make([]string, 0),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	entryOpts := opts
+	entryOpts.Format, entryOpts.Lazy = "", false
+
+	remaining := int64(maxArchiveBytes)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		format, known := formatExtensions[strings.ToLower(path.Ext(f.Name))]
+		if !known || format == formatZIP {
+			up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: f.Name, Error: "unsupported file type"})
+			continue
+		}
+		file := strings.TrimSuffix(f.Name, path.Ext(f.Name))
+		entryOpts.Filename = f.Name
+
+		content, err := readZipEntry(f, remaining)
+		if err != nil {
+			return parsedUpload{}, err
+		}
+		remaining -= int64(len(content))
+
+		entry, err := parseUpload(content, entryOpts)
+		if isLimitError(err) {
+			return parsedUpload{}, err
+		}
+		if err != nil {
+			log.Printf("WARN: Failed to parse archive entry '%s': %v", f.Name, err)
+			up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: f.Name, Error: err.Error()})
+			continue
+		}
+
+		sheetName := func(name string) string {
+			if format == formatCSV || format == formatTSV || format == formatJSON || format == formatParquet || format == formatXML {
+				return file
+			}
+			return file + "/" + name
+		}
+		for _, name := range entry.names {
+			full := sheetName(name)
+			if _, taken := up.sheets[full]; taken {
+				up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: full, Error: "duplicate sheet name in archive"})
+				continue
+			}
+			up.names = append(up.names, full)
+			up.sheets[full] = entry.sheets[name]
+		}
+		for _, e := range entry.sheetErrors {
+			up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: sheetName(e.Sheet), Error: e.Error})
+		}
+		for _, name := range entry.dropped {
+			up.dropped = append(up.dropped, sheetName(name))
+		}
+	}
+	return up, nil
+}
+
+// readZipEntry decompresses one archive entry, failing once it exceeds limit bytes.
+func readZipEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("reading archive entry '%s': %v", f.Name, err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading archive entry '%s': %v", f.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("archive expands to more than %d bytes", maxArchiveBytes)
+	}
+	return content, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ---------------------------------------------------------------------
+// --- One-to-One Assignment ---
+// ---------------------------------------------------------------------
+
+// With MatchRequest.Assignment set, every row of either sheet keeps at most one match across
+// all groups, so a reconciliation never counts a row twice. "greedy" keeps the best scoring
+// matches first, ties in scan order, skipping any whose rows are already taken. "optimal"
+// solves the assignment problem with the Hungarian algorithm: it keeps as many matches as
+// possible and, among the choices that do, the one with the highest total score. Rows are
+// assigned within each cluster of rows linked by candidate matches, and a cluster too large
+// for the cubic-time solver is rejected with a hint to use greedy.
+
+// Values for MatchRequest.Assignment.
+const (
+	assignmentGreedy  = "greedy"
+	assignmentOptimal = "optimal"
+)
+
+// assignmentMaxCells caps the row pairs, matched or not, of a cluster solved optimally. The
+// solver holds a cost for each and takes time in proportion to their number times the rows
+// on the smaller side, so the cap bounds both.
+const assignmentMaxCells = 1 << 20
+
+// assignmentEdge is one candidate match: where it sits in the groups and the rows it links.
+type assignmentEdge struct {
+	group, match int
+	row1, row2   int
+	score        float64
+}
+
+// validateAssignment rejects unknown assignment modes.
+func validateAssignment(mode string) error {
+	switch mode {
+	case "", assignmentGreedy, assignmentOptimal:
+		return nil
+	}
+	return fmt.Errorf("unknown assignment '%s' (expected greedy or optimal)", mode)
+}
+
+// assignOneToOne reduces the groups to a one-to-one set of matches, dropping groups left empty.
+func assignOneToOne(groups []MatchGroup, mode string) ([]MatchGroup, error) {
+	var edges []assignmentEdge
+	for gi, g := range groups {
+		for mi, m := range g.Matches {
+			edges = append(edges, assignmentEdge{group: gi, match: mi, row1: m.OriginalRow1, row2: m.OriginalRow2, score: m.score})
+		}
+	}
+
+	var kept []assignmentEdge
+	if mode == assignmentGreedy {
+		kept = assignGreedy(edges)
+	} else {
+		for _, cluster := range assignmentClusters(edges) {
+			chosen, err := assignOptimal(cluster)
+			if err != nil {
+				return nil, err
+			}
+			kept = append(kept, chosen...)
+		}
+	}
+
+	keep := make([]map[int]bool, len(groups))
+	for _, e := range kept {
+		if keep[e.group] == nil {
+			keep[e.group] = make(map[int]bool)
+		}
+		keep[e.group][e.match] = true
+	}
+	result := groups[:0]
+	for gi, g := range groups {
+		matches := make([]MatchResult, 0, len(keep[gi]))
+		for mi, m := range g.Matches {
+			if keep[gi][mi] {
+				matches = append(matches, m)
+			}
+		}
+		if len(matches) > 0 {
+			g.Matches = matches
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+// assignGreedy keeps the best scoring edges whose rows are both still free.
+func assignGreedy(edges []assignmentEdge) []assignmentEdge {
+	sorted := append([]assignmentEdge(nil), edges...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].score > sorted[j].score })
+	taken1, taken2 := make(map[int]bool), make(map[int]bool)
+	var kept []assignmentEdge
+	for _, e := range sorted {
+		if !taken1[e.row1] && !taken2[e.row2] {
+			taken1[e.row1], taken2[e.row2] = true, true
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// assignmentClusters splits the edges into the connected clusters of rows they link.
+func assignmentClusters(edges []assignmentEdge) [][]assignmentEdge {
+	// Union-find over rows: sheet1 rows are nodes 0..n1-1, sheet2 rows follow.
+	node1, node2 := make(map[int]int), make(map[int]int)
+	var parent []int
+	nodeOf := func(nodes map[int]int, row int) int {
+		n, ok := nodes[row]
+		if !ok {
+			n = len(parent)
+			nodes[row] = n
+			parent = append(parent, n)
+		}
+		return n
+	}
+	var find func(int) int
+	find = func(n int) int {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+	for _, e := range edges {
+		a, b := find(nodeOf(node1, e.row1)), find(nodeOf(node2, e.row2))
+		if a != b {
+			parent[a] = b
+		}
+	}
+
+	index := make(map[int]int)
+	var clusters [][]assignmentEdge
+	for _, e := range edges {
+		root := find(node1[e.row1])
+		c, ok := index[root]
+		if !ok {
+			c = len(clusters)
+			index[root] = c
+			clusters = append(clusters, nil)
+		}
+		clusters[c] = append(clusters[c], e)
+	}
+	return clusters
+}
+
+// assignOptimal solves one cluster with the Hungarian algorithm. A matched pair costs
+// 1-score, at most 1, and a row left unmatched n+1, more than all n pairs of an assignment
+// together, so an assignment with more pairs is always the cheaper one and, among those with
+// the most pairs, the cheapest has the highest total score.
+func assignOptimal(cluster []assignmentEdge) ([]assignmentEdge, error) {
+	rows1, rows2 := make(map[int]int), make(map[int]int)
+	for _, e := range cluster {
+		if _, ok := rows1[e.row1]; !ok {
+			rows1[e.row1] = len(rows1)
+		}
+		if _, ok := rows2[e.row2]; !ok {
+			rows2[e.row2] = len(rows2)
+		}
+	}
+	if len(cluster) == 1 {
+		return cluster, nil
+	}
+
+	// The solver assigns every row of the smaller side, so that side indexes the rows.
+	swap := len(rows1) > len(rows2)
+	n, m := len(rows1), len(rows2)
+	if swap {
+		n, m = m, n
+	}
+	if n*m > assignmentMaxCells {
+		return nil, fmt.Errorf("%d rows of one sheet compete with %d of the other for the same matches, too many for optimal assignment (at most %d row pairs); use greedy", n, m, assignmentMaxCells)
+	}
+	unmatched := float64(n + 1)
+	cost := make([][]float64, n)
+	edgeAt := make([][]int, n)
+	for i := range cost {
+		cost[i] = make([]float64, m)
+		edgeAt[i] = make([]int, m)
+		for j := range cost[i] {
+			cost[i][j], edgeAt[i][j] = unmatched, -1
+		}
+	}
+	for k, e := range cluster {
+		i, j := rows1[e.row1], rows2[e.row2]
+		if swap {
+			i, j = j, i
+		}
+		if c := 1 - e.score; c < cost[i][j] {
+			cost[i][j], edgeAt[i][j] = c, k
+		}
+	}
+
+	var kept []assignmentEdge
+	for i, j := range hungarian(cost, n, m) {
+		if k := edgeAt[i][j]; k >= 0 {
+			kept = append(kept, cluster[k])
+		}
+	}
+	return kept, nil
+}
+
+// hungarian returns, for each of the n rows of an n x m cost matrix (n <= m), the column
+// assigned to it in a minimum cost assignment.
+func hungarian(cost [][]float64, n, m int) []int {
+	// Potentials u (rows) and v (columns), 1-based with 0 as a sentinel; p[j] is the row
+	// assigned to column j and way[j] the previous column on the augmenting path.
+	u, v := make([]float64, n+1), make([]float64, m+1)
+	p, way := make([]int, m+1), make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost[i0-1][j-1] - u[i0] - v[j]; cur < minv[j] {
+					minv[j], way[j] = cur, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	assigned := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] > 0 {
+			assigned[p[j]-1] = j - 1
+		}
+	}
+	return assigned
+}
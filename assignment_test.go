@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// pairs lists the matches of groups as "row1-row2", sorted.
+func pairs(groups []MatchGroup) []string {
+	var out []string
+	for _, g := range groups {
+		for _, m := range g.Matches {
+			out = append(out, fmt.Sprintf("%d-%d", m.OriginalRow1, m.OriginalRow2))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestAssignOneToOne(t *testing.T) {
+	type edge struct {
+		row1, row2 int
+		score      float64
+	}
+	tests := []struct {
+		name  string
+		mode  string
+		edges []edge
+		want  []string
+	}{
+		{
+			name:  "greedy keeps the best score first",
+			mode:  assignmentGreedy,
+			edges: []edge{{1, 1, 0.9}, {1, 2, 0.95}, {2, 2, 0.8}},
+			want:  []string{"1-2"},
+		},
+		{
+			name:  "optimal keeps the most matches",
+			mode:  assignmentOptimal,
+			edges: []edge{{1, 1, 0.9}, {1, 2, 0.95}, {2, 2, 0.8}},
+			want:  []string{"1-1", "2-2"},
+		},
+		{
+			// The two perfect matches leave row 3 out; only the three weak ones match every row.
+			name:  "optimal prefers cardinality over score along a long augmenting path",
+			mode:  assignmentOptimal,
+			edges: []edge{{1, 1, 1}, {2, 2, 1}, {3, 1, 0.01}, {1, 2, 0.01}, {2, 3, 0.01}},
+			want:  []string{"1-2", "2-3", "3-1"},
+		},
+		{
+			name:  "optimal breaks cardinality ties by total score",
+			mode:  assignmentOptimal,
+			edges: []edge{{1, 1, 0.6}, {1, 2, 0.9}, {2, 1, 0.9}, {2, 2, 0.6}},
+			want:  []string{"1-2", "2-1"},
+		},
+		{
+			name:  "separate clusters are solved independently",
+			mode:  assignmentOptimal,
+			edges: []edge{{1, 1, 0.7}, {2, 1, 0.8}, {5, 5, 1}},
+			want:  []string{"2-1", "5-5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := MatchGroup{Tab1: "A", Tab2: "B"}
+			for _, e := range tt.edges {
+				g.Matches = append(g.Matches, MatchResult{OriginalRow1: e.row1, OriginalRow2: e.row2, score: e.score})
+			}
+			got, err := assignOneToOne([]MatchGroup{g}, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p := pairs(got); !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("pairs = %v, want %v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignOptimalTooLarge(t *testing.T) {
+	// A chain of rows, each sheet1 row matching two sheet2 rows, links them all in one cluster.
+	g := MatchGroup{}
+	for r := 0; r*r <= assignmentMaxCells; r++ {
+		g.Matches = append(g.Matches,
+			MatchResult{OriginalRow1: r, OriginalRow2: r, score: 1},
+			MatchResult{OriginalRow1: r, OriginalRow2: r + 1, score: 0.5})
+	}
+	_, err := assignOneToOne([]MatchGroup{g}, assignmentOptimal)
+	if err == nil || !strings.Contains(err.Error(), "use greedy") {
+		t.Errorf("err = %v, want a hint to use greedy", err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Resumable Uploads ---
+// ---------------------------------------------------------------------
+
+// A resumable upload is created with POST /api/upload/chunked, which returns its ID. The file
+// is then sent in PATCH /api/upload/chunked/{id} requests, each carrying the byte offset it
+// starts at in the uploadOffsetHeader; HEAD returns the offset to resume from after a broken
+// connection. The chunk that completes the file stores it like a direct upload and returns
+// the usual upload response.
+const uploadOffsetHeader = "Upload-Offset"
+
+var (
+	chunkedMaxBytes int64 = 2 << 30
+	chunkedIdle           = 24 * time.Hour // unfinished uploads idle this long are discarded
+)
+
+// ChunkedUploadRequest starts a resumable upload of a file of the given size.
+type ChunkedUploadRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	uploadOptions
+}
+
+// chunkedUpload is an unfinished resumable upload, spooled to a temporary file.
+type chunkedUpload struct {
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	offset   int64
+	opts     uploadOptions
+	lastUsed time.Time
+
+	discarded bool // the upload was completed, deleted or expired while a request waited for it
+}
+
+// chunkedMutex guards chunkedUploads. Code holding both locks takes an upload's mu first.
+var (
+	chunkedUploads = make(map[string]*chunkedUpload)
+	chunkedMutex   sync.Mutex
+)
+
+// discard removes the upload's temporary file. Callers must hold u.mu.
+func (u *chunkedUpload) discard() {
+	u.discarded = true
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+// expireChunkedUploads discards uploads idle for longer than chunkedIdle. Like appendChunk,
+// it takes an upload's lock before chunkedMutex, never the other way round.
+func expireChunkedUploads(now time.Time) {
+	chunkedMutex.Lock()
+	uploads := make(map[string]*chunkedUpload, len(chunkedUploads))
+	for id, u := range chunkedUploads {
+		uploads[id] = u
+	}
+	chunkedMutex.Unlock()
+	for id, u := range uploads {
+		u.mu.Lock()
+		if !u.discarded && now.Sub(u.lastUsed) > chunkedIdle {
+			log.Printf("INFO: Discarding idle upload '%s' at %d/%d bytes.", id, u.offset, u.size)
+			chunkedMutex.Lock()
+			delete(chunkedUploads, id)
+			chunkedMutex.Unlock()
+			u.discard()
+		}
+		u.mu.Unlock()
+	}
+}
+
+// chunkedUploadHandler serves POST /api/upload/chunked and HEAD/PATCH/DELETE /api/upload/chunked/{id}.
+func chunkedUploadHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/upload/chunked"), "/")
+	if id == "" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		createChunkedUpload(w, r)
+		return
+	}
+
+	chunkedMutex.Lock()
+	u := chunkedUploads[id]
+	chunkedMutex.Unlock()
+	if u == nil {
+		http.Error(w, fmt.Sprintf("Upload '%s' not found.", id), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "HEAD":
+		u.mu.Lock()
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(u.offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.size, 10))
+		u.mu.Unlock()
+	case "PATCH":
+		appendChunk(w, r, id, u)
+	case "DELETE":
+		chunkedMutex.Lock()
+		delete(chunkedUploads, id)
+		chunkedMutex.Unlock()
+		u.mu.Lock()
+		if !u.discarded {
+			u.discard()
+		}
+		u.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	var req ChunkedUploadRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Size <= 0 || req.Size > chunkedMaxBytes {
+		http.Error(w, fmt.Sprintf("size must be between 1 and %d bytes.", chunkedMaxBytes), http.StatusBadRequest)
+		return
+	}
+	if err := checkUploadSize(req.Size); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	expireChunkedUploads(time.Now())
+
+	f, err := os.CreateTemp("", "edms-upload-*")
+	if err != nil {
+		log.Printf("ERROR: Failed to create upload spool file: %v", err)
+		http.Error(w, "Error creating upload.", http.StatusInternalServerError)
+		return
+	}
+	req.uploadOptions.Filename = req.Filename
+	id := randomID()
+	chunkedMutex.Lock()
+	chunkedUploads[id] = &chunkedUpload{file: f, size: req.Size, opts: req.uploadOptions, lastUsed: time.Now()}
+	chunkedMutex.Unlock()
+	log.Printf("INFO: Started resumable upload '%s' of %s (%d bytes).", id, req.Filename, req.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(uploadOffsetHeader, "0")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"uploadId": id, "offset": 0, "size": req.Size})
+}
+
+// appendChunk writes one PATCH body at its declared offset. A chunk whose offset does not
+// match the bytes received so far is rejected with 409 and the current offset, so the client
+// can resume from there.
+func appendChunk(w http.ResponseWriter, r *http.Request, id string, u *chunkedUpload) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.discarded {
+		http.Error(w, fmt.Sprintf("Upload '%s' not found.", id), http.StatusNotFound)
+		return
+	}
+	u.lastUsed = time.Now()
+
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Missing or invalid %s header.", uploadOffsetHeader), http.StatusBadRequest)
+		return
+	}
+	if offset != u.offset {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(u.offset, 10))
+		http.Error(w, fmt.Sprintf("Offset %d does not match the %d bytes received so far.", offset, u.offset), http.StatusConflict)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, u.size-u.offset)
+	n, err := io.Copy(u.file, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			// Drop the whole chunk, so the file cannot look complete.
+			u.file.Truncate(u.offset)
+			u.file.Seek(u.offset, io.SeekStart)
+			w.Header().Set(uploadOffsetHeader, strconv.FormatInt(u.offset, 10))
+			http.Error(w, fmt.Sprintf("Chunk runs past the declared size of %d bytes.", u.size), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+	u.offset += n
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(u.offset, 10))
+	if err != nil {
+		// The bytes that did arrive are kept; the client resumes from the returned offset.
+		log.Printf("WARN: Upload '%s' interrupted at %d/%d bytes: %v", id, u.offset, u.size, err)
+		http.Error(w, fmt.Sprintf("Error reading chunk: %v", err), http.StatusBadRequest)
+		return
+	}
+	if u.offset < u.size {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	chunkedMutex.Lock()
+	delete(chunkedUploads, id)
+	chunkedMutex.Unlock()
+	if _, err := u.file.Seek(0, io.SeekStart); err != nil {
+		u.discard()
+		http.Error(w, "Error reading upload.", http.StatusInternalServerError)
+		return
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, u.size))
+	_, err = io.Copy(buf, u.file)
+	u.discard()
+	if err != nil {
+		log.Printf("ERROR: Failed to read back upload '%s': %v", id, err)
+		http.Error(w, "Error reading upload.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO: Resumable upload '%s' complete (%d bytes).", id, u.size)
+	storeWorkbook(w, r, buf, u.opts)
+}
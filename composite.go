@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Composite Keys ---
+// ---------------------------------------------------------------------
+
+// With MatchRequest.KeyColumns set, rows are matched on one key built from several columns,
+// such as LastName+DOB, instead of column by column. Each part is normalized as its column
+// would be on its own, and a row with any part blank has no key. The request's algorithm
+// scores the keys, with the parts joined so token-based algorithms see them as separate
+// words. The result is a single group headed by the joined column names, its values showing
+// the parts separated by " | ", and cell references, when requested, point at the first column
+// of the key. Composite keys cannot be combined with ColorMode, IsTargeted or ColumnPairs.
+
+// KeyColumn pairs a sheet1 column with the sheet2 column it is matched against within a
+// composite key.
+type KeyColumn struct {
+	Column1 string `json:"column1"`
+	Column2 string `json:"column2"`
+
+	// With weighted scoring (see weighted.go): the field's weight, 1 when 0, and its
+	// algorithm, the request's when empty.
+	Weight    float64 `json:"weight"`
+	Algorithm string  `json:"algorithm"`
+}
+
+// compositeSeparator joins the parts of a composite key. It never occurs in cell text and is
+// neither a letter nor a digit, so tokenizing algorithms split on it.
+const compositeSeparator = "\x1f"
+
+// compositeDisplaySeparator joins the parts of a composite value in results.
+const compositeDisplaySeparator = " | "
+
+// compositeSide returns the matchSide matching data on the composite key of the given
+// columns: each row becomes its joined key parts, followed by its ID when idCol is set, or
+// an empty row when a part is blank.
+func compositeSide(req MatchRequest, sheet string, data SheetData, columns []string, idCol int) (matchSide, []int, error) {
+	cols := make([]int, len(columns))
+	for i, name := range columns {
+		if cols[i] = findColumn(data.Headers, name); cols[i] < 0 {
+			return matchSide{}, nil, fmt.Errorf("key column '%s' not found in sheet '%s'", name, sheet)
+		}
+	}
+
+	norms := req.Normalize.columnNormalizers(data)
+	rows := make([][]string, len(data.Rows))
+	for r, row := range data.Rows {
+		parts := make([]string, len(cols))
+		blank := false
+		for i, c := range cols {
+			parts[i] = cellValue(row, c)
+			blank = blank || strings.TrimSpace(parts[i]) == ""
+		}
+		if blank {
+			continue // an empty row takes no part, as short rows do
+		}
+		rows[r] = []string{strings.Join(parts, compositeSeparator)}
+		if idCol >= 0 {
+			rows[r] = append(rows[r], cellValue(row, idCol))
+		}
+	}
+	key := func(v string) string {
+		parts := strings.Split(v, compositeSeparator)
+		if len(parts) != len(cols) {
+			return ""
+		}
+		for i, part := range parts {
+			if parts[i] = norms[cols[i]](part); parts[i] == "" {
+				return ""
+			}
+		}
+		return strings.Join(parts, compositeSeparator)
+	}
+
+	side := matchSide{
+		Headers: []string{compositeHeader(data.Headers, cols)}, Source: newSliceRowSource(rows),
+		IDCol: -1, Keys: []normalizer{key}, FirstRow: data.rowNumber(0),
+	}
+	if idCol >= 0 {
+		side.IDCol = 1
+	}
+	return side, cols, nil
+}
+
+// compositeHeader names a composite key after its columns, as "LastName+DOB".
+func compositeHeader(headers []string, cols []int) string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = headers[c]
+	}
+	return strings.Join(names, "+")
+}
+
+// compositeSides resolves the request's key columns into the two sides of the match, with
+// the sheet columns each key starts at.
+func compositeSides(req MatchRequest, sheet1Data, sheet2Data SheetData, idCol1, idCol2 int) (matchSide, matchSide, [2]int, error) {
+	columns1 := make([]string, len(req.KeyColumns))
+	columns2 := make([]string, len(req.KeyColumns))
+	for i, kc := range req.KeyColumns {
+		if kc.Column1 == "" || kc.Column2 == "" {
+			return matchSide{}, matchSide{}, [2]int{}, fmt.Errorf("keyColumns entry %d needs both column1 and column2", i+1)
+		}
+		columns1[i], columns2[i] = kc.Column1, kc.Column2
+	}
+	side1, cols1, err := compositeSide(req, req.Sheet1, sheet1Data, columns1, idCol1)
+	if err != nil {
+		return matchSide{}, matchSide{}, [2]int{}, err
+	}
+	side2, cols2, err := compositeSide(req, req.Sheet2, sheet2Data, columns2, idCol2)
+	if err != nil {
+		return matchSide{}, matchSide{}, [2]int{}, err
+	}
+	return side1, side2, [2]int{cols1[0], cols2[0]}, nil
+}
+
+// finishCompositeGroups shows the matched composite values with their parts separated, and
+// points the groups at the first column of each key.
+func finishCompositeGroups(groups []MatchGroup, first [2]int) {
+	for gi := range groups {
+		g := &groups[gi]
+		g.col1, g.col2 = first[0], first[1]
+		for i := range g.Matches {
+			m := &g.Matches[i]
+			m.Val1 = strings.ReplaceAll(m.Val1, compositeSeparator, compositeDisplaySeparator)
+			m.Val2 = strings.ReplaceAll(m.Val2, compositeSeparator, compositeDisplaySeparator)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Datasets ---
+// ---------------------------------------------------------------------
+
+// Every upload is stored as a dataset, and its sheets are keyed "dataset/sheet" in dataStore,
+// so sheets from different workbooks can be matched against each other.
+
+// datasetInfo records what was loaded into a dataset.
+type datasetInfo struct {
+	Hash         string               // SHA-256 of the workbook the dataset was parsed from
+	Sheets       []string             // namespaced sheet keys returned for that workbook
+	Styles       bool                 // whether cell fill colors were captured
+	KeepEmpty    bool                 // whether empty sheets were kept
+	Dropped      []string             // empty sheets left out of the dataset
+	Delimiter    string               // separator of a delimited text upload
+	Layout       sheetLayout          // header rows the sheets were split at
+	Selected     []string             // the upload's sheets filter, nil when every sheet was loaded
+	FixedWidth   string               // column spec of a fixed-width text upload
+	XMLMapping   string               // record element and fields of an XML upload, joined by "|"
+	Version      int                  // numbers the dataset's contents from 1; see versions.go
+	Uploaded     time.Time            // when these contents were stored
+	RestoredFrom int                  // version these contents were rolled back to, 0 for an upload
+	Bytes        int64                // estimated size of the sheets; see quota.go
+	Filename     string               // file these contents were last loaded from
+	Tags         map[string]string    // tags given to the sheets of the last upload; see tags.go
+	Meta         map[string]sheetMeta // source of each sheet key
+	Appended     bool                 // whether the last upload was appended to earlier contents
+	Sources      []lazySource         `json:",omitempty"` // pending sheets as persisted, nil in memory; see lazy.go
+
+	books []*lazyWorkbook // open workbooks of lazy uploads; appending can add several
+}
+
+// sheetMeta records where a sheet came from.
+type sheetMeta struct {
+	File string            // file the sheet was loaded from
+	Tags map[string]string // tags of the upload that loaded it
+}
+
+// Upload modes: replace swaps out a dataset's contents, append adds sheets to it.
+const (
+	uploadModeReplace = "replace"
+	uploadModeAppend  = "append"
+)
+
+// validateUploadMode checks an upload's mode; "" means replace.
+func validateUploadMode(mode string) error {
+	switch mode {
+	case "", uploadModeReplace, uploadModeAppend:
+		return nil
+	}
+	return fmt.Errorf("unknown upload mode '%s' (expected replace or append)", mode)
+}
+
+// datasets is guarded by storeMutex along with dataStore.
+var datasets = make(map[string]datasetInfo)
+
+// datasetID validates a client-supplied dataset name, defaulting to a prefix of the content
+// hash so that clients uploading different workbooks without naming them never collide.
+func datasetID(requested, contentHash string) (string, error) {
+	id := strings.TrimSpace(requested)
+	if id == "" {
+		return contentHash[:12], nil
+	}
+	if strings.Contains(id, "/") {
+		return "", fmt.Errorf("dataset name '%s' must not contain '/'", id)
+	}
+	if strings.HasPrefix(id, sessionScope) {
+		return "", fmt.Errorf("dataset name '%s' must not start with '%s'", id, sessionScope)
+	}
+	return id, nil
+}
+
+// sheetKey is the dataStore key for a sheet within a dataset.
+func sheetKey(dataset, sheet string) string {
+	return dataset + "/" + sheet
+}
+
+// keyDataset returns the dataset ID of a sheet key, "" if the key names no sheet.
+func keyDataset(key string) string {
+	scope := ""
+	if strings.HasPrefix(key, sessionScope) {
+		token, rest, ok := strings.Cut(key, "/")
+		if !ok {
+			return ""
+		}
+		scope, key = token+"/", rest
+	}
+	name, _, ok := strings.Cut(key, "/")
+	if !ok || name == "" {
+		return ""
+	}
+	return scope + name
+}
+
+// getSheet fetches a sheet by its namespaced key, parsing it first if it was uploaded lazily.
+// The error is set when a lazy sheet exists but cannot be read.
+func getSheet(key string) (SheetData, bool, error) {
+	storeMutex.RLock()
+	data, ok := dataStore[key]
+	pending := pendingSheets[key]
+	storeMutex.RUnlock()
+	if ok {
+		return data, true, nil
+	}
+	if pending == nil {
+		return SheetData{}, false, nil
+	}
+
+	data, err := pending.load()
+	if err != nil {
+		return SheetData{}, true, err
+	}
+	storeMutex.Lock()
+	if pendingSheets[key] == pending { // unless the dataset was replaced meanwhile
+		delete(pendingSheets, key)
+		dataStore[key] = data
+	}
+	storeMutex.Unlock()
+	return data, true, nil
+}
+
+// replaceDataset swaps in the parsed sheets of a dataset in one step, dropping whatever the
+// dataset held before into its version history. Other datasets are untouched. sheets and the
+// not yet parsed pending sheets are keyed by plain sheet name, and info.Bytes is their size.
+// Unless info.Meta is set, every sheet is recorded as loaded from info.Filename with info.Tags.
+// It returns the dataset's sheet keys and new version number, or an error wrapping
+// errStoreFull if the sheets do not fit in the store quota.
+func replaceDataset(id string, info datasetInfo, names []string, sheets map[string]SheetData, pending map[string]*lazySheet) ([]string, int, error) {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = sheetKey(id, name)
+	}
+	sort.Strings(keys)
+
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	if err := reserveLocked(info.Bytes); err != nil {
+		return nil, 0, err
+	}
+	prev := datasets[id]
+	info.Version = archiveDatasetLocked(id)
+	detachDatasetLocked(id)
+	for name, data := range sheets {
+		dataStore[sheetKey(id, name)] = data
+	}
+	for name, sheet := range pending {
+		pendingSheets[sheetKey(id, name)] = sheet
+	}
+	info.Sheets = keys
+	if info.Meta == nil {
+		info.Meta = make(map[string]sheetMeta, len(keys))
+		for _, key := range keys {
+			info.Meta[key] = sheetMeta{File: info.Filename, Tags: info.Tags}
+		}
+	}
+	datasets[id] = info
+	closeUnusedBooksLocked(id, prev.books)
+	return keys, info.Version, nil
+}
+
+// appendDataset adds the parsed sheets to a dataset, creating it if needed, after saving its
+// previous contents as a version. A sheet with the name of one loaded from the same file
+// replaces it, while one named like a sheet of another file is added beside it as
+// "file!sheet" (see appendedNames); the dataset's other sheets are kept. info.Bytes is the size
+// of the added sheets. It returns all of the dataset's sheet keys and its new version number,
+// or an error wrapping errStoreFull.
+func appendDataset(id string, info datasetInfo, names []string, sheets map[string]SheetData, pending map[string]*lazySheet) ([]string, int, error) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	if err := reserveLocked(info.Bytes); err != nil {
+		return nil, 0, err
+	}
+	prev := datasets[id]
+	info.Bytes += prev.Bytes
+	info.Version = archiveDatasetLocked(id)
+	info.Appended = len(prev.Sheets) > 0
+
+	renamed := appendedNames(id, prev, info.Filename, names)
+	names = slices.Clone(names)
+	for i, name := range names {
+		if to, ok := renamed[name]; ok {
+			names[i] = to
+		}
+	}
+	sheets, pending = renameSheets(sheets, renamed), renameSheets(pending, renamed)
+
+	added := make(map[string]bool, len(names))
+	for _, name := range names {
+		key := sheetKey(id, name)
+		added[key] = true
+		if old, ok := dataStore[key]; ok {
+			info.Bytes -= old.bytes()
+		}
+		delete(dataStore, key)
+		delete(pendingSheets, key)
+	}
+	for name, data := range sheets {
+		dataStore[sheetKey(id, name)] = data
+	}
+	for name, sheet := range pending {
+		pendingSheets[sheetKey(id, name)] = sheet
+	}
+
+	keys := make([]string, 0, len(prev.Sheets)+len(names))
+	for _, key := range prev.Sheets {
+		if !added[key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range added {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dropped := append([]string{}, info.Dropped...)
+	for _, name := range prev.Dropped {
+		if !added[sheetKey(id, name)] && !slices.Contains(dropped, name) {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+
+	meta := make(map[string]sheetMeta, len(keys))
+	for _, key := range keys {
+		if added[key] {
+			meta[key] = sheetMeta{File: info.Filename, Tags: info.Tags}
+		} else {
+			meta[key] = prev.Meta[key]
+		}
+	}
+
+	if len(renamed) > 0 {
+		log.Printf("INFO: Appended sheet(s) named like sheets of other files were renamed: %v", renamed)
+	}
+	info.Sheets = keys
+	info.Meta = meta
+	info.Dropped = dropped
+	info.books = append(prev.books, info.books...)
+	datasets[id] = info
+	return keys, info.Version, nil
+}
+
+// appendedNames returns the new names of appended sheets that would otherwise replace a
+// sheet loaded from another file: "q2!Sheet1" for Sheet1 of q2.xlsx. Sheets of an upload
+// without a file name keep theirs and replace the earlier sheet.
+func appendedNames(id string, prev datasetInfo, filename string, names []string) map[string]string {
+	file := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	renamed := make(map[string]string)
+	if filename == "" || file == "" || file == "." {
+		return renamed
+	}
+	for _, name := range names {
+		key := sheetKey(id, name)
+		if !slices.Contains(prev.Sheets, key) || prev.Meta[key].File == filename {
+			continue
+		}
+		renamed[name] = file + "!" + name
+	}
+	return renamed
+}
+
+// renameSheets returns sheets with the keys in renamed replaced by their new names.
+func renameSheets[T any](sheets map[string]T, renamed map[string]string) map[string]T {
+	if len(renamed) == 0 || sheets == nil {
+		return sheets
+	}
+	out := make(map[string]T, len(sheets))
+	for name, sheet := range sheets {
+		if to, ok := renamed[name]; ok {
+			name = to
+		}
+		out[name] = sheet
+	}
+	return out
+}
+
+// removeDatasetLocked deletes a dataset, its sheets and its versions. Callers must hold
+// storeMutex.
+func removeDatasetLocked(id string) bool {
+	info, ok := datasets[id]
+	books := info.books
+	for _, v := range versions[id] {
+		books = append(books, v.info.books...)
+	}
+	detachDatasetLocked(id)
+	delete(versions, id)
+	closeUnusedBooksLocked(id, books)
+	return ok
+}
+
+// removeSheetLocked deletes one sheet of a dataset, saving the dataset's previous contents as a
+// version first so the deletion can be rolled back. A dataset left without sheets is removed
+// along with its versions. found reports whether the sheet existed, and version is the
+// dataset's new version number, 0 once it is gone. Callers must hold storeMutex.
+func removeSheetLocked(id, key string) (found bool, version int) {
+	info, ok := datasets[id]
+	if !ok || !slices.Contains(info.Sheets, key) {
+		return false, 0
+	}
+	if len(info.Sheets) == 1 {
+		removeDatasetLocked(id)
+		return true, 0
+	}
+	if old, ok := dataStore[key]; ok {
+		info.Bytes -= old.bytes()
+	}
+	info.Version = archiveDatasetLocked(id)
+	delete(dataStore, key)
+	delete(pendingSheets, key)
+	info.Sheets = slices.DeleteFunc(slices.Clone(info.Sheets), func(k string) bool { return k == key })
+	info.Meta = maps.Clone(info.Meta)
+	delete(info.Meta, key)
+	info.Hash = "" // no longer the workbook's contents, so an idempotent re-upload loads it again
+	info.Uploaded = time.Now()
+	info.RestoredFrom = 0
+	datasets[id] = info
+	return true, info.Version
+}
+
+// deleteSheet handles DELETE /api/data/{dataset}/{sheet} for dataHandler, removing a sheet of a
+// dataset of the request's session. Shared sheets can only be deleted without a session.
+func deleteSheet(w http.ResponseWriter, session, sheetName string) {
+	id, _, _ := strings.Cut(sheetName, "/")
+	scoped := scopedKey(session, id)
+	found, version := false, 0
+	storeMutex.Lock()
+	if scoped != "" {
+		found, version = removeSheetLocked(scoped, scopedKey(session, sheetName))
+	}
+	storeMutex.Unlock()
+
+	if !found {
+		http.Error(w, "Sheet not found.", http.StatusNotFound)
+		return
+	}
+	message := "Sheet deleted."
+	if version == 0 {
+		unpersistDataset(scoped)
+		message = "Sheet deleted along with its dataset, which had no other sheets."
+	} else {
+		persistDataset(scoped)
+	}
+	log.Printf("INFO: Deleted sheet '%s'.", sheetName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sheet":   sheetName,
+		"dataset": id,
+		"version": version,
+		"message": message,
+	})
+}
+
+// SheetPatchRequest is the body of PATCH /api/data/{dataset}/{sheet}. Name renames the sheet
+// within its dataset.
+type SheetPatchRequest struct {
+	Name string `json:"name"`
+}
+
+// renameSheetLocked moves a sheet of a dataset to a new key, saving the dataset's previous
+// contents as a version first. It returns the dataset's new version number, or 0 with
+// http.StatusNotFound or http.StatusConflict when the sheet is missing or the new key taken.
+// Callers must hold storeMutex.
+func renameSheetLocked(id, key, newKey string) (version, status int) {
+	info, ok := datasets[id]
+	if !ok || !slices.Contains(info.Sheets, key) {
+		return 0, http.StatusNotFound
+	}
+	if slices.Contains(info.Sheets, newKey) {
+		return 0, http.StatusConflict
+	}
+	info.Version = archiveDatasetLocked(id)
+	if data, ok := dataStore[key]; ok {
+		delete(dataStore, key)
+		dataStore[newKey] = data
+	}
+	if pending, ok := pendingSheets[key]; ok {
+		delete(pendingSheets, key)
+		pendingSheets[newKey] = pending
+	}
+	sheets := slices.DeleteFunc(slices.Clone(info.Sheets), func(k string) bool { return k == key })
+	info.Sheets = append(sheets, newKey)
+	sort.Strings(info.Sheets)
+	info.Meta = maps.Clone(info.Meta)
+	info.Meta[newKey] = info.Meta[key]
+	delete(info.Meta, key)
+	info.Hash = "" // as for removeSheetLocked
+	info.Uploaded = time.Now()
+	info.RestoredFrom = 0
+	datasets[id] = info
+	return info.Version, http.StatusOK
+}
+
+// patchSheet handles PATCH /api/data/{dataset}/{sheet} for dataHandler, renaming a sheet of a
+// dataset of the request's session so later match reports carry a meaningful name.
+func patchSheet(w http.ResponseWriter, r *http.Request, session, sheetName string) {
+	var req SheetPatchRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		http.Error(w, "name is required.", http.StatusBadRequest)
+		return
+	}
+	id, _, _ := strings.Cut(sheetName, "/")
+	newName := sheetKey(id, name)
+	scoped := scopedKey(session, id)
+	version, status := 0, http.StatusNotFound
+	storeMutex.Lock()
+	if scoped != "" {
+		version, status = renameSheetLocked(scoped, scopedKey(session, sheetName), scopedKey(session, newName))
+	}
+	storeMutex.Unlock()
+
+	switch status {
+	case http.StatusNotFound:
+		http.Error(w, "Sheet not found.", status)
+		return
+	case http.StatusConflict:
+		http.Error(w, fmt.Sprintf("Sheet '%s' already exists.", newName), status)
+		return
+	}
+	persistDataset(scoped)
+	log.Printf("INFO: Renamed sheet '%s' to '%s'.", sheetName, newName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sheet":   newName,
+		"renamed": sheetName,
+		"dataset": id,
+		"version": version,
+		"message": "Sheet renamed.",
+	})
+}
+
+// detachDatasetLocked removes a dataset and its sheets from the store, leaving its workbooks
+// open. Callers must hold storeMutex.
+func detachDatasetLocked(id string) {
+	prefix := sheetKey(id, "")
+	for key := range dataStore {
+		if strings.HasPrefix(key, prefix) {
+			delete(dataStore, key)
+		}
+	}
+	for key := range pendingSheets {
+		if strings.HasPrefix(key, prefix) {
+			delete(pendingSheets, key)
+		}
+	}
+	delete(datasets, id)
+}
+
+// datasetHandler serves DELETE /api/dataset/{id}, freeing the memory held by a dataset of the
+// request's session, and the version endpoints below it (see versions.go). Shared datasets
+// can only be managed without a session.
+func datasetHandler(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/dataset/"), "/")
+	if id == "" {
+		http.Error(w, "Dataset not specified.", http.StatusBadRequest)
+		return
+	}
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	scoped := scopedKey(session, id)
+	if sub != "" {
+		versionsHandler(w, r, session, id, scoped, sub)
+		return
+	}
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	storeMutex.Lock()
+	found := scoped != "" && removeDatasetLocked(scoped)
+	storeMutex.Unlock()
+
+	if !found {
+		http.Error(w, fmt.Sprintf("Dataset '%s' not found.", id), http.StatusNotFound)
+		return
+	}
+	unpersistDataset(scoped)
+	log.Printf("INFO: Deleted dataset '%s'.", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dataset": id,
+		"message": "Dataset deleted.",
+	})
+}
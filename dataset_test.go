@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseAsSheet1 reads any upload as delimited text in a sheet named Sheet1, as the first
+// sheet of a workbook would be.
+func parseAsSheet1(data []byte, opts uploadOptions) (parsedUpload, error) {
+	opts.Filename = "Sheet1.csv"
+	return parseDelimitedUpload(data, opts)
+}
+
+func TestAppendUploads(t *testing.T) {
+	type upload struct {
+		file, data, mode string
+		idempotent       bool
+		wantSheets       []string
+		wantCached       bool
+	}
+	tests := []struct {
+		name    string
+		uploads []upload
+	}{
+		{"same-named sheets of another file are kept beside the first", []upload{
+			{file: "q1.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+			{file: "q2.xlsx", data: "id\n2\n", mode: uploadModeAppend, wantSheets: []string{"Sheet1", "q2!Sheet1"}},
+			{file: "q2.xlsx", data: "id\n3\n", mode: uploadModeAppend, wantSheets: []string{"Sheet1", "q2!Sheet1"}},
+		}},
+		{"re-appending the same file replaces its sheets", []upload{
+			{file: "q1.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+			{file: "q1.xlsx", data: "id\n2\n", mode: uploadModeAppend, wantSheets: []string{"Sheet1"}},
+		}},
+		{"re-uploading the same file is served from the cache", []upload{
+			{file: "a.xlsx", data: "id\n1\n", idempotent: true, wantSheets: []string{"Sheet1"}},
+			{file: "a.xlsx", data: "id\n1\n", idempotent: true, wantSheets: []string{"Sheet1"}, wantCached: true},
+		}},
+		{"a changed file is parsed again", []upload{
+			{file: "a.xlsx", data: "id\n1\n", idempotent: true, wantSheets: []string{"Sheet1"}},
+			{file: "a.xlsx", data: "id\n2\n", idempotent: true, wantSheets: []string{"Sheet1"}},
+		}},
+		{"the cache is opt-in", []upload{
+			{file: "a.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+			{file: "a.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+		}},
+		{"a replace-mode upload after an append is not served from the cache", []upload{
+			{file: "a.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+			{file: "b.xlsx", data: "id\n2\n", mode: uploadModeAppend, wantSheets: []string{"Sheet1", "b!Sheet1"}},
+			{file: "b.xlsx", data: "id\n2\n", idempotent: true, wantSheets: []string{"Sheet1"}},
+		}},
+		{"an idempotent append of the same file is served from the cache", []upload{
+			{file: "a.xlsx", data: "id\n1\n", wantSheets: []string{"Sheet1"}},
+			{file: "b.xlsx", data: "id\n2\n", mode: uploadModeAppend, wantSheets: []string{"Sheet1", "b!Sheet1"}},
+			{file: "b.xlsx", data: "id\n2\n", mode: uploadModeAppend, idempotent: true, wantSheets: []string{"Sheet1", "b!Sheet1"}, wantCached: true},
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := "append-test-" + string(rune('a'+i))
+			defer func() {
+				storeMutex.Lock()
+				removeDatasetLocked(dataset)
+				storeMutex.Unlock()
+			}()
+			for j, u := range tt.uploads {
+				opts := uploadOptions{Dataset: dataset, Filename: u.file, Mode: u.mode, Idempotent: u.idempotent}
+				res, status, err := ingestUpload([]byte(u.data), opts, parseAsSheet1, http.StatusBadRequest)
+				if err != nil {
+					t.Fatalf("upload %d: %d %v", j+1, status, err)
+				}
+				names := make([]string, len(res.SheetNames))
+				for k, key := range res.SheetNames {
+					names[k] = strings.TrimPrefix(key, sheetKey(dataset, ""))
+				}
+				if !reflect.DeepEqual(names, u.wantSheets) {
+					t.Errorf("upload %d: sheets = %q, want %q", j+1, names, u.wantSheets)
+				}
+				if res.Cached != u.wantCached {
+					t.Errorf("upload %d: cached = %t, want %t", j+1, res.Cached, u.wantCached)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Date Matching ---
+// ---------------------------------------------------------------------
+
+// The "date" algorithm matches values on the calendar day they name, whatever their format:
+// "01/02/2024", "2024-02-01", "1 Feb 2024", "20240201" and the Excel serial 45323 are all the
+// same day. Numeric dates are read day first unless MatchRequest.DateOrder is "mdy"; a time of
+// day is ignored. Two dates match when they are at most MatchRequest.DateWindow days apart,
+// so 0 requires the same day. The distance reported is the number of days between them and
+// the ratio falls from 1 for the same day towards 0 at the edge of the window. The window
+// replaces FuzzyThreshold for this algorithm.
+
+// Values for MatchRequest.DateOrder.
+const (
+	dateOrderDMY = "dmy"
+	dateOrderMDY = "mdy"
+)
+
+// Excel serial dates count days from 1899-12-30, except that Excel treats 1900 as a leap year,
+// so serials up to 60, its phantom 29 February, are a day later than the count says. Serials
+// up to excelMaxSerial (9999-12-31) are read as dates.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+const excelMaxSerial = 2958465
+
+// numericDatePattern matches dates written as three numbers ("01/02/2024", "2024-02-01",
+// "1.2.24"), optionally followed by a time of day.
+var numericDatePattern = regexp.MustCompile(`(?i)^(\d{1,4})[-/.](\d{1,2})[-/.](\d{1,4})` +
+	`(?:[t ]+\d{1,2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?: ?[ap]m)?(?:z|[+-]\d{2}:?\d{2})?)?$`)
+
+// namedMonthLayouts are the layouts tried for dates naming their month.
+var namedMonthLayouts = []string{
+	"2 Jan 2006", "2 January 2006", "2-Jan-2006", "2-Jan-06", "2 Jan 06",
+	"Jan 2 2006", "January 2 2006", "Jan 2, 2006", "January 2, 2006",
+	"Mon, 2 Jan 2006", "Monday, 2 January 2006", "Monday, January 2, 2006",
+}
+
+// validateDateOptions rejects date settings out of range.
+func validateDateOptions(req MatchRequest) error {
+	if req.DateWindow < 0 {
+		return fmt.Errorf("dateWindow must not be negative")
+	}
+	switch req.DateOrder {
+	case "", dateOrderDMY, dateOrderMDY:
+		return nil
+	}
+	return fmt.Errorf("unknown dateOrder '%s' (expected dmy or mdy)", req.DateOrder)
+}
+
+// dateColumn returns the score function for sheet2 column c, with the column's dates parsed
+// once up front rather than for every pair.
+func dateColumn(ix *matchIndex, c int, p scoreParams) scoreFunc {
+	days := make(map[string]int)
+	for _, keys := range ix.keys {
+		if c < len(keys) && keys[c] != "" {
+			if _, seen := days[keys[c]]; !seen {
+				if day, ok := parseDate(keys[c], p.monthFirst); ok {
+					days[keys[c]] = day
+				}
+			}
+		}
+	}
+
+	var last1 string
+	var day1 int
+	var ok1 bool
+	return func(key1, key2 string, p scoreParams) (int, float64, bool) {
+		if key1 != last1 {
+			last1 = key1
+			day1, ok1 = parseDate(key1, p.monthFirst)
+		}
+		day2, ok2 := days[key2]
+		if !ok1 || !ok2 {
+			return 0, 0, false
+		}
+		gap := day1 - day2
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap > p.dateWindow {
+			return 0, 0, false
+		}
+		return gap, 1 - float64(gap)/float64(p.dateWindow+1), true
+	}
+}
+
+// parseDate returns the day a value names, counted from the Unix epoch.
+func parseDate(v string, monthFirst bool) (int, bool) {
+	v = strings.Join(strings.Fields(v), " ")
+	if v == "" {
+		return 0, false
+	}
+	if t, ok := parseNumericDate(v, monthFirst); ok {
+		return int(t.Unix() / 86400), true
+	}
+	for _, layout := range namedMonthLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return int(t.Unix() / 86400), true
+		}
+	}
+	return 0, false
+}
+
+// parseNumericDate reads a date written in digits: three numbers, "yyyymmdd", or an Excel serial.
+func parseNumericDate(v string, monthFirst bool) (time.Time, bool) {
+	if m := numericDatePattern.FindStringSubmatch(v); m != nil {
+		a, _ := strconv.Atoi(m[1])
+		b, _ := strconv.Atoi(m[2])
+		c, _ := strconv.Atoi(m[3])
+		switch {
+		case len(m[1]) == 4:
+			return civilDate(a, b, c)
+		case len(m[3]) == 4 || len(m[3]) == 2:
+			year := c
+			if len(m[3]) == 2 {
+				year = twoDigitYear(c)
+			}
+			if monthFirst {
+				return civilDate(year, a, b)
+			}
+			return civilDate(year, b, a)
+		}
+		return time.Time{}, false
+	}
+
+	if len(v) == 8 && strings.Trim(v, "0123456789") == "" {
+		n, _ := strconv.Atoi(v)
+		if t, ok := civilDate(n/10000, n/100%100, n%100); ok {
+			return t, true
+		}
+	}
+	serial, err := strconv.ParseFloat(v, 64)
+	if err != nil || strings.ContainsAny(v, "eEinfINF") || serial < 1 || serial >= excelMaxSerial+1 {
+		return time.Time{}, false
+	}
+	day := int(serial)
+	if day < 61 {
+		day++
+	}
+	return excelEpoch.AddDate(0, 0, day), true
+}
+
+// civilDate returns the given date, rejecting days the month does not have.
+func civilDate(year, month, day int) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// twoDigitYear places a two-digit year as time.Parse does: 69-99 in the 1900s, 00-68 in the 2000s.
+func twoDigitYear(yy int) int {
+	if yy >= 69 {
+		return 1900 + yy
+	}
+	return 2000 + yy
+}
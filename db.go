@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// ---------------------------------------------------------------------
+// --- Database Import ---
+// ---------------------------------------------------------------------
+
+// /api/import/db runs a SELECT against a Postgres or MySQL database and stores the result set
+// as a sheet, so a spreadsheet can be reconciled against the table it was exported from. The
+// query runs in a read-only transaction under the remote fetch timeout, and at most dbMaxRows
+// rows are read.
+//
+// Databases are configured on the server with -db name=dsn and chosen by name. A request may
+// give its own DSN only under -db-allow-dsn, and then every parameter that would make the
+// server open a file or a local socket of the caller's choosing is refused.
+
+var (
+	dbMaxRows        = 1_000_000           // caps the rows read from a query result
+	dbSources        = map[string]string{} // -db name => DSN
+	dbAllowClientDSN = false               // -db-allow-dsn
+)
+
+// dbClientPGKeys are the connection string keys a client DSN may set for Postgres. The others,
+// such as sslkey, sslrootcert, passfile and service, name files on the server.
+var dbClientPGKeys = []string{
+	"host", "port", "dbname", "user", "password", "sslmode", "ssl", "sslsni",
+	"connect_timeout", "application_name", "target_session_attrs",
+}
+
+// addDBSource registers one -db name=dsn flag value.
+func addDBSource(spec string) error {
+	name, dsn, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.TrimSpace(dsn) == "" {
+		return fmt.Errorf("invalid database %q, expected name=dsn", spec)
+	}
+	dbSources[name] = dsn
+	return nil
+}
+
+// DBImportRequest names a database and the query whose result becomes the sheet. Database
+// names a -db source; DSN is a connection string of the request's own, accepted only under
+// -db-allow-dsn. Driver is "postgres" or "mysql"; when empty it is inferred from the DSN.
+// Sheet names the resulting sheet (default "Query").
+type DBImportRequest struct {
+	Database string `json:"database"`
+	Driver   string `json:"driver"`
+	DSN      string `json:"dsn"`
+	Query    string `json:"query"`
+	Sheet    string `json:"sheet"`
+	uploadOptions
+}
+
+// dbDriver returns the database/sql driver name for a request's driver and DSN.
+func dbDriver(driver, dsn string) (string, error) {
+	switch strings.ToLower(driver) {
+	case "postgres", "postgresql", "pgx":
+		return "pgx", nil
+	case "mysql", "mariadb":
+		return "mysql", nil
+	case "":
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") || strings.Contains(dsn, "host=") {
+			return "pgx", nil
+		}
+		return "mysql", nil
+	}
+	return "", fmt.Errorf("unsupported driver '%s': use postgres or mysql", driver)
+}
+
+// openClientDB opens a DSN given by a request, refusing the parameters that reach the server's
+// files: MySQL's allowAllFiles (LOAD DATA LOCAL INFILE) and Postgres keys outside
+// dbClientPGKeys, which are rejected before pgx reads any file they name. Unix socket hosts
+// are refused too, as the server's local database would trust the connection.
+func openClientDB(driver, dsn string) (*sql.DB, error) {
+	if driver == "mysql" {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.AllowAllFiles {
+			return nil, fmt.Errorf("dsn parameter 'allowAllFiles' is not allowed")
+		}
+		for key := range cfg.Params {
+			if strings.Contains(strings.ToLower(key), "infile") {
+				return nil, fmt.Errorf("dsn parameter '%s' is not allowed", key)
+			}
+		}
+		if cfg.Net == "unix" {
+			return nil, fmt.Errorf("dsn must not connect through a unix socket")
+		}
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+	}
+
+	cfg, err := pgx.ParseConfigWithOptions(dsn, pgx.ParseConfigOptions{
+		ParseConfigOptions: pgconn.ParseConfigOptions{ConnStringAllowedKeys: dbClientPGKeys},
+	})
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{cfg.Host}
+	for _, fb := range cfg.Fallbacks {
+		hosts = append(hosts, fb.Host)
+	}
+	for _, host := range hosts {
+		if strings.HasPrefix(host, "/") {
+			return nil, fmt.Errorf("dsn must not connect through a unix socket")
+		}
+	}
+	return stdlib.OpenDB(*cfg), nil
+}
+
+// isSelect reports whether a query is a single read statement, going by its first keyword.
+func isSelect(query string) bool {
+	words := strings.Fields(strings.TrimLeft(query, " \t\r\n("))
+	if len(words) == 0 {
+		return false
+	}
+	switch strings.ToUpper(words[0]) {
+	case "SELECT", "WITH", "TABLE", "VALUES":
+		return true
+	}
+	return false
+}
+
+// queryRows runs a query and returns its result with the column names as the first row,
+// refusing a result over the upload caps for the sheet it is to become.
+func queryRows(ctx context.Context, db *sql.DB, query, sheet string) ([][]string, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rs, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	columns, err := rs.Columns()
+	if err != nil {
+		return nil, err
+	}
+	rows := [][]string{columns}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rs.Next() {
+		if len(rows) > dbMaxRows {
+			return nil, fmt.Errorf("query returned more than %d rows", dbMaxRows)
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = dbCellValue(v)
+		}
+		rows = append(rows, row)
+		if err := checkRowLimits(sheet, sheetLayout{}, len(rows), row); err != nil {
+			return nil, err
+		}
+	}
+	return rows, rs.Err()
+}
+
+// dbCellValue turns a scanned column value into cell text: NULL is a blank cell and
+// timestamps are printed as dates when they have no time of day.
+func dbCellValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		if h, m, s := v.Clock(); h == 0 && m == 0 && s == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05.999999999")
+	}
+	return fmt.Sprint(v)
+}
+
+// dbImportHandler handles POST /api/import/db, storing a query result like an upload.
+func dbImportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling database import request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DBImportRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if (req.Database == "") == (req.DSN == "") || strings.TrimSpace(req.Query) == "" {
+		http.Error(w, "A query and one of database or dsn are required.", http.StatusBadRequest)
+		return
+	}
+	if !isSelect(req.Query) {
+		http.Error(w, "Only SELECT queries are allowed.", http.StatusBadRequest)
+		return
+	}
+	dsn, trusted := req.DSN, false
+	if req.Database != "" {
+		if dsn, trusted = dbSources[req.Database]; !trusted {
+			http.Error(w, fmt.Sprintf("Database '%s' is not configured.", req.Database), http.StatusNotFound)
+			return
+		}
+	} else if !dbAllowClientDSN {
+		http.Error(w, "Connection strings are not accepted; choose a configured database by name.", http.StatusForbidden)
+		return
+	}
+	driver, err := dbDriver(req.Driver, dsn)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var db *sql.DB
+	if trusted {
+		db, err = sql.Open(driver, dsn)
+	} else {
+		db, err = openClientDB(driver, dsn)
+	}
+	if err != nil {
+		log.Printf("ERROR: Refusing database connection string: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), remoteTimeout)
+	defer cancel()
+	sheet := req.Sheet
+	if sheet == "" {
+		sheet = "Query"
+	}
+	rows, err := queryRows(ctx, db, req.Query, sheet)
+	if isLimitError(err) {
+		log.Printf("ERROR: Refusing query result: %v", err)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Database query failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Printf("INFO: Query returned %d row(s) of %d column(s).", len(rows)-1, len(rows[0]))
+
+	data, _ := json.Marshal(rows) // the content hash, so an unchanged result is recognized
+	req.Format, req.Lazy, req.FixedWidth, req.XMLRecord, req.XMLFields = "", false, "", "", ""
+	req.HeaderRow, req.HeaderRows, req.SkipRows = 0, 0, 0 // the column names are the header
+	storeUpload(w, r, data, req.uploadOptions, func(_ []byte, opts uploadOptions) (parsedUpload, error) {
+		up := parsedUpload{
+			sheets:      make(map[string]SheetData, 1),
+			sheetErrors: make([]SheetError, 0),
+			dropped:     make([]string, 0),
+		}
+		up.addRows(sheet, rows, opts)
+		return up, nil
+	}, http.StatusBadRequest)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOpenClientDB(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		dsn     string
+		wantErr bool
+	}{
+		{"a plain mysql dsn", "mysql", "user:pw@tcp(db.example.com:3306)/sales", false},
+		{"mysql allowAllFiles", "mysql", "user:pw@tcp(db.example.com:3306)/sales?allowAllFiles=true", true},
+		{"a mysql unix socket", "mysql", "user:pw@unix(/var/run/mysqld/mysqld.sock)/sales", true},
+		{"a plain postgres url", "pgx", "postgres://user:pw@db.example.com/sales?sslmode=require", false},
+		{"postgres sslkey", "pgx", "postgres://user@db.example.com/sales?sslkey=/etc/shadow", true},
+		{"postgres sslrootcert", "pgx", "host=db.example.com dbname=sales sslrootcert=/etc/passwd", true},
+		{"postgres passfile", "pgx", "host=db.example.com dbname=sales passfile=/root/.pgpass", true},
+		{"postgres service", "pgx", "host=db.example.com service=prod", true},
+		{"a postgres unix socket", "pgx", "host=/var/run/postgresql dbname=sales", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := openClientDB(tt.driver, tt.dsn)
+			if err == nil {
+				db.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDBImportSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"client dsns are refused by default", `{"dsn": "postgres://db.example.com/sales", "query": "SELECT 1"}`, http.StatusForbidden},
+		{"an unknown database name", `{"database": "sales", "query": "SELECT 1"}`, http.StatusNotFound},
+		{"database and dsn together", `{"database": "sales", "dsn": "postgres://db.example.com/sales", "query": "SELECT 1"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveJSON(dbImportHandler, "POST", "/api/import/db", tt.body); w.Code != tt.wantStatus {
+				t.Fatalf("status %d %q, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------------------------------------------------------------------
+// --- Delimited Text Uploads ---
+// ---------------------------------------------------------------------
+
+// delimiterCandidates are the separators tried when sniffing a delimited file, in order of
+// preference when they score the same.
+var delimiterCandidates = []rune{',', ';', '\t', '|'}
+
+// sniffSampleLines is how many non-blank lines sniffDelimiter looks at.
+const sniffSampleLines = 10
+
+// defaultDelimiter is the separator implied by an upload's format, or 0 when it has to be sniffed.
+func defaultDelimiter(opts uploadOptions) rune {
+	if uploadFormat(opts) == formatTSV {
+		return '\t'
+	}
+	return 0
+}
+
+// namedDelimiters are the spellings accepted for separators that are awkward to put in a form field.
+var namedDelimiters = map[string]rune{
+	"comma": ',', "semicolon": ';', "tab": '\t', `\t`: '\t', "pipe": '|', "space": ' ',
+}
+
+// parseDelimiter validates an explicit delimiter override: a single character or one of
+// namedDelimiters. "" means auto-detect and yields 0.
+func parseDelimiter(s string) (rune, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if r, ok := namedDelimiters[strings.ToLower(s)]; ok {
+		return r, nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid delimiter '%s': must be a single character other than a quote or newline", s)
+	}
+	return r, nil
+}
+
+// sniffDelimiter picks the candidate separator that splits the sampled lines most consistently:
+// the one giving the same non-zero field count on the most lines, then the most fields.
+// Separators inside double quotes are not counted. It falls back to a comma.
+func sniffDelimiter(data []byte) rune {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == sniffSampleLines {
+			break
+		}
+	}
+
+	best, bestLines, bestCount := ',', 0, 0
+	for _, d := range delimiterCandidates {
+		freq := make(map[int]int)
+		for _, line := range lines {
+			freq[countUnquoted(line, d)]++
+		}
+		modeCount, modeLines := 0, 0
+		for count, n := range freq {
+			if count > 0 && (n > modeLines || (n == modeLines && count > modeCount)) {
+				modeCount, modeLines = count, n
+			}
+		}
+		if modeLines > bestLines || (modeLines == bestLines && modeCount > bestCount) {
+			best, bestLines, bestCount = d, modeLines, modeCount
+		}
+	}
+	return best
+}
+
+// countUnquoted counts occurrences of d in line outside double-quoted sections.
+func countUnquoted(line string, d rune) int {
+	n, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// parseDelimitedUpload reads a delimited text file as a single sheet named after the file.
+// Like workbook sheets, the first record is the header row and trailing blank cells are dropped.
+// Blank lines are kept as empty rows, as a spreadsheet would show them, so headerRow counts
+// them too.
+func parseDelimitedUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	delim, err := parseDelimiter(opts.Delimiter)
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if delim == 0 {
+		delim = defaultDelimiter(opts)
+	}
+	if delim == 0 {
+		delim = sniffDelimiter(data)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(opts.Filename), filepath.Ext(opts.Filename))
+	if name == "" || name == "." {
+		name = "Sheet1"
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = delim
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	var records [][]string
+	lastLine := 0 // line the previous record ended on
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return parsedUpload{}, err
+		}
+		line, _ := cr.FieldPos(0)
+		for ; lastLine < line-1; lastLine++ {
+			records = append(records, nil)
+		}
+		last, _ := cr.FieldPos(len(rec) - 1)
+		lastLine = last + strings.Count(rec[len(rec)-1], "\n")
+
+		end := len(rec)
+		for end > 0 && rec[end-1] == "" {
+			end--
+		}
+		records = append(records, rec[:end])
+		if err := checkRowLimits(name, opts.layout(), len(records), rec[:end]); err != nil {
+			return parsedUpload{}, err
+		}
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, 1),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+		delimiter:   string(delim),
+	}
+	up.addRows(name, records, opts)
+	return up, nil
+}
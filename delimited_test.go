@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDelimiterDetection(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		data          string
+		delimiter     string // explicit override
+		wantDelimiter string
+		wantHeaders   []string
+	}{
+		{"comma", "a.csv", "id,name\n1,Ann\n2,Bob\n", "", ",", []string{"id", "name"}},
+		{"semicolon in a .csv", "a.csv", "id;name;amount\n1;Ann;1,50\n2;Bob;2,75\n", "", ";", []string{"id", "name", "amount"}},
+		{"pipe", "a.txt", "id|name\n1|Ann\n", "", "|", []string{"id", "name"}},
+		{"tab by extension", "a.tsv", "id\tname\n1\tAnn\n", "", "\t", []string{"id", "name"}},
+		{"quoted delimiters do not count", "a.csv", "id;name\n1;\"Smith, Ann\"\n2;\"Jones, Bob\"\n", "", ";", []string{"id", "name"}},
+		{"an explicit delimiter wins", "a.csv", "id;name,x\n1;Ann,y\n", "comma", ",", []string{"id;name", "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, err := parseDelimitedUpload([]byte(tt.data), uploadOptions{Filename: tt.file, Delimiter: tt.delimiter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if up.delimiter != tt.wantDelimiter {
+				t.Errorf("delimiter %q, want %q", up.delimiter, tt.wantDelimiter)
+			}
+			if headers := up.sheets["a"].Headers; !reflect.DeepEqual(headers, tt.wantHeaders) {
+				t.Errorf("headers %q, want %q", headers, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func TestUploadReportsDelimiter(t *testing.T) {
+	const dataset = "delimiter-test"
+	defer func() {
+		storeMutex.Lock()
+		removeDatasetLocked(dataset)
+		storeMutex.Unlock()
+	}()
+	res, status, err := ingestUpload([]byte("id;name\n1;Ann\n"), uploadOptions{Dataset: dataset, Filename: "a.csv"}, parseDelimitedUpload, http.StatusBadRequest)
+	if err != nil {
+		t.Fatalf("%d %v", status, err)
+	}
+	if res.Delimiter != ";" {
+		t.Errorf("response delimiter %q, want \";\"", res.Delimiter)
+	}
+}
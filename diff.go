@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// DiffRequest compares two versions of the same table keyed by an ID column.
+type DiffRequest struct {
+	SheetA     string `json:"sheetA"`
+	SheetB     string `json:"sheetB"`
+	IDColumn   string `json:"idColumn"`
+	IDColumnB  string `json:"idColumnB"` // optional, defaults to IDColumn
+	IgnoreCase bool   `json:"ignoreCase"`
+}
+
+type DiffRow struct {
+	ID     string   `json:"id"`
+	Row    int      `json:"row"`
+	Values []string `json:"values"`
+}
+
+type CellChange struct {
+	Column string `json:"column"`
+	ValueA string `json:"valueA"`
+	ValueB string `json:"valueB"`
+}
+
+type ModifiedRow struct {
+	ID      string       `json:"id"`
+	RowA    int          `json:"rowA"`
+	RowB    int          `json:"rowB"`
+	Changes []CellChange `json:"changes"`
+}
+
+type DiffResult struct {
+	OnlyInA        []DiffRow     `json:"onlyInA"`
+	OnlyInB        []DiffRow     `json:"onlyInB"`
+	Modified       []ModifiedRow `json:"modified"`
+	Unchanged      int           `json:"unchanged"`
+	RemovedColumns []string      `json:"removedColumns"` // headers present only in sheet A
+	AddedColumns   []string      `json:"addedColumns"`   // headers present only in sheet B
+}
+
+// diffSheets joins both sheets on their ID columns and classifies every row as
+// only-in-A, only-in-B, modified or unchanged. Columns are aligned by header name.
+// Duplicate IDs are paired in order of appearance; leftovers count as added/removed rows.
+func diffSheets(a, b SheetData, idColA, idColB int, ignoreCase bool) DiffResult {
+	result := DiffResult{
+		OnlyInA:        make([]DiffRow, 0),
+		OnlyInB:        make([]DiffRow, 0),
+		Modified:       make([]ModifiedRow, 0),
+		RemovedColumns: make([]string, 0),
+		AddedColumns:   make([]string, 0),
+	}
+
+	// Align columns by header.
+	colMap := make([][2]int, 0, len(a.Headers))
+	inA := make(map[int]bool)
+	for ca, h := range a.Headers {
+		if cb := findColumn(b.Headers, h); cb >= 0 {
+			colMap = append(colMap, [2]int{ca, cb})
+			inA[cb] = true
+		} else {
+			result.RemovedColumns = append(result.RemovedColumns, h)
+		}
+	}
+	for cb, h := range b.Headers {
+		if !inA[cb] {
+			result.AddedColumns = append(result.AddedColumns, h)
+		}
+	}
+
+	sameCell := func(va, vb string) bool {
+		if ignoreCase {
+			return standardKey(va) == standardKey(vb)
+		}
+		return strings.TrimSpace(va) == strings.TrimSpace(vb)
+	}
+
+	// Key map over sheet B rows.
+	keyMapB := make(map[string][]int)
+	for rb, row := range b.Rows {
+		if key := standardKey(cellValue(row, idColB)); key != "" {
+			keyMapB[key] = append(keyMapB[key], rb)
+		}
+	}
+	pairedB := make([]bool, len(b.Rows))
+
+	for ra, rowA := range a.Rows {
+		id := cellValue(rowA, idColA)
+		candidates := keyMapB[standardKey(id)]
+		if standardKey(id) == "" || len(candidates) == 0 {
+			result.OnlyInA = append(result.OnlyInA, DiffRow{ID: id, Row: a.rowNumber(ra), Values: rowA})
+			continue
+		}
+		rb := candidates[0]
+		keyMapB[standardKey(id)] = candidates[1:]
+		pairedB[rb] = true
+		rowB := b.Rows[rb]
+
+		changes := make([]CellChange, 0)
+		for _, cols := range colMap {
+			va, vb := cellValue(rowA, cols[0]), cellValue(rowB, cols[1])
+			if !sameCell(va, vb) {
+				changes = append(changes, CellChange{Column: a.Headers[cols[0]], ValueA: va, ValueB: vb})
+			}
+		}
+		if len(changes) == 0 {
+			result.Unchanged++
+			continue
+		}
+		result.Modified = append(result.Modified, ModifiedRow{ID: id, RowA: a.rowNumber(ra), RowB: b.rowNumber(rb), Changes: changes})
+	}
+
+	for rb, rowB := range b.Rows {
+		if !pairedB[rb] {
+			result.OnlyInB = append(result.OnlyInB, DiffRow{ID: cellValue(rowB, idColB), Row: b.rowNumber(rb), Values: rowB})
+		}
+	}
+	return result
+}
+
+// diffHandler returns a row-level diff between two sheets keyed by an ID column.
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling sheet diff request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DiffRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.IDColumn == "" {
+		http.Error(w, "idColumn is required.", http.StatusBadRequest)
+		return
+	}
+	if req.IDColumnB == "" {
+		req.IDColumnB = req.IDColumn
+	}
+
+	sheetA, sheetB, ok := lookupSheetPair(w, r, req.SheetA, req.SheetB)
+	if !ok {
+		return
+	}
+
+	idColA := findColumn(sheetA.Headers, req.IDColumn)
+	idColB := findColumn(sheetB.Headers, req.IDColumnB)
+	if idColA < 0 || idColB < 0 {
+		http.Error(w, fmt.Sprintf("ID column not found (sheetA: '%s', sheetB: '%s').", req.IDColumn, req.IDColumnB), http.StatusBadRequest)
+		return
+	}
+
+	result := diffSheets(sheetA, sheetB, idColA, idColB, req.IgnoreCase)
+	log.Printf("INFO: Diff complete. %d only in A, %d only in B, %d modified, %d unchanged.",
+		len(result.OnlyInA), len(result.OnlyInB), len(result.Modified), result.Unchanged)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSheets(t *testing.T) {
+	v1 := SheetData{Headers: []string{"ID", "Name", "Price"}, Rows: [][]string{
+		{"1", "Apple", "1.00"}, {"2", "Pear", "2.00"}, {"3", "Plum", "3.00"}, {"4", "Fig", "4.00"},
+	}}
+	v2 := SheetData{Headers: []string{"ID", "Name", "Price", "Stock"}, Rows: [][]string{
+		{"1", "Apple", "1.00", "5"}, {"3", "plum", "3.50", "0"}, {"5", "Kiwi", "5.00", "9"}, {"4", "Fig", "4.00", "1"},
+	}}
+
+	tests := []struct {
+		name       string
+		ignoreCase bool
+		want       DiffResult
+	}{
+		{"adds, deletes and edits", false, DiffResult{
+			OnlyInA: []DiffRow{{ID: "2", Row: 3, Values: []string{"2", "Pear", "2.00"}}},
+			OnlyInB: []DiffRow{{ID: "5", Row: 4, Values: []string{"5", "Kiwi", "5.00", "9"}}},
+			Modified: []ModifiedRow{{ID: "3", RowA: 4, RowB: 3, Changes: []CellChange{
+				{Column: "Name", ValueA: "Plum", ValueB: "plum"}, {Column: "Price", ValueA: "3.00", ValueB: "3.50"},
+			}}},
+			Unchanged: 2, RemovedColumns: []string{}, AddedColumns: []string{"Stock"},
+		}},
+		{"ignoring case drops case-only changes", true, DiffResult{
+			OnlyInA: []DiffRow{{ID: "2", Row: 3, Values: []string{"2", "Pear", "2.00"}}},
+			OnlyInB: []DiffRow{{ID: "5", Row: 4, Values: []string{"5", "Kiwi", "5.00", "9"}}},
+			Modified: []ModifiedRow{{ID: "3", RowA: 4, RowB: 3, Changes: []CellChange{
+				{Column: "Price", ValueA: "3.00", ValueB: "3.50"},
+			}}},
+			Unchanged: 2, RemovedColumns: []string{}, AddedColumns: []string{"Stock"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffSheets(v1, v2, 0, 0, tt.ignoreCase)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
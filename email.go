@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Email Matching ---
+// ---------------------------------------------------------------------
+
+// The "email" algorithm matches values on the mailbox they name, compared trimmed and in lower
+// case, with a "mailto:" prefix and surrounding angle brackets dropped, so " John@Example.COM"
+// matches "<john@example.com>". With MatchRequest.EmailIgnoreTags, plus-addressing is ignored
+// ("john+news@example.com" is john@example.com), and with EmailIgnoreDots, so are dots in the
+// local part of Gmail addresses, which Gmail ignores too, googlemail.com counting as
+// gmail.com. Values that are not addresses never match, and the threshold plays no part.
+
+// gmailDomains are the domains whose local parts ignore dots, with the one they stand for.
+var gmailDomains = map[string]string{"gmail.com": "gmail.com", "googlemail.com": "gmail.com"}
+
+// emailColumn returns the score function for sheet2 column c.
+func emailColumn(ix *matchIndex, c int, p scoreParams) scoreFunc {
+	return canonicalColumn(ix, c, func(v string) string { return canonicalEmail(v, p.emailIgnoreTags, p.emailIgnoreDots) })
+}
+
+// canonicalEmail returns the canonical form of the address in v, or "" when v is not one.
+func canonicalEmail(v string, ignoreTags, ignoreDots bool) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	v = strings.TrimPrefix(v, "mailto:")
+	if strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">") {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
+	local, domain, ok := strings.Cut(v, "@")
+	domain = strings.TrimSuffix(domain, ".")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") || strings.ContainsAny(v, " \t,;<>") {
+		return ""
+	}
+	if ignoreTags {
+		if tagged, _, found := strings.Cut(local, "+"); found && tagged != "" {
+			local = tagged
+		}
+	}
+	if gmail, ok := gmailDomains[domain]; ok && ignoreDots {
+		local, domain = strings.ReplaceAll(local, ".", ""), gmail
+	}
+	return local + "@" + domain
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+)
+
+// TruthPair is a known-correct pairing of sheet1 and sheet2 rows (1-based Excel row numbers).
+type TruthPair struct {
+	Row1 int `json:"row1"`
+	Row2 int `json:"row2"`
+}
+
+// EvaluateRequest runs a match configuration and scores its output against ground truth.
+type EvaluateRequest struct {
+	MatchRequest
+	Truth []TruthPair `json:"truth"`
+}
+
+type QualityMetrics struct {
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	FalseNegatives int     `json:"falseNegatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+type PairQuality struct {
+	Header1 string `json:"header1"`
+	Header2 string `json:"header2"`
+	QualityMetrics
+}
+
+type EvaluateResult struct {
+	Overall     QualityMetrics `json:"overall"`
+	ColumnPairs []PairQuality  `json:"columnPairs"`
+}
+
+// truthSet converts the supplied pairs into a set, ignoring duplicates.
+func truthSet(truth []TruthPair) map[[2]int]struct{} {
+	set := make(map[[2]int]struct{}, len(truth))
+	for _, t := range truth {
+		set[[2]int{t.Row1, t.Row2}] = struct{}{}
+	}
+	return set
+}
+
+// scorePairs compares a set of produced row pairs against the truth set.
+func scorePairs(produced, truth map[[2]int]struct{}) QualityMetrics {
+	var m QualityMetrics
+	for p := range produced {
+		if _, ok := truth[p]; ok {
+			m.TruePositives++
+		} else {
+			m.FalsePositives++
+		}
+	}
+	m.FalseNegatives = len(truth) - m.TruePositives
+
+	if len(produced) > 0 {
+		m.Precision = float64(m.TruePositives) / float64(len(produced))
+	}
+	if len(truth) > 0 {
+		m.Recall = float64(m.TruePositives) / float64(len(truth))
+	}
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+	m.Precision = math.Round(m.Precision*10000) / 10000
+	m.Recall = math.Round(m.Recall*10000) / 10000
+	m.F1 = math.Round(m.F1*10000) / 10000
+	return m
+}
+
+// evaluateMatches scores each column pair and the union of all groups against the truth.
+func evaluateMatches(groups []MatchGroup, truth []TruthPair) EvaluateResult {
+	want := truthSet(truth)
+	all := make(map[[2]int]struct{})
+	result := EvaluateResult{ColumnPairs: make([]PairQuality, 0, len(groups))}
+
+	for _, g := range groups {
+		produced := make(map[[2]int]struct{}, len(g.Matches))
+		for _, m := range g.Matches {
+			pair := [2]int{m.OriginalRow1, m.OriginalRow2}
+			produced[pair] = struct{}{}
+			all[pair] = struct{}{}
+		}
+		result.ColumnPairs = append(result.ColumnPairs, PairQuality{
+			Header1:        g.Header1,
+			Header2:        g.Header2,
+			QualityMetrics: scorePairs(produced, want),
+		})
+	}
+	result.Overall = scorePairs(all, want)
+	return result
+}
+
+// evaluateHandler reports precision, recall and F1 of a match run against supplied ground truth.
+func evaluateHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling evaluation request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EvaluateRequest
+	req.Normalize = profileDefaults(r)
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Truth) == 0 {
+		http.Error(w, "truth must contain at least one row pair.", http.StatusBadRequest)
+		return
+	}
+
+	sheet1Data, sheet2Data, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
+		return
+	}
+
+	ctx, done, ok := startJob(w, r, req.JobID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	groups, _, err := findMatches(ctx, req.MatchRequest, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Evaluation request failed: %v", err)
+		http.Error(w, err.Error(), matchErrorStatus(err))
+		return
+	}
+
+	result := evaluateMatches(groups, req.Truth)
+	log.Printf("INFO: Evaluation complete. Precision %.4f, recall %.4f, F1 %.4f over %d truth pairs.",
+		result.Overall.Precision, result.Overall.Recall, result.Overall.F1, len(req.Truth))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ---------------------------------------------------------------------
+// --- Threshold Sweep ---
+// ---------------------------------------------------------------------
+
+// maxSweepSteps bounds how many thresholds a single sweep may evaluate.
+const maxSweepSteps = 25
+
+// SweepRequest evaluates a fuzzy configuration across a range of thresholds.
+// Thresholds use the same semantics as FuzzyThreshold (maximum % of differing characters).
+type SweepRequest struct {
+	EvaluateRequest
+	From int `json:"from"` // default 5
+	To   int `json:"to"`   // default 50
+	Step int `json:"step"` // default 5
+}
+
+type SweepPoint struct {
+	Threshold int `json:"threshold"`
+	QualityMetrics
+}
+
+type SweepResult struct {
+	Points        []SweepPoint `json:"points"`
+	BestThreshold int          `json:"bestThreshold"`
+	BestF1        float64      `json:"bestF1"`
+}
+
+// sweepThresholds runs the match once per threshold and picks the one with the highest
+// overall F1 (the lowest threshold wins ties, as the stricter setting).
+func sweepThresholds(ctx context.Context, req SweepRequest, sheet1Data, sheet2Data SheetData) (SweepResult, error) {
+	result := SweepResult{Points: make([]SweepPoint, 0), BestThreshold: -1}
+	matchReq := req.MatchRequest
+	matchReq.UseFuzzy = true
+
+	for t := req.From; t <= req.To; t += req.Step {
+		matchReq.FuzzyThreshold = t
+		groups, _, err := findMatches(ctx, matchReq, sheet1Data, sheet2Data)
+		if err != nil {
+			return SweepResult{}, err
+		}
+		metrics := evaluateMatches(groups, req.Truth).Overall
+		result.Points = append(result.Points, SweepPoint{Threshold: t, QualityMetrics: metrics})
+		if result.BestThreshold < 0 || metrics.F1 > result.BestF1 {
+			result.BestThreshold, result.BestF1 = t, metrics.F1
+		}
+	}
+	return result, nil
+}
+
+// sweepHandler reports precision/recall/F1 for each threshold in the requested range.
+func sweepHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling threshold sweep request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := SweepRequest{From: 5, To: 50, Step: 5}
+	req.Normalize = profileDefaults(r)
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Truth) == 0 {
+		http.Error(w, "truth must contain at least one row pair.", http.StatusBadRequest)
+		return
+	}
+	if req.Step <= 0 || req.From < 0 || req.To < req.From {
+		http.Error(w, "Invalid sweep range: need 0 <= from <= to and step > 0.", http.StatusBadRequest)
+		return
+	}
+	if steps := (req.To-req.From)/req.Step + 1; steps > maxSweepSteps {
+		http.Error(w, fmt.Sprintf("Sweep of %d thresholds exceeds the limit of %d; widen the step.", steps, maxSweepSteps), http.StatusBadRequest)
+		return
+	}
+
+	sheet1Data, sheet2Data, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
+		return
+	}
+
+	ctx, done, ok := startJob(w, r, req.JobID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	result, err := sweepThresholds(ctx, req, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Sweep request failed: %v", err)
+		http.Error(w, err.Error(), matchErrorStatus(err))
+		return
+	}
+	log.Printf("INFO: Sweep complete. %d thresholds evaluated, best %d (F1 %.4f).", len(result.Points), result.BestThreshold, result.BestF1)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
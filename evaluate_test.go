@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pairGroup is a group of matches between the given row pairs.
+func pairGroup(header string, pairs ...[2]int) MatchGroup {
+	g := MatchGroup{Header1: header, Header2: header}
+	for _, p := range pairs {
+		g.Matches = append(g.Matches, MatchResult{OriginalRow1: p[0], OriginalRow2: p[1]})
+	}
+	return g
+}
+
+func TestEvaluateMatches(t *testing.T) {
+	truth := []TruthPair{{2, 2}, {3, 3}, {4, 4}, {5, 5}}
+	tests := []struct {
+		name      string
+		groups    []MatchGroup
+		truth     []TruthPair
+		wantPairs []QualityMetrics
+		want      QualityMetrics
+	}{
+		{
+			name:   "per column pair and overall",
+			groups: []MatchGroup{pairGroup("Name", [2]int{2, 2}, [2]int{3, 3}, [2]int{4, 9}), pairGroup("Email", [2]int{2, 2}, [2]int{5, 5})},
+			truth:  truth,
+			wantPairs: []QualityMetrics{
+				{TruePositives: 2, FalsePositives: 1, FalseNegatives: 2, Precision: 0.6667, Recall: 0.5, F1: 0.5714},
+				{TruePositives: 2, FalsePositives: 0, FalseNegatives: 2, Precision: 1, Recall: 0.5, F1: 0.6667},
+			},
+			want: QualityMetrics{TruePositives: 3, FalsePositives: 1, FalseNegatives: 1, Precision: 0.75, Recall: 0.75, F1: 0.75},
+		},
+		{
+			name:      "duplicate truth pairs count once",
+			groups:    []MatchGroup{pairGroup("Name", [2]int{2, 2})},
+			truth:     []TruthPair{{2, 2}, {2, 2}, {3, 3}},
+			wantPairs: []QualityMetrics{{TruePositives: 1, FalseNegatives: 1, Precision: 1, Recall: 0.5, F1: 0.6667}},
+			want:      QualityMetrics{TruePositives: 1, FalseNegatives: 1, Precision: 1, Recall: 0.5, F1: 0.6667},
+		},
+		{
+			name:      "no matches scores zero",
+			truth:     truth,
+			wantPairs: []QualityMetrics{},
+			want:      QualityMetrics{FalseNegatives: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluateMatches(tt.groups, tt.truth)
+			pairs := make([]QualityMetrics, len(got.ColumnPairs))
+			for i, p := range got.ColumnPairs {
+				pairs[i] = p.QualityMetrics
+			}
+			if !reflect.DeepEqual(pairs, tt.wantPairs) {
+				t.Errorf("column pairs %+v, want %+v", pairs, tt.wantPairs)
+			}
+			if got.Overall != tt.want {
+				t.Errorf("overall %+v, want %+v", got.Overall, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepThresholds(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathan"}, {"Kitten"}}}
+	sheet2 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathon"}, {"Sitten"}, {"Mitts"}}}
+	truth := []TruthPair{{2, 2}, {3, 3}}
+	tests := []struct {
+		name           string
+		from, to, step int
+		wantThresholds []int
+		wantBest       int
+		wantBestF1     float64
+	}{
+		{"the lowest threshold of the best F1 wins", 0, 50, 10, []int{0, 10, 20, 30, 40, 50}, 20, 1},
+		{"a range above the best finds its best", 30, 50, 10, []int{30, 40, 50}, 30, 1},
+		{"a loose threshold admits a false match", 50, 50, 5, []int{50}, 50, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := SweepRequest{From: tt.from, To: tt.to, Step: tt.step}
+			req.Sheet1, req.Sheet2, req.Truth = "A", "B", truth
+			got, err := sweepThresholds(context.Background(), req, sheet1, sheet2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thresholds := make([]int, len(got.Points))
+			for i, p := range got.Points {
+				thresholds[i] = p.Threshold
+				if p.F1 > got.BestF1 {
+					t.Errorf("threshold %d has F1 %v, above the best %v", p.Threshold, p.F1, got.BestF1)
+				}
+			}
+			if !reflect.DeepEqual(thresholds, tt.wantThresholds) {
+				t.Errorf("thresholds %v, want %v", thresholds, tt.wantThresholds)
+			}
+			if got.BestThreshold != tt.wantBest || got.BestF1 != tt.wantBestF1 {
+				t.Errorf("best %d (F1 %v), want %d (F1 %v)", got.BestThreshold, got.BestF1, tt.wantBest, tt.wantBestF1)
+			}
+		})
+	}
+}
+
+func TestSweepHandlerRange(t *testing.T) {
+	tests := []struct {
+		name           string
+		from, to, step int
+		wantMsg        string
+	}{
+		{"more thresholds than the cap", 0, 100, 1, "exceeds the limit of 25"},
+		{"a range that runs backwards", 50, 10, 5, "Invalid sweep range"},
+		{"a zero step", 10, 50, 0, "Invalid sweep range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]interface{}{"sheet1": "A", "sheet2": "B", "truth": []TruthPair{{2, 2}}, "from": tt.from, "to": tt.to, "step": tt.step}
+			w := serveJSON(sweepHandler, "POST", "/api/sweep", body)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantMsg) {
+				t.Fatalf("got %d %q, want 400 with %q", w.Code, w.Body, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ExceptionsRequest is a MatchRequest plus the options of a reconciliation exceptions report:
+// everything that needs a human look after matching.
+type ExceptionsRequest struct {
+	MatchRequest
+	Format        string  `json:"format"`        // "xlsx" (default) or "csv"
+	MinSimilarity float64 `json:"minSimilarity"` // percentage; matches scoring below it are listed as low confidence (default 100)
+}
+
+// lowConfidenceMatch is a match scoring under the report's MinSimilarity.
+type lowConfidenceMatch struct {
+	Header1, Header2 string
+	MatchResult
+}
+
+// exceptionReport holds the three categories of the exceptions report.
+type exceptionReport struct {
+	unmatched1, unmatched2 []int // 1-based Excel row numbers with no match at all
+	lowConfidence          []lowConfidenceMatch
+}
+
+// findExceptions lists the rows of each sheet that appear in no match (blank rows are skipped)
+// and the matches whose similarity is below minSimilarity percent.
+func findExceptions(groups []MatchGroup, sheet1Data, sheet2Data SheetData, minSimilarity float64) exceptionReport {
+	var report exceptionReport
+	for _, g := range groups {
+		for _, m := range g.Matches {
+			if m.score*100 < minSimilarity {
+				report.lowConfidence = append(report.lowConfidence, lowConfidenceMatch{g.Header1, g.Header2, m})
+			}
+		}
+	}
+	matched1, matched2 := matchedRows(groups)
+	report.unmatched1 = unmatchedRows(sheet1Data, matched1)
+	report.unmatched2 = unmatchedRows(sheet2Data, matched2)
+	return report
+}
+
+// matchedRows collects the Excel row numbers of each sheet that appear in any match.
+func matchedRows(groups []MatchGroup) (matched1, matched2 map[int]bool) {
+	matched1, matched2 = make(map[int]bool), make(map[int]bool)
+	for _, g := range groups {
+		for _, m := range g.Matches {
+			matched1[m.OriginalRow1] = true
+			matched2[m.OriginalRow2] = true
+		}
+	}
+	return matched1, matched2
+}
+
+func unmatchedRows(data SheetData, matched map[int]bool) []int {
+	rows := make([]int, 0)
+	for i, row := range data.Rows {
+		if excelRow := data.rowNumber(i); !matched[excelRow] && !isBlankRow(row) {
+			rows = append(rows, excelRow)
+		}
+	}
+	return rows
+}
+
+// lowConfidenceHeader is the column layout of the low confidence section.
+var lowConfidenceHeader = []string{"Header1", "Header2", "OriginalRow1", "Val1", "OriginalRow2", "Val2", "Similarity"}
+
+func (m lowConfidenceMatch) record() []string {
+	return []string{
+		m.Header1, m.Header2,
+		strconv.Itoa(m.OriginalRow1), m.Val1,
+		strconv.Itoa(m.OriginalRow2), m.Val2,
+		strconv.FormatFloat(formatSimilarity(similarityPercentage, 0, m.score), 'f', -1, 64),
+	}
+}
+
+// unmatchedRecord is an unmatched source row prefixed with its Excel row number.
+func unmatchedRecord(data SheetData, excelRow int) []string {
+	return append([]string{strconv.Itoa(excelRow)}, sourceRow(data, excelRow)...)
+}
+
+// buildExceptionsWorkbook writes one worksheet per exception category.
+func buildExceptionsWorkbook(req ExceptionsRequest, report exceptionReport, sheet1Data, sheet2Data SheetData) (*excelize.File, error) {
+	b := newWorkbookBuilder()
+	sections := []struct {
+		name    string
+		header  []string
+		records [][]string
+	}{
+		{"Unmatched in " + req.Sheet1, append([]string{"OriginalRow"}, sheet1Data.Headers...), nil},
+		{"Unmatched in " + req.Sheet2, append([]string{"OriginalRow"}, sheet2Data.Headers...), nil},
+		{"Low confidence", lowConfidenceHeader, nil},
+	}
+	for _, row := range report.unmatched1 {
+		sections[0].records = append(sections[0].records, unmatchedRecord(sheet1Data, row))
+	}
+	for _, row := range report.unmatched2 {
+		sections[1].records = append(sections[1].records, unmatchedRecord(sheet2Data, row))
+	}
+	for _, m := range report.lowConfidence {
+		sections[2].records = append(sections[2].records, m.record())
+	}
+
+	for _, s := range sections {
+		sheet := b.addSheet(s.name)
+		for i, record := range append([][]string{s.header}, s.records...) {
+			vals := make([]interface{}, len(record))
+			for j, v := range record {
+				vals[j] = v
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			if err := b.f.SetSheetRow(sheet, cell, &vals); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.f, nil
+}
+
+// writeExceptionsCSV writes the categories as consecutive sections, each introduced by a
+// title line and its own header row, separated by blank lines.
+func writeExceptionsCSV(out io.Writer, req ExceptionsRequest, report exceptionReport, sheet1Data, sheet2Data SheetData) error {
+	cw := csv.NewWriter(out)
+	cw.Write([]string{"Unmatched in " + req.Sheet1})
+	cw.Write(append([]string{"OriginalRow"}, sheet1Data.Headers...))
+	for _, row := range report.unmatched1 {
+		cw.Write(unmatchedRecord(sheet1Data, row))
+	}
+	cw.Write(nil)
+	cw.Write([]string{"Unmatched in " + req.Sheet2})
+	cw.Write(append([]string{"OriginalRow"}, sheet2Data.Headers...))
+	for _, row := range report.unmatched2 {
+		cw.Write(unmatchedRecord(sheet2Data, row))
+	}
+	cw.Write(nil)
+	cw.Write([]string{"Low confidence"})
+	cw.Write(lowConfidenceHeader)
+	for _, m := range report.lowConfidence {
+		cw.Write(m.record())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exceptionsExportHandler serves /api/exceptions/export.
+func exceptionsExportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling exceptions export request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := ExceptionsRequest{MinSimilarity: 100}
+	req.Normalize = profileDefaults(r)
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Format != "" && req.Format != "xlsx" && req.Format != "csv" {
+		http.Error(w, fmt.Sprintf("Unknown export format '%s' (expected xlsx or csv).", req.Format), http.StatusBadRequest)
+		return
+	}
+
+	sheet1Data, sheet2Data, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
+		return
+	}
+
+	ctx, done, ok := startJob(w, r, req.JobID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	groups, _, err := findMatches(ctx, req.MatchRequest, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Exceptions request failed: %v", err)
+		http.Error(w, err.Error(), matchErrorStatus(err))
+		return
+	}
+
+	report := findExceptions(groups, sheet1Data, sheet2Data, req.MinSimilarity)
+	log.Printf("INFO: Exceptions: %d unmatched in '%s', %d unmatched in '%s', %d low confidence.",
+		len(report.unmatched1), req.Sheet1, len(report.unmatched2), req.Sheet2, len(report.lowConfidence))
+
+	if req.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="exceptions.csv"`)
+		if err := writeExceptionsCSV(w, req, report, sheet1Data, sheet2Data); err != nil {
+			log.Printf("ERROR: Failed to write exceptions CSV: %v", err)
+		}
+		return
+	}
+
+	f, err := buildExceptionsWorkbook(req, report, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Failed to build exceptions workbook: %v", err)
+		http.Error(w, fmt.Sprintf("Error building export: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="exceptions.xlsx"`)
+	if _, err := f.WriteTo(w); err != nil {
+		log.Printf("ERROR: Failed to write exceptions workbook: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exceptionSections reads each titled section of an exceptions export, header row first.
+func exceptionSections(t *testing.T, format string, body []byte) map[string][][]string {
+	t.Helper()
+	sections := make(map[string][][]string)
+	if format == "csv" {
+		for _, section := range bytes.Split(bytes.TrimSpace(body), []byte("\n\n")) {
+			r := csv.NewReader(bytes.NewReader(section))
+			r.FieldsPerRecord = -1 // the title line has one field
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sections[records[0][0]] = records[1:]
+		}
+		return sections
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sections[sheet] = rows
+	}
+	return sections
+}
+
+func TestExceptionsReport(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"exc/A": {Headers: []string{"Name", "City"}, Rows: [][]string{{"Ann", "Oslo"}, {"Bob", "Rome"}, {"Cy", "Graz"}, {"", ""}}},
+		"exc/B": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}, {"Bobb"}, {"Dan"}}},
+	})
+	tests := []struct {
+		name                   string
+		format                 string
+		unmatched1, unmatched2 string // section titles; sheet names lose their "/" in xlsx
+	}{
+		{"each category has a sheet", "xlsx", "Unmatched in exc_A", "Unmatched in exc_B"},
+		{"each category has a csv section", "csv", "Unmatched in exc/A", "Unmatched in exc/B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ExceptionsRequest{MatchRequest: MatchRequest{Sheet1: "exc/A", Sheet2: "exc/B", UseFuzzy: true, FuzzyThreshold: 30}, Format: tt.format, MinSimilarity: 90}
+			req.ColumnPairs = []ColumnPair{{Col1: "Name", Col2: "Name"}}
+			w := serveJSON(exceptionsExportHandler, "POST", "/api/exceptions/export", req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("export: %d %s", w.Code, w.Body)
+			}
+			want := map[string][][]string{
+				tt.unmatched1:    {{"OriginalRow", "Name", "City"}, {"4", "Cy", "Graz"}},
+				tt.unmatched2:    {{"OriginalRow", "Name"}, {"4", "Dan"}},
+				"Low confidence": {lowConfidenceHeader, {"Name", "Name", "3", "Bob", "3", "Bobb", "75"}},
+			}
+			if got := exceptionSections(t, tt.format, w.Body.Bytes()); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
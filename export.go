@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// ExportRequest is a MatchRequest plus options controlling the generated workbook.
+type ExportRequest struct {
+	MatchRequest
+	Format      string   `json:"format"`      // "xlsx" (default) or "csv"
+	LinkSources bool     `json:"linkSources"` // include both source sheets and hyperlink each row reference into them (xlsx only)
+	Columns1    []string `json:"columns1"`    // sheet1 columns copied into each result row
+	Columns2    []string `json:"columns2"`    // sheet2 columns copied into each result row
+	Summary     bool     `json:"summary"`     // prepend a run summary: a leading sheet in xlsx, "#" comment lines in csv
+	GeneratedAt string   `json:"generatedAt"` // RFC 3339 time stamped on the summary instead of now, for exports that must be reproducible
+}
+
+// exportColumns lists the source columns copied into each exported result row.
+type exportColumns struct {
+	cols1, cols2 []int
+	labels       []string
+}
+
+// resolveExportColumns validates the requested source columns against both sheets.
+func resolveExportColumns(req ExportRequest, sheet1Data, sheet2Data SheetData) (exportColumns, error) {
+	var ec exportColumns
+	for _, name := range req.Columns1 {
+		col := findColumn(sheet1Data.Headers, name)
+		if col < 0 {
+			return ec, fmt.Errorf("export column '%s' not found in sheet '%s'", name, req.Sheet1)
+		}
+		ec.cols1 = append(ec.cols1, col)
+		ec.labels = append(ec.labels, req.Sheet1+": "+sheet1Data.Headers[col])
+	}
+	for _, name := range req.Columns2 {
+		col := findColumn(sheet2Data.Headers, name)
+		if col < 0 {
+			return ec, fmt.Errorf("export column '%s' not found in sheet '%s'", name, req.Sheet2)
+		}
+		ec.cols2 = append(ec.cols2, col)
+		ec.labels = append(ec.labels, req.Sheet2+": "+sheet2Data.Headers[col])
+	}
+	return ec, nil
+}
+
+// values returns the selected source cells for a match, sheet1 columns first.
+func (ec exportColumns) values(m MatchResult, sheet1Data, sheet2Data SheetData) []string {
+	vals := make([]string, 0, len(ec.labels))
+	row1 := sourceRow(sheet1Data, m.OriginalRow1)
+	for _, col := range ec.cols1 {
+		vals = append(vals, cellValue(row1, col))
+	}
+	row2 := sourceRow(sheet2Data, m.OriginalRow2)
+	for _, col := range ec.cols2 {
+		vals = append(vals, cellValue(row2, col))
+	}
+	return vals
+}
+
+// sourceRow returns the stored row for a 1-based Excel row number, or nil if out of range.
+func sourceRow(data SheetData, excelRow int) []string {
+	i := excelRow - data.rowNumber(0)
+	if i < 0 || i >= len(data.Rows) {
+		return nil
+	}
+	return data.Rows[i]
+}
+
+// ---------------------------------------------------------------------
+// --- Workbook Helpers ---
+// ---------------------------------------------------------------------
+
+// workbookBuilder creates sheets in a new workbook, keeping names valid and unique.
+type workbookBuilder struct {
+	f    *excelize.File
+	used map[string]bool
+}
+
+func newWorkbookBuilder() *workbookBuilder {
+	return &workbookBuilder{f: excelize.NewFile(), used: make(map[string]bool)}
+}
+
+// addSheet creates a sheet with a sanitized, de-duplicated version of name and returns the final name.
+// The first sheet added takes over the default "Sheet1" that excelize creates.
+func (b *workbookBuilder) addSheet(name string) string {
+	name = sanitizeSheetName(name)
+	final := name
+	for i := 2; b.used[strings.ToLower(final)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		final = truncateRunes(name, 31-len(suffix)) + suffix
+	}
+	if len(b.used) == 0 {
+		b.f.SetSheetName("Sheet1", final)
+	} else {
+		b.f.NewSheet(final)
+	}
+	b.used[strings.ToLower(final)] = true
+	return final
+}
+
+// sanitizeSheetName strips characters Excel forbids in sheet names and enforces the 31 character limit.
+func sanitizeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '\\', '/', '?', '*', '[', ']':
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "' ")
+	if name == "" {
+		name = "Sheet"
+	}
+	return truncateRunes(name, 31)
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// sheetLocation builds an internal hyperlink target such as 'My Sheet'!C5.
+func sheetLocation(sheet string, col, row int) string {
+	return fmt.Sprintf("'%s'!%s", strings.ReplaceAll(sheet, "'", "''"), cellRef(col, row))
+}
+
+// writeSourceSheet copies a stored sheet into the workbook, keeping original row numbers
+// (headers on their uploaded header row, data rows below) so match row references line up.
+func writeSourceSheet(f *excelize.File, sheet string, data SheetData) error {
+	headers := make([]interface{}, len(data.Headers))
+	for i, h := range data.Headers {
+		headers[i] = h
+	}
+	headerCell, _ := excelize.CoordinatesToCellName(1, data.rowNumber(-1))
+	if err := f.SetSheetRow(sheet, headerCell, &headers); err != nil {
+		return err
+	}
+	for i, row := range data.Rows {
+		vals := make([]interface{}, len(row))
+		for j, v := range row {
+			vals[j] = v
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, data.rowNumber(i))
+		if err := f.SetSheetRow(sheet, cell, &vals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildMatchWorkbook writes one worksheet per match group. When linkSources is set the
+// source sheets are appended and each row reference becomes a hyperlink to the matched cell.
+// A non-nil summary is written to a leading "Summary" sheet.
+func buildMatchWorkbook(req ExportRequest, groups []MatchGroup, ec exportColumns, sheet1Data, sheet2Data SheetData, summary *runSummary) (*excelize.File, error) {
+	b := newWorkbookBuilder()
+	f := b.f
+
+	if summary != nil {
+		if err := summary.writeSheet(f, b.addSheet("Summary")); err != nil {
+			return nil, err
+		}
+	}
+
+	groupSheets := make([]string, len(groups))
+	for i, g := range groups {
+		groupSheets[i] = b.addSheet(g.Header1 + " - " + g.Header2)
+	}
+	if len(groups) == 0 {
+		empty := b.addSheet("Matches")
+		f.SetSheetRow(empty, "A1", &[]interface{}{"No matches found."})
+	}
+
+	var src1, src2 string
+	if req.LinkSources {
+		src1 = b.addSheet("Source 1 - " + req.Sheet1)
+		src2 = b.addSheet("Source 2 - " + req.Sheet2)
+		if err := writeSourceSheet(f, src1, sheet1Data); err != nil {
+			return nil, err
+		}
+		if err := writeSourceSheet(f, src2, sheet2Data); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fuzzy matches get a light fill so reviewers can tell them apart from exact ones.
+	linkFont := &excelize.Font{Color: "0563C1", Underline: "single"}
+	fuzzyFill := excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFF2CC"}}
+	linkStyle, err := f.NewStyle(&excelize.Style{Font: linkFont})
+	if err != nil {
+		return nil, err
+	}
+	fuzzyStyle, err := f.NewStyle(&excelize.Style{Fill: fuzzyFill})
+	if err != nil {
+		return nil, err
+	}
+	fuzzyLinkStyle, err := f.NewStyle(&excelize.Style{Font: linkFont, Fill: fuzzyFill})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, g := range groups {
+		sheet := groupSheets[i]
+		header := []interface{}{"OriginalRow1", "Val1", "OriginalRow2", "Val2", "IsFuzzy"}
+		for _, label := range ec.labels {
+			header = append(header, label)
+		}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return nil, err
+		}
+		for j, m := range g.Matches {
+			row := j + 2
+			cell, _ := excelize.CoordinatesToCellName(1, row)
+			vals := []interface{}{m.OriginalRow1, m.Val1, m.OriginalRow2, m.Val2, m.IsFuzzy}
+			for _, v := range ec.values(m, sheet1Data, sheet2Data) {
+				vals = append(vals, v)
+			}
+			if err := f.SetSheetRow(sheet, cell, &vals); err != nil {
+				return nil, err
+			}
+
+			if m.IsFuzzy {
+				last, _ := excelize.CoordinatesToCellName(len(vals), row)
+				f.SetCellStyle(sheet, cell, last, fuzzyStyle)
+			}
+			if req.LinkSources {
+				style := linkStyle
+				if m.IsFuzzy {
+					style = fuzzyLinkStyle
+				}
+				ref1, _ := excelize.CoordinatesToCellName(1, row)
+				ref2, _ := excelize.CoordinatesToCellName(3, row)
+				f.SetCellHyperLink(sheet, ref1, sheetLocation(src1, g.col1, m.OriginalRow1), "Location")
+				f.SetCellHyperLink(sheet, ref2, sheetLocation(src2, g.col2, m.OriginalRow2), "Location")
+				f.SetCellStyle(sheet, ref1, ref1, style)
+				f.SetCellStyle(sheet, ref2, ref2, style)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// writeMatchCSV writes all groups into a single CSV, one line per match, preceded by the
+// summary comment lines when summary is non-nil.
+func writeMatchCSV(out io.Writer, groups []MatchGroup, ec exportColumns, sheet1Data, sheet2Data SheetData, summary *runSummary) error {
+	cw := csv.NewWriter(out)
+	if summary != nil {
+		if err := summary.writeCSVComments(cw); err != nil {
+			return err
+		}
+	}
+	header := append([]string{"Header1", "Header2", "OriginalRow1", "Val1", "OriginalRow2", "Val2", "IsFuzzy"}, ec.labels...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		for _, m := range g.Matches {
+			record := []string{
+				g.Header1, g.Header2,
+				strconv.Itoa(m.OriginalRow1), m.Val1,
+				strconv.Itoa(m.OriginalRow2), m.Val2,
+				strconv.FormatBool(m.IsFuzzy),
+			}
+			if err := cw.Write(append(record, ec.values(m, sheet1Data, sheet2Data)...)); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ---------------------------------------------------------------------
+// --- Export Handler ---
+// ---------------------------------------------------------------------
+
+// exportHandler runs a match and streams the results back as an .xlsx or .csv download.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling export request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExportRequest
+	req.Normalize = profileDefaults(r)
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Format != "" && req.Format != "xlsx" && req.Format != "csv" {
+		http.Error(w, fmt.Sprintf("Unknown export format '%s' (expected xlsx or csv).", req.Format), http.StatusBadRequest)
+		return
+	}
+	generated := time.Now().UTC()
+	if req.GeneratedAt != "" {
+		t, err := time.Parse(time.RFC3339, req.GeneratedAt)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid generatedAt '%s' (expected an RFC 3339 time).", req.GeneratedAt), http.StatusBadRequest)
+			return
+		}
+		generated = t.UTC()
+	}
+
+	sheet1Data, sheet2Data, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
+		return
+	}
+
+	ctx, done, ok := startJob(w, r, req.JobID)
+	if !ok {
+		return
+	}
+	defer done()
+
+	groups, comparisons, err := findMatches(ctx, req.MatchRequest, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Export request failed: %v", err)
+		http.Error(w, err.Error(), matchErrorStatus(err))
+		return
+	}
+
+	ec, err := resolveExportColumns(req, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Invalid export columns: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var summary *runSummary
+	if req.Summary {
+		s := summarizeRun(req.MatchRequest, groups, comparisons, sheet1Data, sheet2Data)
+		s.Generated = generated
+		summary = &s
+	}
+
+	if req.Format == "csv" {
+		log.Printf("INFO: Exporting %d match groups as CSV.", len(groups))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="match_results.csv"`)
+		if err := writeMatchCSV(w, groups, ec, sheet1Data, sheet2Data, summary); err != nil {
+			log.Printf("ERROR: Failed to write CSV export: %v", err)
+		}
+		return
+	}
+
+	f, err := buildMatchWorkbook(req, groups, ec, sheet1Data, sheet2Data, summary)
+	if err != nil {
+		log.Printf("ERROR: Failed to build export workbook: %v", err)
+		http.Error(w, fmt.Sprintf("Error building export: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	log.Printf("INFO: Exporting %d match groups (linked sources: %t).", len(groups), req.LinkSources)
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="match_results.xlsx"`)
+	if _, err := f.WriteTo(w); err != nil {
+		log.Printf("ERROR: Failed to write export workbook: %v", err)
+	}
+}
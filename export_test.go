@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exportSheets are two small sheets matching on Name, rows 2 and 3 of one against 3 and 2 of
+// the other.
+var exportSheets = map[string]SheetData{
+	"export/A": {Headers: []string{"ID", "Name", "City"}, Rows: [][]string{{"1", "Ann", "Oslo"}, {"2", "Bob", "Rome"}}},
+	"export/B": {Headers: []string{"Ref", "Name", "Town"}, Rows: [][]string{{"x", "Bob", "Roma"}, {"y", "Ann", "Oslo"}}},
+}
+
+// postExport runs an export and opens the workbook it returns.
+func postExport(t *testing.T, req ExportRequest) *excelize.File {
+	t.Helper()
+	w := serveJSON(exportHandler, "POST", "/api/export", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", w.Code, w.Body)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestExportHyperlinks(t *testing.T) {
+	putSheets(t, exportSheets)
+	tests := []struct {
+		name        string
+		linkSources bool
+		cell        string
+		wantLink    bool
+		wantTarget  string
+	}{
+		{"a sheet1 row links to its cell", true, "A2", true, "'Source 1 - export_A'!B2"},
+		{"a sheet2 row links to its cell", true, "C2", true, "'Source 2 - export_B'!B3"},
+		{"values are not links", true, "B2", false, ""},
+		{"no links without linkSources", false, "A2", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ExportRequest{MatchRequest: MatchRequest{Sheet1: "export/A", Sheet2: "export/B"}, LinkSources: tt.linkSources}
+			req.ColumnPairs = []ColumnPair{{Col1: "Name", Col2: "Name"}}
+			f := postExport(t, req)
+			sheets := f.GetSheetList()
+			linked, target, err := f.GetCellHyperLink(sheets[0], tt.cell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked != tt.wantLink || target != tt.wantTarget {
+				t.Fatalf("%s links %v to %q, want %v to %q", tt.cell, linked, target, tt.wantLink, tt.wantTarget)
+			}
+			if tt.linkSources && len(sheets) != 3 {
+				t.Fatalf("sheets %v, want the results and both sources", sheets)
+			}
+			if linked {
+				sheet, cell, _ := strings.Cut(target, "!")
+				if v, _ := f.GetCellValue(strings.Trim(sheet, "'"), cell); v != "Ann" {
+					t.Fatalf("%s holds %q, want the matched value", target, v)
+				}
+			}
+		})
+	}
+}
+
+// exportTables returns the header and first data row of an export's results, in either format,
+// without the match metadata columns before the copied source columns.
+func exportTables(t *testing.T, req ExportRequest) (header, first []string) {
+	t.Helper()
+	if req.Format == "csv" {
+		w := serveJSON(exportHandler, "POST", "/api/export", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("export: %d %s", w.Code, w.Body)
+		}
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil || len(records) < 2 {
+			t.Fatalf("csv %q: %v", records, err)
+		}
+		return records[0][7:], records[1][7:]
+	}
+	f := postExport(t, req)
+	rows, err := f.GetRows(f.GetSheetList()[0])
+	if err != nil || len(rows) < 2 {
+		t.Fatalf("rows %q: %v", rows, err)
+	}
+	return rows[0][5:], rows[1][5:]
+}
+
+func TestExportColumnSubset(t *testing.T) {
+	putSheets(t, exportSheets)
+	tests := []struct {
+		name               string
+		format             string
+		columns1, columns2 []string
+		wantHeader         []string
+		wantFirst          []string
+	}{
+		{"xlsx copies only the chosen columns", "xlsx", []string{"City"}, []string{"Town", "Ref"},
+			[]string{"export/A: City", "export/B: Town", "export/B: Ref"}, []string{"Oslo", "Oslo", "y"}},
+		{"csv copies the same columns", "csv", []string{"City"}, []string{"Town", "Ref"},
+			[]string{"export/A: City", "export/B: Town", "export/B: Ref"}, []string{"Oslo", "Oslo", "y"}},
+		{"xlsx copies none by default", "xlsx", nil, nil, []string{}, []string{}},
+		{"csv copies none by default", "csv", nil, nil, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ExportRequest{MatchRequest: MatchRequest{Sheet1: "export/A", Sheet2: "export/B"}, Format: tt.format, Columns1: tt.columns1, Columns2: tt.columns2}
+			req.ColumnPairs = []ColumnPair{{Col1: "Name", Col2: "Name"}}
+			header, first := exportTables(t, req)
+			if !reflect.DeepEqual(header, tt.wantHeader) || !reflect.DeepEqual(first, tt.wantFirst) {
+				t.Fatalf("copied %q = %q, want %q = %q", header, first, tt.wantHeader, tt.wantFirst)
+			}
+		})
+	}
+
+	req := ExportRequest{MatchRequest: MatchRequest{Sheet1: "export/A", Sheet2: "export/B"}, Columns1: []string{"Country"}}
+	if w := serveJSON(exportHandler, "POST", "/api/export", req); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "'Country' not found") {
+		t.Errorf("unknown column: %d %q, want 400", w.Code, w.Body)
+	}
+}
+
+// exportSummary returns the label/value lines of an export's run summary, nil when it has none.
+func exportSummary(t *testing.T, req ExportRequest) [][2]string {
+	t.Helper()
+	var lines [][2]string
+	if req.Format == "csv" {
+		w := serveJSON(exportHandler, "POST", "/api/export", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("export: %d %s", w.Code, w.Body)
+		}
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			if text, ok := strings.CutPrefix(line, "# "); ok {
+				label, value, _ := strings.Cut(text, ": ")
+				lines = append(lines, [2]string{label, value})
+			}
+		}
+		return lines
+	}
+	f := postExport(t, req)
+	if f.GetSheetList()[0] != "Summary" {
+		return nil
+	}
+	rows, err := f.GetRows("Summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 || !reflect.DeepEqual(rows[0], []string{"Run summary"}) {
+		t.Fatalf("summary sheet starts %q", rows)
+	}
+	for _, row := range rows[1:] {
+		lines = append(lines, [2]string{row[0], row[1]})
+	}
+	return lines
+}
+
+func TestExportSummary(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"summary/A": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}, {"Bob"}, {"Cy"}}},
+		"summary/B": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}, {"Bobb"}}},
+	})
+	want := [][2]string{
+		{"Sheet 1", "summary/A"},
+		{"Sheet 2", "summary/B"},
+		{"Algorithm", "levenshtein"},
+		{"Threshold", "30"},
+		{"Comparisons", "1"},
+		{"Match groups", "1"},
+		{"Matches", "2"},
+		{"Exact matches", "1"},
+		{"Fuzzy matches", "1"},
+		{"Coverage summary/A", "66.7% (2 of 3 rows)"},
+		{"Coverage summary/B", "100.0% (2 of 2 rows)"},
+	}
+	tests := []struct {
+		name        string
+		format      string
+		summary     bool
+		generatedAt string
+		want        [][2]string
+	}{
+		{"an xlsx summary sheet", "xlsx", true, "", want},
+		{"csv summary comments", "csv", true, "", want},
+		{"the generated time can come from the request", "csv", true, "2026-01-02T03:04:05+01:00", want},
+		{"no xlsx summary unless asked for", "xlsx", false, "", nil},
+		{"no csv summary unless asked for", "csv", false, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ExportRequest{MatchRequest: MatchRequest{Sheet1: "summary/A", Sheet2: "summary/B", UseFuzzy: true, FuzzyThreshold: 30}, Format: tt.format, Summary: tt.summary, GeneratedAt: tt.generatedAt}
+			start := time.Now().UTC().Truncate(time.Second)
+			got := exportSummary(t, req)
+			if tt.summary {
+				if len(got) == 0 || got[len(got)-1][0] != "Generated" {
+					t.Fatalf("summary %q ends without a Generated line", got)
+				}
+				generated, err := time.Parse(time.RFC3339, got[len(got)-1][1])
+				if tt.generatedAt != "" {
+					want, _ := time.Parse(time.RFC3339, tt.generatedAt)
+					if err != nil || !generated.Equal(want) || generated.Location() != time.UTC {
+						t.Fatalf("generated %q, want %s in UTC", got[len(got)-1][1], tt.generatedAt)
+					}
+				} else if err != nil || generated.Before(start) || generated.After(time.Now()) {
+					t.Fatalf("generated %q, want the time of the export", got[len(got)-1][1])
+				}
+				got = got[:len(got)-1]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("summary %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	req := ExportRequest{MatchRequest: MatchRequest{Sheet1: "summary/A", Sheet2: "summary/B"}, Summary: true, GeneratedAt: "yesterday"}
+	if w := serveJSON(exportHandler, "POST", "/api/export", req); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid generatedAt: %d %q, want 400", w.Code, w.Body)
+	}
+}
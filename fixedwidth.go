@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Fixed-Width Text Uploads ---
+// ---------------------------------------------------------------------
+
+// Mainframe-style extracts lay each record out in fixed character positions. They are read
+// with uploadOptions.FixedWidth, a column spec of widths in characters ("6,20,10"), in which
+// case the first line is the header row sliced the same way, or of name:width pairs
+// ("id:6,name:20,amount:10"), in which case every line is data, after any skipRows.
+
+// fixedWidthSpec is a parsed FixedWidth column spec; names is nil for bare widths.
+type fixedWidthSpec struct {
+	names  []string
+	widths []int
+}
+
+// parseFixedWidthSpec parses a column spec; "" yields an empty spec.
+func parseFixedWidthSpec(s string) (fixedWidthSpec, error) {
+	var spec fixedWidthSpec
+	if strings.TrimSpace(s) == "" {
+		return spec, nil
+	}
+	for i, field := range strings.Split(s, ",") {
+		name, width, named := strings.Cut(field, ":")
+		if !named {
+			width = name
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(width))
+		if err != nil || n <= 0 {
+			return fixedWidthSpec{}, fmt.Errorf("invalid fixedWidth column %d '%s': widths must be positive integers", i+1, strings.TrimSpace(field))
+		}
+		if i > 0 && named != (spec.names != nil) {
+			return fixedWidthSpec{}, fmt.Errorf("invalid fixedWidth spec: give either every column a name or none")
+		}
+		if named {
+			spec.names = append(spec.names, strings.TrimSpace(name))
+		}
+		spec.widths = append(spec.widths, n)
+	}
+	return spec, nil
+}
+
+// slice cuts a line into the spec's columns, counting characters rather than bytes and
+// trimming the padding around each field. Text past the last column is ignored.
+func (spec fixedWidthSpec) slice(line string) []string {
+	runes := []rune(line)
+	fields := make([]string, 0, len(spec.widths))
+	pos := 0
+	for _, w := range spec.widths {
+		if pos >= len(runes) {
+			break
+		}
+		end := pos + w
+		if end > len(runes) {
+			end = len(runes)
+		}
+		fields = append(fields, strings.TrimSpace(string(runes[pos:end])))
+		pos = end
+	}
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
+
+// parseFixedWidthUpload reads a fixed-width text file as a single sheet named after the file.
+// Blank lines are kept as empty rows, as for delimited files.
+func parseFixedWidthUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	spec, err := parseFixedWidthSpec(opts.FixedWidth)
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	if len(spec.widths) == 0 {
+		return parsedUpload{}, fmt.Errorf("fixed-width files need a fixedWidth column spec")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(opts.Filename), filepath.Ext(opts.Filename))
+	if name == "" || name == "." {
+		name = "Sheet1"
+	}
+	var rows [][]string
+	if spec.names != nil {
+		rows = append(rows, spec.names)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		rows = append(rows, spec.slice(strings.TrimRight(sc.Text(), "\r")))
+		if err := checkRowLimits(name, opts.layout(), len(rows), rows[len(rows)-1]); err != nil {
+			return parsedUpload{}, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return parsedUpload{}, err
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, 1),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	if spec.names == nil {
+		up.addRows(name, rows, opts)
+		return up, nil
+	}
+
+	// The spec is the header, so skipRows only drops lines ahead of the data, and the data
+	// starts at the line HeaderRow names.
+	skip := max(opts.HeaderRow, 1) - 1
+	if skip > len(rows)-1 {
+		skip = len(rows) - 1
+	}
+	rows = append(rows[:1], rows[1+skip:]...)
+	layout := sheetLayout{HeaderRow: opts.HeaderRow, NoHeaderRow: true}
+	opts.HeaderRow, opts.HeaderRows = 0, 0
+	up.addRows(name, rows, opts)
+	if sheet, ok := up.sheets[name]; ok {
+		sheet.sheetLayout = layout
+		up.sheets[name] = sheet
+	}
+	return up, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFixedWidthRowNumbers(t *testing.T) {
+	const file = "title line\nid    name\n1     Ann\n2     Bob\n"
+	tests := []struct {
+		name        string
+		spec        string
+		skipRows    int
+		wantHeaders []string
+		wantFirst   []string // Rows[0]
+		wantRow     int      // file line of Rows[0]
+	}{
+		{"named spec: every line is data", "id:6,name:4", 0, []string{"id", "name"}, []string{"title", "line"}, 1},
+		{"named spec after skipRows", "id:6,name:4", 2, []string{"id", "name"}, []string{"1", "Ann"}, 3},
+		{"widths: the header line is skipped to", "6,4", 1, []string{"id", "name"}, []string{"1", "Ann"}, 3},
+		{"widths: the first line is the header", "6,4", 0, []string{"title", "line"}, []string{"id", "name"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := uploadOptions{Filename: "extract.txt", FixedWidth: tt.spec, SkipRows: tt.skipRows}
+			if err := opts.resolveHeaderRow(); err != nil {
+				t.Fatal(err)
+			}
+			up, err := parseFixedWidthUpload([]byte(file), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sheet := up.sheets["extract"]
+			if !reflect.DeepEqual(sheet.Headers, tt.wantHeaders) {
+				t.Errorf("headers %q, want %q", sheet.Headers, tt.wantHeaders)
+			}
+			if len(sheet.Rows) == 0 || !reflect.DeepEqual(sheet.Rows[0], tt.wantFirst) {
+				t.Fatalf("rows %q, want %q first", sheet.Rows, tt.wantFirst)
+			}
+			if got := sheet.rowNumber(0); got != tt.wantRow {
+				t.Errorf("rowNumber(0) = %d, want %d", got, tt.wantRow)
+			}
+		})
+	}
+}
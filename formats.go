@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Upload Formats ---
+// ---------------------------------------------------------------------
+
+// Upload formats. Delimited text (csv, tsv), fixed-width text, JSON, Parquet and XML become a
+// single sheet named after the file.
+const (
+	formatXLSX    = "xlsx"
+	formatXLS     = "xls"
+	formatODS     = "ods"
+	formatCSV     = "csv"
+	formatTSV     = "tsv"
+	formatZIP     = "zip"
+	formatJSON    = "json"
+	formatParquet = "parquet"
+	formatPDF     = "pdf"
+	formatXML     = "xml"
+	formatFixed   = "fixed" // never implied by an extension; see uploadFormat
+)
+
+// formatExtensions maps file extensions to the format they imply; anything else is read as xlsx.
+var formatExtensions = map[string]string{
+	".xlsx": formatXLSX, ".xlsm": formatXLSX,
+	".xls": formatXLS,
+	".ods": formatODS,
+	".csv": formatCSV, ".txt": formatCSV,
+	".tsv":     formatTSV,
+	".zip":     formatZIP,
+	".json":    formatJSON,
+	".parquet": formatParquet,
+	".pdf":     formatPDF,
+	".xml":     formatXML,
+}
+
+// validateUploadFormat checks an upload's explicit format; "" picks it from the file extension.
+func validateUploadFormat(format string) error {
+	switch format {
+	case "", formatXLSX, formatXLS, formatODS, formatCSV, formatTSV, formatZIP, formatJSON, formatParquet, formatPDF, formatXML, formatFixed:
+		return nil
+	}
+	return fmt.Errorf("unknown upload format '%s' (expected xlsx, xls, ods, csv, tsv, zip, json, parquet, pdf, xml or fixed)", format)
+}
+
+// uploadFormat is the format an upload is parsed as: the explicit one, else the extension's.
+// Given a fixed-width column spec, text files and files without a known extension are read
+// as fixed-width.
+func uploadFormat(opts uploadOptions) string {
+	if opts.Format != "" {
+		return opts.Format
+	}
+	format, ok := formatExtensions[strings.ToLower(filepath.Ext(opts.Filename))]
+	if opts.FixedWidth != "" && (!ok || format == formatCSV || format == formatTSV) {
+		return formatFixed
+	}
+	if ok {
+		return format
+	}
+	return formatXLSX
+}
+
+// parseUpload parses an upload according to its format. Errors say what failed, and
+// ingestUpload passes them on to the client.
+func parseUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	switch uploadFormat(opts) {
+	case formatCSV, formatTSV:
+		up, err := parseDelimitedUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("parsing delimited file: %v", err)
+		}
+		log.Printf("DEBUG: Parsed delimited file with delimiter %q.", up.delimiter)
+		return up, nil
+	case formatXLS:
+		up, err := parseXLSWorkbook(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("opening .xls workbook: %v", err)
+		}
+		return up, nil
+	case formatODS:
+		up, err := parseODSWorkbook(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("opening .ods spreadsheet: %v", err)
+		}
+		return up, nil
+	case formatJSON:
+		up, err := parseJSONUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("parsing JSON rows: %v", err)
+		}
+		return up, nil
+	case formatParquet:
+		up, err := parseParquetUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("reading Parquet file: %v", err)
+		}
+		return up, nil
+	case formatFixed:
+		up, err := parseFixedWidthUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("parsing fixed-width file: %v", err)
+		}
+		return up, nil
+	case formatXML:
+		up, err := parseXMLUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("parsing XML records: %v", err)
+		}
+		return up, nil
+	case formatPDF:
+		up, err := parsePDFUpload(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("reading PDF: %v", err)
+		}
+		return up, nil
+	case formatZIP:
+		up, err := parseZipArchive(data, opts)
+		if err != nil {
+			return up, fmt.Errorf("reading ZIP archive: %v", err)
+		}
+		return up, nil
+	}
+	up, err := parseWorkbook(data, opts)
+	if err != nil {
+		return up, fmt.Errorf("opening Excel file: %w", err)
+	}
+	return up, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Google Sheets Import ---
+// ---------------------------------------------------------------------
+
+// Google Sheets access for /api/import/google-sheet. The service account key file defaults to
+// GOOGLE_APPLICATION_CREDENTIALS; the spreadsheet must be shared with the account's email.
+var (
+	googleCredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	googleSheetsAPI       = "https://sheets.googleapis.com/v4/spreadsheets"
+)
+
+const googleSheetsScope = "https://www.googleapis.com/auth/spreadsheets.readonly"
+
+// GoogleSheetImportRequest names a spreadsheet to load; Tabs limits it to some of its tabs.
+type GoogleSheetImportRequest struct {
+	SpreadsheetID string   `json:"spreadsheetId"`
+	Tabs          []string `json:"tabs"`
+	uploadOptions
+}
+
+// serviceAccountKey holds the fields of a service account JSON key used for the JWT grant.
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleToken caches the access token between imports.
+var googleToken struct {
+	sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// googleAccessToken returns a valid access token, exchanging a freshly signed JWT for one
+// when the cached token is missing or about to expire.
+func googleAccessToken() (string, error) {
+	googleToken.Lock()
+	defer googleToken.Unlock()
+	if googleToken.value != "" && time.Until(googleToken.expires) > time.Minute {
+		return googleToken.value, nil
+	}
+
+	if googleCredentialsFile == "" {
+		return "", fmt.Errorf("no Google service account configured (set -google-credentials or GOOGLE_APPLICATION_CREDENTIALS)")
+	}
+	raw, err := os.ReadFile(googleCredentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("reading Google credentials: %v", err)
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return "", fmt.Errorf("parsing Google credentials: %v", err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	assertion, err := signServiceAccountJWT(key, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.PostForm(key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("requesting Google access token: %v", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting Google access token returned %s %s", resp.Status, token.Error)
+	}
+	googleToken.value = token.AccessToken
+	googleToken.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return googleToken.value, nil
+}
+
+// signServiceAccountJWT builds the RS256 assertion of the OAuth 2.0 JWT bearer grant.
+func signServiceAccountJWT(key serviceAccountKey, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("google credentials hold no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("parsing Google private key: %v", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("google private key is not an RSA key")
+	}
+
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": googleSheetsScope,
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// googleGet fetches a Sheets API URL with the access token, under the remote fetch limits.
+func googleGet(apiURL, token string) ([]byte, int, error) {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	buf, _, status, err := fetchRemote(req)
+	if err != nil {
+		return nil, status, err
+	}
+	return buf.Bytes(), http.StatusOK, nil
+}
+
+// googleSheetTabs lists the tab titles of a spreadsheet, in order.
+func googleSheetTabs(id, token string) ([]string, int, error) {
+	body, status, err := googleGet(googleSheetsAPI+"/"+url.PathEscape(id)+"?fields=sheets.properties.title", token)
+	if err != nil {
+		return nil, status, err
+	}
+	var meta struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("decoding spreadsheet metadata: %v", err)
+	}
+	tabs := make([]string, len(meta.Sheets))
+	for i, s := range meta.Sheets {
+		tabs[i] = s.Properties.Title
+	}
+	return tabs, http.StatusOK, nil
+}
+
+// googleValuesURL builds the values:batchGet call reading whole tabs as formatted text.
+func googleValuesURL(id string, tabs []string) string {
+	q := url.Values{"majorDimension": {"ROWS"}, "valueRenderOption": {"FORMATTED_VALUE"}}
+	for _, tab := range tabs {
+		q.Add("ranges", "'"+strings.ReplaceAll(tab, "'", "''")+"'")
+	}
+	return googleSheetsAPI + "/" + url.PathEscape(id) + "/values:batchGet?" + q.Encode()
+}
+
+// parseGoogleValues turns a values:batchGet response into sheets; its value ranges come back
+// in the order of tabs. The first row of each tab is its header row.
+func parseGoogleValues(tabs []string) func([]byte, uploadOptions) (parsedUpload, error) {
+	return func(data []byte, opts uploadOptions) (parsedUpload, error) {
+		var batch struct {
+			ValueRanges []struct {
+				Values [][]string `json:"values"`
+			} `json:"valueRanges"`
+		}
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return parsedUpload{}, fmt.Errorf("decoding sheet values: %v", err)
+		}
+		if len(batch.ValueRanges) != len(tabs) {
+			return parsedUpload{}, fmt.Errorf("expected %d tabs of values, got %d", len(tabs), len(batch.ValueRanges))
+		}
+		up := parsedUpload{
+			sheets:      make(map[string]SheetData, len(tabs)),
+			names:       make([]string, 0, len(tabs)),
+			sheetErrors: make([]SheetError, 0),
+			dropped:     make([]string, 0),
+		}
+		for i, tab := range tabs {
+			up.addRows(tab, batch.ValueRanges[i].Values, opts)
+		}
+		return up, nil
+	}
+}
+
+// googleSheetImportHandler handles POST /api/import/google-sheet.
+func googleSheetImportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling Google Sheets import request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req GoogleSheetImportRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.SpreadsheetID == "" {
+		http.Error(w, "spreadsheetId is required.", http.StatusBadRequest)
+		return
+	}
+	if err := validateSheetPatterns(req.Sheets); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := googleAccessToken()
+	if err != nil {
+		log.Printf("ERROR: Google authentication failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	tabs := req.Tabs
+	if len(tabs) == 0 {
+		var status int
+		if tabs, status, err = googleSheetTabs(req.SpreadsheetID, token); err != nil {
+			log.Printf("ERROR: Listing spreadsheet tabs failed: %v", err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	tabs = slices.DeleteFunc(tabs, func(tab string) bool { return !req.selectsSheet(tab) })
+	if len(tabs) == 0 {
+		http.Error(w, "No tab of the spreadsheet matches the sheets filter.", http.StatusBadRequest)
+		return
+	}
+	body, status, err := googleGet(googleValuesURL(req.SpreadsheetID, tabs), token)
+	if err != nil {
+		log.Printf("ERROR: Reading spreadsheet values failed: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("INFO: Fetched %d tab(s) of spreadsheet %s.", len(tabs), req.SpreadsheetID)
+
+	if req.Dataset == "" {
+		req.Dataset = req.SpreadsheetID
+	}
+	req.Format, req.Lazy = "", false
+	storeUpload(w, r, body, req.uploadOptions, parseGoogleValues(tabs), http.StatusBadGateway)
+}
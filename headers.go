@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ---------------------------------------------------------------------
+// --- Header Rows ---
+// ---------------------------------------------------------------------
+
+// maxHeaderRows caps uploadOptions.HeaderRows.
+const maxHeaderRows = 5
+
+// headerSeparator joins the parts of a header spanning several rows, as in "Q1 / Revenue".
+const headerSeparator = " / "
+
+// sheetLayout says where a sheet's headers are: HeaderRow is the 1-based first header row
+// (0 for row 1) and HeaderRows the number of rows they span (0 for one). With NoHeaderRow the
+// headers came from elsewhere, and the data starts at HeaderRow instead.
+type sheetLayout struct {
+	HeaderRow   int
+	HeaderRows  int
+	NoHeaderRow bool `json:",omitempty"`
+}
+
+// layout returns the header layout an upload asked for.
+func (opts uploadOptions) layout() sheetLayout {
+	return sheetLayout{HeaderRow: opts.HeaderRow, HeaderRows: opts.HeaderRows}
+}
+
+// splitSheet takes a sheet's headers from the rows layout names, discarding the rows above
+// them, and keeps the rows below as data. Headers spanning several rows are merged by
+// mergeHeaderRows. empty reports that no non-blank cell is left.
+func splitSheet(rows [][]string, layout sheetLayout, fillRight bool) (sheet SheetData, empty bool) {
+	skip := max(layout.HeaderRow, 1) - 1
+	if skip > len(rows) {
+		skip = len(rows)
+	}
+	rows = rows[skip:]
+	if isEmptySheet(rows) {
+		return SheetData{Headers: []string{}, Rows: [][]string{}}, true
+	}
+
+	n := max(layout.HeaderRows, 1)
+	if n > len(rows) {
+		n = len(rows)
+	}
+	var headers []string
+	if n == 1 {
+		headers = rows[0]
+	} else {
+		headers = mergeHeaderRows(rows[:n], fillRight)
+	}
+	if headers == nil {
+		headers = []string{}
+	}
+	return SheetData{Headers: headers, Rows: rows[n:], sheetLayout: layout}, false
+}
+
+// mergeHeaderRows combines header rows into one composite name per column, top row first,
+// skipping blank parts and repeats of the part above (a label merged down several rows).
+// With fillRight a blank cell in any but the last row takes the label to its left, since
+// formats without merged cells leave a grouped label in the group's first column only.
+func mergeHeaderRows(rows [][]string, fillRight bool) []string {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	parts := make([][]string, width)
+	for r, row := range rows {
+		last := ""
+		for c := 0; c < width; c++ {
+			label := strings.TrimSpace(cellValue(row, c))
+			if label != "" {
+				last = label
+			} else if fillRight && r < len(rows)-1 {
+				label = last
+			}
+			if label != "" && (len(parts[c]) == 0 || parts[c][len(parts[c])-1] != label) {
+				parts[c] = append(parts[c], label)
+			}
+		}
+	}
+
+	headers := make([]string, width)
+	for c, p := range parts {
+		headers[c] = strings.Join(p, headerSeparator)
+	}
+	return headers
+}
+
+// fillMergedHeaders copies the value of each merged cell range overlapping the header rows
+// into every cell of the range, so a group label spanning several columns names them all.
+// rows are the sheet's rows from row 1, as readSheetRows returns them.
+func fillMergedHeaders(f *excelize.File, sheet string, rows [][]string, layout sheetLayout) error {
+	merges, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return fmt.Errorf("reading merged cells: %v", err)
+	}
+	first := max(layout.HeaderRow, 1)
+	last := first + max(layout.HeaderRows, 1) - 1
+	if last > len(rows) {
+		last = len(rows)
+	}
+	for i := range merges {
+		col1, row1, err := excelize.CellNameToCoordinates(merges[i].GetStartAxis())
+		if err != nil {
+			return err
+		}
+		col2, row2, err := excelize.CellNameToCoordinates(merges[i].GetEndAxis())
+		if err != nil {
+			return err
+		}
+		value := merges[i].GetCellValue()
+		for r := max(row1, first); r <= row2 && r <= last; r++ {
+			row := rows[r-1]
+			for len(row) < col2 {
+				row = append(row, "")
+			}
+			for c := col1; c <= col2; c++ {
+				row[c-1] = value
+			}
+			rows[r-1] = row
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ---------------------------------------------------------------------
+// --- Jobs ---
+// ---------------------------------------------------------------------
+
+// Long-running operations (match, export, evaluate, sweep) run as jobs. A client may name a
+// job with MatchRequest.JobID and cancel it with POST /api/cancel/{id}; unnamed jobs get a
+// generated ID. Either way the ID is returned in the jobHeader response header. Job IDs belong
+// to the session (see session.go), so sessions neither cancel nor collide with each other's jobs.
+const jobHeader = "X-EDMS-Job"
+
+// statusJobCancelled is returned when a job is cancelled before finishing. It follows the
+// nginx "client closed request" convention, as no standard status fits.
+const statusJobCancelled = 499
+
+var (
+	jobs     = make(map[string]context.CancelFunc) // by scopedKey of the session and job ID
+	jobMutex sync.Mutex
+)
+
+// jobRegistry shares the running jobs of several instances, so a job ID is unique across them
+// and a job can be cancelled through any of them. It is implemented by shared stores.
+type jobRegistry interface {
+	claim(id string) (bool, error)  // registers a job; false if one with the ID is running anywhere
+	release(id string)              // unregisters a finished job
+	cancel(id string) (bool, error) // has the instance running a job cancel it; false if none is
+}
+
+// sharedJobs is the configured jobRegistry; nil keeps jobs local to this instance.
+var sharedJobs jobRegistry
+
+// startJob registers a cancellable job for the request. The returned context ends when the job
+// is cancelled or the client goes away; done must be called when the job finishes. It writes a
+// 409 and returns false if a job with the same ID is already running.
+func startJob(w http.ResponseWriter, r *http.Request, id string) (context.Context, func(), bool) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = randomID()
+	}
+	key := scopedKey(sessionID(r), id)
+	if key == "" {
+		http.Error(w, fmt.Sprintf("Invalid job ID '%s'.", id), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	jobMutex.Lock()
+	if _, running := jobs[key]; running {
+		jobMutex.Unlock()
+		cancel()
+		http.Error(w, fmt.Sprintf("Job '%s' is already running.", id), http.StatusConflict)
+		return nil, nil, false
+	}
+	jobs[key] = cancel
+	jobMutex.Unlock()
+
+	claimed := false
+	if sharedJobs != nil {
+		var err error
+		switch claimed, err = sharedJobs.claim(key); {
+		case err != nil:
+			log.Printf("WARN: Cannot register job '%s' with other instances: %v", id, err)
+		case !claimed:
+			jobMutex.Lock()
+			delete(jobs, key)
+			jobMutex.Unlock()
+			cancel()
+			http.Error(w, fmt.Sprintf("Job '%s' is already running.", id), http.StatusConflict)
+			return nil, nil, false
+		}
+	}
+
+	w.Header().Set(jobHeader, id)
+	done := func() {
+		jobMutex.Lock()
+		delete(jobs, key)
+		jobMutex.Unlock()
+		if claimed {
+			sharedJobs.release(key)
+		}
+		cancel()
+	}
+	return ctx, done, true
+}
+
+// randomID returns a random 16 hex digit identifier.
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// matchErrorStatus maps a findMatches error to a response status: cancelled jobs get
+// statusJobCancelled, anything else is an invalid request.
+func matchErrorStatus(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return statusJobCancelled
+	}
+	return http.StatusBadRequest
+}
+
+// cancelLocalJob cancels a job running on this instance, reporting whether there was one. key
+// is the job's scopedKey.
+func cancelLocalJob(key string) bool {
+	jobMutex.Lock()
+	cancel, running := jobs[key]
+	jobMutex.Unlock()
+	if running {
+		cancel()
+	}
+	return running
+}
+
+// cancelHandler serves POST /api/cancel/{id}, cancelling the job on whichever instance runs it.
+func cancelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/cancel/")
+	if id == "" {
+		http.Error(w, "Job not specified.", http.StatusBadRequest)
+		return
+	}
+
+	key := scopedKey(sessionID(r), id)
+	running := key != "" && cancelLocalJob(key)
+	if !running && key != "" && sharedJobs != nil {
+		var err error
+		if running, err = sharedJobs.cancel(key); err != nil {
+			http.Error(w, fmt.Sprintf("Error reaching the other instances: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+	if !running {
+		http.Error(w, fmt.Sprintf("Job '%s' is not running.", id), http.StatusNotFound)
+		return
+	}
+	log.Printf("INFO: Cancelled job '%s'.", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job":     id,
+		"message": "Job cancelled.",
+	})
+}
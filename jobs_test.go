@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCancelJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func(t *testing.T) int // the cancel response status
+		wantStatus int
+	}{
+		{"a running job is cancelled", func(t *testing.T) int {
+			ctx, done, ok := startJob(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/match", nil), "cancel-test")
+			if !ok {
+				t.Fatal("job not started")
+			}
+			defer done()
+			w := serveJSON(cancelHandler, "POST", "/api/cancel/cancel-test", nil)
+			if ctx.Err() != context.Canceled {
+				t.Errorf("job context %v, want it cancelled", ctx.Err())
+			}
+			return w.Code
+		}, http.StatusOK},
+		{"a finished job is not running", func(t *testing.T) int {
+			_, done, _ := startJob(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/match", nil), "cancel-test")
+			done()
+			return serveJSON(cancelHandler, "POST", "/api/cancel/cancel-test", nil).Code
+		}, http.StatusNotFound},
+		{"an unknown job is not running", func(t *testing.T) int {
+			return serveJSON(cancelHandler, "POST", "/api/cancel/no-such-job", nil).Code
+		}, http.StatusNotFound},
+		{"a job ID runs one job at a time", func(t *testing.T) int {
+			_, done, _ := startJob(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/match", nil), "cancel-test")
+			defer done()
+			w := httptest.NewRecorder()
+			if _, _, ok := startJob(w, httptest.NewRequest("POST", "/api/match", nil), "cancel-test"); ok {
+				t.Error("a second job with the ID started")
+			}
+			return w.Code
+		}, http.StatusConflict},
+		{"another session cannot cancel a job", func(t *testing.T) int {
+			ctx, done, _ := startJob(httptest.NewRecorder(), sessionRequest("session-a"), "cancel-test")
+			defer done()
+			w := serveSession(cancelHandler, "POST", "/api/cancel/cancel-test", "session-b", "")
+			if ctx.Err() != nil {
+				t.Errorf("job context %v, want it still running", ctx.Err())
+			}
+			return w.Code
+		}, http.StatusNotFound},
+		{"the owning session cancels it", func(t *testing.T) int {
+			_, done, _ := startJob(httptest.NewRecorder(), sessionRequest("session-a"), "cancel-test")
+			defer done()
+			return serveSession(cancelHandler, "POST", "/api/cancel/cancel-test", "session-a", "").Code
+		}, http.StatusOK},
+		{"sessions may reuse each other's job IDs", func(t *testing.T) int {
+			_, done, _ := startJob(httptest.NewRecorder(), sessionRequest("session-a"), "cancel-test")
+			defer done()
+			w := httptest.NewRecorder()
+			_, again, ok := startJob(w, sessionRequest("session-b"), "cancel-test")
+			if !ok {
+				return w.Code
+			}
+			again()
+			return http.StatusOK
+		}, http.StatusOK},
+		{"a job ID cannot name a session", func(t *testing.T) int {
+			w := httptest.NewRecorder()
+			if _, done, ok := startJob(w, sessionRequest("session-a"), "@session-b/cancel-test"); ok {
+				done()
+			}
+			return w.Code
+		}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.run(t); got != tt.wantStatus {
+				t.Fatalf("status %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// sessionRequest returns a match request made in a session.
+func sessionRequest(session string) *http.Request {
+	r := httptest.NewRequest("POST", "/api/match", nil)
+	r.Header.Set(sessionHeader, session)
+	return r
+}
+
+func TestCancelRunningMatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	putSheets(t, map[string]SheetData{
+		"cancel/A": {Headers: []string{"Code"}, Rows: randomWords(rng, 5000)},
+		"cancel/B": {Headers: []string{"Code"}, Rows: randomWords(rng, 5000)},
+	})
+	result := make(chan int)
+	go func() {
+		req := MatchRequest{Sheet1: "cancel/A", Sheet2: "cancel/B", UseFuzzy: true, FuzzyThreshold: 90, JobID: "slow-match"}
+		result <- serveJSON(matchHandler, "POST", "/api/match", req).Code
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		jobMutex.Lock()
+		_, running := jobs["slow-match"]
+		jobMutex.Unlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the match never started")
+		}
+	}
+	if w := serveJSON(cancelHandler, "POST", "/api/cancel/slow-match", nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", w.Code, w.Body)
+	}
+	if got := <-result; got != statusJobCancelled {
+		t.Fatalf("match ended with %d, want %d", got, statusJobCancelled)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- JSON Uploads ---
+// ---------------------------------------------------------------------
+
+// A JSON upload is an array of flat objects, such as an API export, read as one sheet: the
+// keys become the headers, in order of first appearance, and each object a row. It arrives as
+// a .json file on /api/upload or inline on /api/import/json.
+
+// JSONImportRequest carries the rows of a JSON upload inline. Sheet names the resulting
+// sheet (default "Sheet1").
+type JSONImportRequest struct {
+	Sheet string          `json:"sheet"`
+	Rows  json.RawMessage `json:"rows"`
+	uploadOptions
+}
+
+// parseJSONUpload reads a JSON array of objects as a single sheet named after the file.
+// Strings are taken as they are, numbers as written, null as a blank cell and nested values
+// as their JSON text. Header row options do not apply, since the keys are the header.
+func parseJSONUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	if err := expectDelim(dec, '['); err != nil {
+		return parsedUpload{}, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(opts.Filename), filepath.Ext(opts.Filename))
+	if name == "" || name == "." {
+		name = "Sheet1"
+	}
+	headers := make([]string, 0)
+	columns := make(map[string]int)
+	rows := [][]string{headers}
+	for dec.More() {
+		if err := expectDelim(dec, '{'); err != nil {
+			return parsedUpload{}, fmt.Errorf("row %d: %v", len(rows), err)
+		}
+		var row []string
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return parsedUpload{}, fmt.Errorf("row %d: %v", len(rows), err)
+			}
+			key := tok.(string) // object keys are always strings
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return parsedUpload{}, fmt.Errorf("row %d, key '%s': %v", len(rows), key, err)
+			}
+
+			c, ok := columns[key]
+			if !ok {
+				c = len(headers)
+				columns[key] = c
+				headers = append(headers, key)
+			}
+			for len(row) <= c {
+				row = append(row, "")
+			}
+			row[c] = jsonCellValue(raw)
+		}
+		if _, err := dec.Token(); err != nil { // closing '}'
+			return parsedUpload{}, fmt.Errorf("row %d: %v", len(rows), err)
+		}
+		rows = append(rows, row)
+		if err := checkRowLimits(name, sheetLayout{}, len(rows), row); err != nil {
+			return parsedUpload{}, err
+		}
+	}
+	if _, err := dec.Token(); err != nil { // closing ']'
+		return parsedUpload{}, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return parsedUpload{}, fmt.Errorf("unexpected data after the JSON array")
+	}
+	rows[0] = headers
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, 1),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	opts.HeaderRow, opts.HeaderRows = 0, 0
+	up.addRows(name, rows, opts)
+	return up, nil
+}
+
+// expectDelim reads the next token and checks that it opens an array or object.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		if want == '[' {
+			return fmt.Errorf("expected a JSON array of objects")
+		}
+		return fmt.Errorf("expected an object, got %v", tok)
+	}
+	return nil
+}
+
+// jsonCellValue turns a JSON value into cell text.
+func jsonCellValue(raw json.RawMessage) string {
+	switch {
+	case string(raw) == "null":
+		return ""
+	case len(raw) > 0 && raw[0] == '"':
+		var s string
+		json.Unmarshal(raw, &s)
+		return s
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+// jsonImportHandler handles POST /api/import/json, storing inline JSON rows like an upload.
+func jsonImportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling JSON import request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req JSONImportRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Rows) == 0 {
+		http.Error(w, "rows is required.", http.StatusBadRequest)
+		return
+	}
+	sheet := req.Sheet
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	req.Filename = sheet + ".json"
+	req.Format, req.Lazy = formatJSON, false
+	storeUpload(w, r, req.Rows, req.uploadOptions, parseUpload, http.StatusBadRequest)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"sync"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ---------------------------------------------------------------------
+// --- Lazy Sheets ---
+// ---------------------------------------------------------------------
+
+// With uploadOptions.Lazy the workbook is kept open and only its sheet names are recorded.
+// Each sheet is parsed the first time getSheet asks for it and then moves into dataStore,
+// so sheets that are never used are never parsed. With a store configured, a dataset's
+// pending sheets are saved as the workbook they come from (see lazySource) rather than parsed
+// for saving, and are pending again once restored.
+
+// lazyWorkbook is an open workbook shared by the pending sheets of one upload.
+type lazyWorkbook struct {
+	mu            sync.Mutex // serializes reads of the workbook
+	f             *excelize.File
+	captureStyles bool
+	layout        sheetLayout
+	src           []byte // the workbook file, nil when it cannot be reopened without a password
+}
+
+// lazySource is how a lazy upload's pending sheets are persisted: the workbook file they are
+// parsed from, with each sheet key's sheet name in it.
+type lazySource struct {
+	Data          []byte
+	CaptureStyles bool
+	Layout        sheetLayout
+	Sheets        map[string]string
+}
+
+// lazySheet is a sheet that has not been parsed yet.
+type lazySheet struct {
+	book *lazyWorkbook
+	name string
+
+	once sync.Once
+	data SheetData
+	err  error
+}
+
+// pendingSheets holds the unparsed sheets by namespaced key. It is guarded by storeMutex.
+var pendingSheets = make(map[string]*lazySheet)
+
+// load parses the sheet once; concurrent callers wait for the same result.
+func (s *lazySheet) load() (SheetData, error) {
+	s.once.Do(func() {
+		s.book.mu.Lock()
+		defer s.book.mu.Unlock()
+		s.data, _, s.err = parseSheet(s.book.f, s.name, s.book.captureStyles, s.book.layout)
+		if s.err == nil {
+			s.err = checkSheetLimits(s.name, s.data)
+		}
+		if s.err != nil {
+			s.data = SheetData{}
+			log.Printf("WARN: Failed to read sheet '%s' on first use: %v", s.name, s.err)
+		}
+		s.data = spillSheet(s.data)
+	})
+	return s.data, s.err
+}
+
+// close releases the workbook once no sheet is being parsed from it.
+func (b *lazyWorkbook) close() {
+	go func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.f.Close()
+	}()
+}
+
+// lazySourcesLocked returns the pending sheets of a dataset as the lazySources to persist, and
+// the keys they cover. Sheets whose workbook cannot be reopened are left out. Callers must hold
+// storeMutex.
+func lazySourcesLocked(info datasetInfo) ([]lazySource, map[string]bool) {
+	var sources []lazySource
+	covered := make(map[string]bool)
+	index := make(map[*lazyWorkbook]int)
+	for _, key := range info.Sheets {
+		if _, parsed := dataStore[key]; parsed {
+			continue
+		}
+		sheet := pendingSheets[key]
+		if sheet == nil || sheet.book.src == nil {
+			continue
+		}
+		i, ok := index[sheet.book]
+		if !ok {
+			i = len(sources)
+			index[sheet.book] = i
+			sources = append(sources, lazySource{
+				Data: sheet.book.src, CaptureStyles: sheet.book.captureStyles, Layout: sheet.book.layout,
+				Sheets: make(map[string]string),
+			})
+		}
+		sources[i].Sheets[key] = sheet.name
+		covered[key] = true
+	}
+	return sources, covered
+}
+
+// reopenLazySourcesLocked reopens the persisted workbooks of a dataset loaded from the store,
+// making their sheets pending again. A workbook that fails to open is logged and its sheets
+// are left out of the dataset. Callers must hold storeMutex.
+func reopenLazySourcesLocked(info *datasetInfo) {
+	var lost map[string]bool
+	for _, src := range info.Sources {
+		f, err := excelize.OpenReader(bytes.NewReader(src.Data))
+		if err != nil {
+			log.Printf("WARN: Cannot reopen the workbook of %d lazy sheet(s): %v", len(src.Sheets), err)
+			if lost == nil {
+				lost = make(map[string]bool)
+			}
+			for key := range src.Sheets {
+				lost[key] = true
+			}
+			continue
+		}
+		book := &lazyWorkbook{f: f, captureStyles: src.CaptureStyles, layout: src.Layout, src: src.Data}
+		for key, name := range src.Sheets {
+			pendingSheets[key] = &lazySheet{book: book, name: name}
+		}
+		info.books = append(info.books, book)
+		info.Bytes += int64(len(src.Data))
+	}
+	if lost != nil {
+		kept := info.Sheets[:0:0]
+		for _, key := range info.Sheets {
+			if !lost[key] {
+				kept = append(kept, key)
+			}
+		}
+		info.Sheets = kept
+	}
+	info.Sources = nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Request Body Limits ---
+// ---------------------------------------------------------------------
+
+// defaultBodyLimit caps JSON request bodies for endpoints without an explicit override.
+var defaultBodyLimit int64 = 1 << 20
+
+// bodyLimits holds per-endpoint JSON body caps in bytes, keyed by URL path.
+var bodyLimits = map[string]int64{}
+
+// bodyLimitFor returns the configured cap for the given endpoint path.
+func bodyLimitFor(path string) int64 {
+	if limit, ok := bodyLimits[path]; ok {
+		return limit
+	}
+	return defaultBodyLimit
+}
+
+// parseBodyLimits parses a "path=bytes,path=bytes" flag value into bodyLimits.
+func parseBodyLimits(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, size, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid body limit %q, expected path=bytes", entry)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid body limit size for %s: %q", path, size)
+		}
+		bodyLimits[strings.TrimSpace(path)] = n
+	}
+	return nil
+}
+
+// decodeJSONBody decodes the request body into v, enforcing the endpoint's body limit.
+// On failure it writes the error response (413 for oversized bodies, 400 otherwise) and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	limit := bodyLimitFor(r.URL.Path)
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("ERROR: Request body for %s exceeds %d bytes.", r.URL.Path, limit)
+			http.Error(w, fmt.Sprintf("Request body too large (limit %d bytes).", limit), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		log.Printf("ERROR: Invalid request body for %s: %v", r.URL.Path, err)
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// Upload caps, set from flags in main; 0 disables a cap. They apply to every way of loading
+// a dataset, and an upload over one is refused with a 413 before it reaches the store. The
+// parsers check them as they read, so an oversized sheet is refused without being held in
+// memory whole.
+var (
+	uploadMaxBytes   int64 = 1 << 30
+	uploadMaxRows    int
+	uploadMaxColumns int
+)
+
+// uploadFormSlack allows for the multipart framing and options around an upload form's file.
+const uploadFormSlack = 1 << 20
+
+// limitError reports data over one of the upload caps.
+type limitError string
+
+func (e limitError) Error() string { return string(e) }
+
+// isLimitError reports whether err is, or wraps, a limitError.
+func isLimitError(err error) bool {
+	var le limitError
+	return errors.As(err, &le)
+}
+
+// checkUploadSize refuses an upload of more than uploadMaxBytes.
+func checkUploadSize(n int64) error {
+	if uploadMaxBytes > 0 && n > uploadMaxBytes {
+		return fmt.Errorf("Upload too large: %s is over the limit of %s (-upload-max-bytes).", formatBytes(n), formatBytes(uploadMaxBytes))
+	}
+	return nil
+}
+
+// checkSheetLimits refuses a sheet with more data rows than uploadMaxRows or more columns
+// than uploadMaxColumns.
+func checkSheetLimits(name string, d SheetData) error {
+	if uploadMaxRows > 0 && len(d.Rows) > uploadMaxRows {
+		return limitError(fmt.Sprintf("Sheet '%s' has %d rows, over the limit of %d (-upload-max-rows).", name, len(d.Rows), uploadMaxRows))
+	}
+	if uploadMaxColumns > 0 {
+		cols := len(d.Headers)
+		for _, row := range d.Rows {
+			cols = max(cols, len(row))
+		}
+		if cols > uploadMaxColumns {
+			return limitError(fmt.Sprintf("Sheet '%s' has %d columns, over the limit of %d (-upload-max-columns).", name, cols, uploadMaxColumns))
+		}
+	}
+	return nil
+}
+
+// checkRowLimits is checkSheetLimits for a parser part way through a sheet: n is the number of
+// source rows read so far, including any above and at the header, and row the latest of them.
+// It refuses the same sheets checkSheetLimits would, as soon as the excess is read.
+func checkRowLimits(name string, layout sheetLayout, n int, row []string) error {
+	if uploadMaxRows > 0 && n > uploadMaxRows+max(layout.HeaderRow, 1)-1+max(layout.HeaderRows, 1) {
+		return limitError(fmt.Sprintf("Sheet '%s' has more than %d rows, over the limit (-upload-max-rows).", name, uploadMaxRows))
+	}
+	if uploadMaxColumns > 0 && len(row) > uploadMaxColumns {
+		return limitError(fmt.Sprintf("Sheet '%s' has %d columns, over the limit of %d (-upload-max-columns).", name, len(row), uploadMaxColumns))
+	}
+	return nil
+}
+
+// checkDatasetLimits applies checkSheetLimits to the sheets of a dataset, keyed as in dataStore.
+func checkDatasetLimits(sheets map[string]SheetData) error {
+	for key, data := range sheets {
+		if err := checkSheetLimits(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimits(t *testing.T) {
+	defer func(limits map[string]int64, def int64) { bodyLimits, defaultBodyLimit = limits, def }(bodyLimits, defaultBodyLimit)
+	bodyLimits, defaultBodyLimit = map[string]int64{}, 64
+	if err := parseBodyLimits("/api/match=256, /api/sweep=32"); err != nil {
+		t.Fatal(err)
+	}
+
+	values := func(n int) string { return `{"sheet1":"` + strings.Repeat("x", n) + `"}` }
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"under an endpoint's own limit", "/api/match", values(200), http.StatusBadRequest, "not found"},
+		{"over an endpoint's own limit", "/api/match", values(300), http.StatusRequestEntityTooLarge, "limit 256 bytes"},
+		{"over a lower endpoint limit", "/api/sweep", values(40), http.StatusRequestEntityTooLarge, "limit 32 bytes"},
+		{"over the default limit", "/api/align", values(100), http.StatusRequestEntityTooLarge, "limit 64 bytes"},
+		{"malformed JSON is a bad request", "/api/match", `{"sheet1":`, http.StatusBadRequest, "Invalid request body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := map[string]http.HandlerFunc{"/api/match": matchHandler, "/api/sweep": sweepHandler, "/api/align": alignHandler}[tt.path]
+			w := serveJSON(handler, "POST", tt.path, tt.body)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("got %d %q, want %d with %q", w.Code, w.Body, tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+
+	for _, spec := range []string{"/api/match", "/api/match=0", "/api/match=big"} {
+		if err := parseBodyLimits(spec); err == nil {
+			t.Errorf("parseBodyLimits(%q) accepted", spec)
+		}
+	}
+}
+
+func TestParserRowLimits(t *testing.T) {
+	defer func(rows, cols int) { uploadMaxRows, uploadMaxColumns = rows, cols }(uploadMaxRows, uploadMaxColumns)
+
+	tests := []struct {
+		name    string
+		parse   func([]byte, uploadOptions) (parsedUpload, error)
+		data    string
+		opts    uploadOptions
+		maxRows int
+		maxCols int
+		refused bool
+	}{
+		{"csv at the row cap", parseDelimitedUpload, "id\n1\n2\n", uploadOptions{}, 2, 0, false},
+		{"csv over the row cap", parseDelimitedUpload, "id\n1\n2\n3\n", uploadOptions{}, 2, 0, true},
+		{"csv title rows not counted", parseDelimitedUpload, "Title\n\nid\n1\n2\n", uploadOptions{HeaderRow: 3}, 2, 0, false},
+		{"csv over the column cap", parseDelimitedUpload, "a,b,c\n1,2,3\n", uploadOptions{}, 0, 2, true},
+		{"json over the row cap", parseJSONUpload, `[{"a":1},{"a":2},{"a":3}]`, uploadOptions{}, 2, 0, true},
+		{"json at the row cap", parseJSONUpload, `[{"a":1},{"a":2}]`, uploadOptions{}, 2, 0, false},
+		{"xml over the row cap", parseXMLUpload, `<r><x>1</x><x>2</x><x>3</x></r>`, uploadOptions{}, 2, 0, true},
+		{"fixed width over the row cap", parseFixedWidthUpload, "id\n1\n2\n3\n", uploadOptions{FixedWidth: "2"}, 2, 0, true},
+		{"no caps", parseDelimitedUpload, "id\n1\n2\n3\n", uploadOptions{}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploadMaxRows, uploadMaxColumns = tt.maxRows, tt.maxCols
+			if err := tt.opts.resolveHeaderRow(); err != nil {
+				t.Fatal(err)
+			}
+			tt.opts.Filename = "data.txt"
+			_, err := tt.parse([]byte(tt.data), tt.opts)
+			if tt.refused != isLimitError(err) {
+				t.Errorf("refused = %t, want %t (err %v)", isLimitError(err), tt.refused, err)
+			}
+			if !tt.refused && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
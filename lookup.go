@@ -0,0 +1,50 @@
+package main
+
+import "slices"
+
+// LookupTable is one column pair flattened into a key -> matched value mapping, so results can
+// be pasted back into a spreadsheet and consumed with VLOOKUP.
+type LookupTable struct {
+	Tab1    string `json:"tab1"`
+	Tab2    string `json:"tab2"`
+	Header1 string `json:"header1"`
+	Header2 string `json:"header2"`
+
+	// Lookup maps each sheet1 value to its first matched sheet2 value, like VLOOKUP would.
+	Lookup map[string]string `json:"lookup"`
+	// Duplicates lists every distinct matched value, in match order, for keys with more than one.
+	Duplicates map[string][]string `json:"duplicates,omitempty"`
+}
+
+// lookupTables converts match groups into one LookupTable per column pair, in group order.
+func lookupTables(groups []MatchGroup) []LookupTable {
+	tables := make([]LookupTable, 0, len(groups))
+	for _, g := range groups {
+		t := LookupTable{
+			Tab1:    g.Tab1,
+			Tab2:    g.Tab2,
+			Header1: g.Header1,
+			Header2: g.Header2,
+			Lookup:  make(map[string]string, len(g.Matches)),
+		}
+		values := make(map[string][]string)
+		for _, m := range g.Matches {
+			if _, ok := t.Lookup[m.Val1]; !ok {
+				t.Lookup[m.Val1] = m.Val2
+			}
+			if !slices.Contains(values[m.Val1], m.Val2) {
+				values[m.Val1] = append(values[m.Val1], m.Val2)
+			}
+		}
+		for key, vals := range values {
+			if len(vals) > 1 {
+				if t.Duplicates == nil {
+					t.Duplicates = make(map[string][]string)
+				}
+				t.Duplicates[key] = vals
+			}
+		}
+		tables = append(tables, t)
+	}
+	return tables
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLookupFormat(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"lookup/A": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}, {"Bob"}, {"Cy"}}},
+		"lookup/B": {Headers: []string{"Name"}, Rows: [][]string{{"ann"}, {"Bob"}, {"ANN"}}},
+	})
+	tests := []struct {
+		name string
+		req  MatchRequest
+		want []LookupTable
+	}{
+		{"a key maps to its first match and lists the others", MatchRequest{Sheet1: "lookup/A", Sheet2: "lookup/B"}, []LookupTable{{
+			Tab1: "lookup/A", Tab2: "lookup/B", Header1: "Name", Header2: "Name",
+			Lookup:     map[string]string{"Ann": "ann", "Bob": "Bob"},
+			Duplicates: map[string][]string{"Ann": {"ann", "ANN"}},
+		}}},
+		{"keys with one match have no duplicates", MatchRequest{Sheet1: "lookup/B", Sheet2: "lookup/A"}, []LookupTable{{
+			Tab1: "lookup/B", Tab2: "lookup/A", Header1: "Name", Header2: "Name",
+			Lookup: map[string]string{"ann": "Ann", "Bob": "Bob", "ANN": "Ann"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(matchHandler, "POST", "/api/match?format=lookup", tt.req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("match: %d %s", w.Code, w.Body)
+			}
+			var got []LookupTable
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if w := serveJSON(matchHandler, "POST", "/api/match?format=vlookup", MatchRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: %d, want 400", w.Code)
+	}
+}
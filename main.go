@@ -2,28 +2,57 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/http"
+	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/richardlehane/mscfb"
 	"github.com/xuri/excelize/v2"
 )
 
 // --- Global Data Structures (In-Memory Database) ---
 var (
-	dataStore = make(map[string]SheetData)
+	dataStore = make(map[string]SheetData) // keyed "dataset/sheet", see dataset.go
 	storeMutex sync.RWMutex
 )
 
 type SheetData struct {
 	Headers []string
 	Rows    [][]string 
+	Fills   [][]string // cell fill colors parallel to Rows; nil unless uploaded with captureStyles
+
+	sheetLayout // where Headers sat in the source sheet
+
+	spilled bool // whether the cell text of Rows lives in a mapped file; see spill.go
+}
+
+// rowNumber returns the source sheet's 1-based row number of Rows[i].
+func (d SheetData) rowNumber(i int) int {
+	if d.NoHeaderRow {
+		return max(d.HeaderRow, 1) + i
+	}
+	return max(d.HeaderRow, 1) + max(d.HeaderRows, 1) + i
+}
+
+// SheetError reports a sheet that could not be read during upload.
+type SheetError struct {
+	Sheet string `json:"sheet"`
+	Error string `json:"error"`
 }
 
 // ---------------------------------------------------------------------
@@ -88,17 +117,62 @@ func max(a, b int) int {
 
 // isFuzzyMatch checks if two values are a fuzzy match based on the threshold.
 func isFuzzyMatch(val1, val2 string, threshold int) bool {
-	s1 := standardKey(val1)
-	s2 := standardKey(val2)
-	if s1 == s2 { return true }
-	if s1 == "" || s2 == "" { return false }
+	return isFuzzyKeyMatch(standardKey(val1), standardKey(val2), threshold)
+}
 
-	maxLen := max(len(s1), len(s2))
-	if maxLen == 0 { return true }
+// isFuzzyKeyMatch is isFuzzyMatch for values that have already been normalized.
+func isFuzzyKeyMatch(s1, s2 string, threshold int) bool {
+	_, ok := fuzzyKeyDistance(s1, s2, threshold)
+	return ok
+}
 
-	dist := levenshteinDistance(s1, s2)
-	
-	return dist*100 <= maxLen*threshold
+// fuzzyKeyDistance returns the edit distance between two normalized values and whether it is
+// within the threshold (dist*100 <= maxLen*threshold). Pairs whose length difference alone
+// rules them out never reach the distance computation.
+func fuzzyKeyDistance(s1, s2 string, threshold int) (int, bool) {
+	if s1 == s2 { return 0, true }
+	if s1 == "" || s2 == "" || threshold < 0 { return 0, false }
+
+	maxDist := max(len(s1), len(s2)) * threshold / 100
+	if lenDiff := len(s1) - len(s2); lenDiff > maxDist || -lenDiff > maxDist {
+		return 0, false
+	}
+
+	dist := levenshteinWithin(s1, s2, maxDist)
+	return dist, dist <= maxDist
+}
+
+// levenshteinWithin is levenshteinDistance with an early exit: once every cell of a DP row
+// exceeds maxDist the final distance must too, so it stops and returns maxDist+1.
+func levenshteinWithin(s1, s2 string, maxDist int) int {
+	if len(s1) == 0 { return len(s2) }
+	if len(s2) == 0 { return len(s1) }
+
+	v0 := make([]int, len(s2)+1)
+	v1 := make([]int, len(s2)+1)
+	for i := range v0 {
+		v0[i] = i
+	}
+
+	for i := 1; i <= len(s1); i++ {
+		v1[0] = i
+		rowMin := v1[0]
+		for j := 1; j <= len(s2); j++ {
+			cost := 1
+			if s1[i-1] == s2[j-1] {
+				cost = 0
+			}
+			v1[j] = min(v1[j-1]+1, v0[j]+1, v0[j-1]+cost)
+			if v1[j] < rowMin {
+				rowMin = v1[j]
+			}
+		}
+		if rowMin > maxDist {
+			return maxDist + 1
+		}
+		v0, v1 = v1, v0
+	}
+	return v0[len(s2)]
 }
 
 // ---------------------------------------------------------------------
@@ -110,15 +184,65 @@ type MatchRequest struct {
 	Sheet2           string `json:"sheet2"`
 	UseFuzzy         bool   `json:"useFuzzy"`
 	FuzzyThreshold   int    `json:"fuzzyThreshold"`
-	IsTargeted       bool   `json:"isTargeted"` 
+	IsTargeted       bool   `json:"isTargeted"` // compare only column pairs whose headers agree; see selectColumnPairs
+	ColumnPairs      []ColumnPair `json:"columnPairs"` // compare only these column pairs, overriding IsTargeted
+	SampleSize       int    `json:"sampleSize"` // >0 returns a seeded random sample of matches instead of all groups
+	Seed             int64  `json:"seed"` // seeds every randomized step of the request (see requestRand); 0 is a valid fixed default
+	IDColumn1        string `json:"idColumn1"` // optional header of a stable row ID column in sheet1
+	IDColumn2        string `json:"idColumn2"` // optional header of a stable row ID column in sheet2
+	SimilarityFormat string `json:"similarityFormat"` // "distance", "percentage" (default) or "ratio"
+	Normalize        NormalizeOptions `json:"normalize"`
+	MinGroupSize     int    `json:"minGroupSize"` // drop column pairs with fewer matches than this
+	MaxGroups        int    `json:"maxGroups"`    // keep only the N column pairs with the most matches
+	ColorMode        string `json:"colorMode"`    // "same" or "colored" to also match on cell fill color; needs captureStyles
+	Algorithm        string `json:"algorithm"`    // "exact", "levenshtein", "token", "jaro-winkler", "phonetic", "ngram", "token-sort", "token-set", "tfidf", "damerau", "numeric", "date", "phone" or "email"; empty follows UseFuzzy
+	IncludeCellRefs  bool   `json:"includeCellRefs"` // add A1-style cell references (cell1/cell2) to each match
+	SortBy           string `json:"sortBy"`     // "similarity", "row" or "value" orders each group's matches; empty keeps scan order
+	SortOrder        string `json:"sortOrder"`  // "asc" or "desc"; defaults to desc for similarity, asc otherwise
+	SortGroups       bool   `json:"sortGroups"` // also order the groups by their first match under SortBy
+	DistinctOnly     bool   `json:"distinctOnly"` // match distinct values only, reporting the first row holding each value
+	JobID            string `json:"jobId"`        // optional name for cancelling the run via /api/cancel/{id}
+	MinTokenLen      int    `json:"minTokenLen"`  // token algorithms: ignore tokens shorter than this many characters
+	BestMatchOnly    bool   `json:"bestMatchOnly"`    // per column pair, keep only the highest scoring match of each sheet1 row
+	IncludeRunnersUp int    `json:"includeRunnersUp"` // with BestMatchOnly, attach up to N discarded candidates to each match
+	NGramSize        int     `json:"ngramSize"`     // ngram algorithm: characters per gram, 3 when 0
+	NGramMeasure     string  `json:"ngramMeasure"`  // ngram algorithm: "dice" (default) or "jaccard"
+	MinSimilarity    float64 `json:"minSimilarity"` // ngram algorithm and weighted scoring: least 0-1 similarity to match; 0 uses FuzzyThreshold
+	Tolerance        string  `json:"tolerance"`     // numeric algorithm: allowed difference, "0.01" or "2%"; empty requires equal values
+	DateWindow       int     `json:"dateWindow"`    // date algorithm: most days two dates may be apart; 0 requires the same day
+	DateOrder        string  `json:"dateOrder"`     // date algorithm: "dmy" (default) or "mdy" for dates like 01/02/2024
+	PhoneRegion      string  `json:"phoneRegion"`   // phone algorithm: region of numbers without a country code, "US" when empty
+	KeyColumns       []KeyColumn `json:"keyColumns"` // match rows on one key joined from these column pairs instead of column by column
+	Scoring          string      `json:"scoring"`    // "weighted" scores KeyColumns one by one and combines them by weight
+	Assignment       string      `json:"assignment"` // "greedy" or "optimal" keeps each row of either sheet in at most one match
+	EmailIgnoreTags  bool    `json:"emailIgnoreTags"` // email algorithm: ignore plus-addressing ("john+news@" is "john@")
+	EmailIgnoreDots  bool    `json:"emailIgnoreDots"` // email algorithm: ignore dots in Gmail local parts
 }
 
 type MatchResult struct {
-	OriginalRow1 int    `json:"originalRow1"`
-	OriginalRow2 int    `json:"originalRow2"`
-	Val1         string `json:"val1"`
-	Val2         string `json:"val2"`
-	IsFuzzy      bool   `json:"isFuzzy"`
+	OriginalRow1 int     `json:"originalRow1"`
+	OriginalRow2 int     `json:"originalRow2"`
+	Val1         string  `json:"val1"`
+	Val2         string  `json:"val2"`
+	IsFuzzy      bool    `json:"isFuzzy"`
+	ID1          string  `json:"id1,omitempty"`
+	ID2          string  `json:"id2,omitempty"`
+	Cell1        string  `json:"cell1,omitempty"` // A1-style reference of Val1, with MatchRequest.IncludeCellRefs
+	Cell2        string  `json:"cell2,omitempty"`
+	Similarity   float64 `json:"similarity"` // expressed per MatchRequest.SimilarityFormat
+	RunnersUp    []RunnerUp `json:"runnersUp,omitempty"` // next-best candidates discarded by BestMatchOnly
+	Algorithm    string     `json:"algorithm,omitempty"` // the fuzzy algorithm that matched the pair; empty for exact matches
+
+	score float64 // 0-1 similarity ratio, independent of the output format
+}
+
+// RunnerUp is a sheet2 candidate that lost to the reported best match.
+type RunnerUp struct {
+	OriginalRow2 int     `json:"originalRow2"`
+	Val2         string  `json:"val2"`
+	IsFuzzy      bool    `json:"isFuzzy"`
+	ID2          string  `json:"id2,omitempty"`
+	Similarity   float64 `json:"similarity"`
 }
 
 type MatchGroup struct {
@@ -127,6 +251,8 @@ type MatchGroup struct {
 	Header1 string        `json:"header1"`
 	Header2 string        `json:"header2"`
 	Matches []MatchResult `json:"matches"`
+
+	col1, col2 int // source column indices, used when exporting
 }
 
 // ---------------------------------------------------------------------
@@ -136,22 +262,36 @@ type MatchGroup struct {
 // uploadHandler handles file input, parsing, and data storage.
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("INFO: Handling file upload request.")
+	buf, opts, ok := readUploadForm(w, r)
+	if !ok {
+		return
+	}
+	storeWorkbook(w, r, buf, opts)
+}
+
+// readUploadForm reads the file and options of an upload form, writing the error response
+// and returning false when they are unusable.
+func readUploadForm(w http.ResponseWriter, r *http.Request) (*bytes.Buffer, uploadOptions, bool) {
 	if r.Method != "POST" {
-		log.Printf("ERROR: Method not allowed for /api/upload: %s", r.Method)
+		log.Printf("ERROR: Method not allowed for %s: %s", r.URL.Path, r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, uploadOptions{}, false
+	}
+	if uploadMaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, uploadMaxBytes+uploadFormSlack)
 	}
 	
-	storeMutex.Lock()
-	dataStore = make(map[string]SheetData)
-	storeMutex.Unlock()
-	log.Printf("DEBUG: In-memory data store cleared.")
-
 	file, header, err := r.FormFile("excelFile")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Printf("ERROR: Upload form for %s exceeds %d bytes.", r.URL.Path, tooLarge.Limit)
+		http.Error(w, fmt.Sprintf("Upload too large: the limit is %s (-upload-max-bytes).", formatBytes(uploadMaxBytes)), http.StatusRequestEntityTooLarge)
+		return nil, uploadOptions{}, false
+	}
 	if err != nil {
 		log.Printf("ERROR: Failed to retrieve file from form: %v", err)
 		http.Error(w, fmt.Sprintf("Error retrieving file: %v", err), http.StatusBadRequest)
-		return
+		return nil, uploadOptions{}, false
 	}
 	defer file.Close()
 	log.Printf("INFO: Received file: %s (%d bytes)", header.Filename, header.Size)
@@ -160,56 +300,429 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	if _, err := io.Copy(buf, file); err != nil {
 		log.Printf("ERROR: Failed to read file content: %v", err)
 		http.Error(w, "Error reading file content", http.StatusInternalServerError)
-		return
+		return nil, uploadOptions{}, false
 	}
 
-	f, err := excelize.OpenReader(buf)
+	ints := make(map[string]int)
+	for _, key := range []string{"headerRow", "skipRows", "headerRows"} {
+		n, err := formInt(r, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, uploadOptions{}, false
+		}
+		ints[key] = n
+	}
+
+	return buf, uploadOptions{
+		Dataset:       r.FormValue("dataset"),
+		Idempotent:    formBool(r, "idempotent"),
+		CaptureStyles: formBool(r, "captureStyles"),
+		KeepEmpty:     formBool(r, "keepEmptySheets"),
+		Lazy:          formBool(r, "lazy"),
+		Delimiter:     r.FormValue("delimiter"),
+		Mode:          r.FormValue("mode"),
+		Format:        r.FormValue("format"),
+		Password:      r.FormValue("password"),
+		HeaderRow:     ints["headerRow"],
+		SkipRows:      ints["skipRows"],
+		HeaderRows:    ints["headerRows"],
+		Sheets:        formList(r, "sheets"),
+		FixedWidth:    r.FormValue("fixedWidth"),
+		XMLRecord:     r.FormValue("xmlRecord"),
+		XMLFields:     r.FormValue("xmlFields"),
+		Tags:          formList(r, "tags"),
+		Filename:      header.Filename,
+	}, true
+}
+
+// uploadOptions are the per-upload settings shared by /api/upload and /api/upload-url.
+type uploadOptions struct {
+	Dataset       string `json:"dataset"`       // optional; see datasetID
+	Idempotent    bool   `json:"idempotent"`    // skip re-parsing a workbook the dataset already holds
+	CaptureStyles bool   `json:"captureStyles"` // also read each cell's fill color (slow on big sheets)
+	KeepEmpty     bool   `json:"keepEmptySheets"` // keep sheets with no cells at all instead of dropping them
+	Lazy          bool   `json:"lazy"`            // defer parsing each sheet until first use; empty sheets are then kept
+	Delimiter     string `json:"delimiter"`       // separator for delimited uploads: a character or tab/pipe/semicolon/comma; empty sniffs it
+	Mode          string `json:"mode"`            // "replace" (default) swaps out the dataset's sheets, "append" adds to them
+	Format        string `json:"format"`          // "xlsx", "xls", "ods", "csv", "tsv", "zip", "json", "parquet", "pdf", "xml" or "fixed"; empty decides by file extension
+	Password      string `json:"password"`        // opens an encrypted xlsx workbook
+	HeaderRow     int    `json:"headerRow"`       // 1-based row holding the headers; rows above it are title rows and ignored
+	SkipRows      int    `json:"skipRows"`        // alternatively, the number of rows above the header row
+	HeaderRows    int    `json:"headerRows"`      // rows the headers span, merged into names like "Q1 / Revenue"; default 1
+	Sheets      []string `json:"sheets"`          // names or glob patterns ("Sales*") of the sheets to load; empty loads all
+	FixedWidth    string `json:"fixedWidth"`      // column spec of a fixed-width text upload; see fixedwidth.go
+	XMLRecord     string `json:"xmlRecord"`       // record element of an XML upload; see xml.go
+	XMLFields     string `json:"xmlFields"`       // column-to-path mapping of an XML upload
+	Tags        []string `json:"tags"`            // "key=value" or "key" labels for the sheets; see tags.go
+
+	Filename string `json:"-"` // name of the uploaded file, used to tell delimited text from workbooks
+	Session  string `json:"-"` // session the dataset belongs to; "" for the shared datasets
+}
+
+// storeWorkbook parses an uploaded workbook into a dataset of the in-memory store, replacing
+// that dataset's contents (or adding to them in append mode), and writes the upload response.
+// With Idempotent set, re-submitting the workbook the dataset already holds returns the
+// existing sheet list without re-parsing.
+func storeWorkbook(w http.ResponseWriter, r *http.Request, buf *bytes.Buffer, opts uploadOptions) {
+	failStatus := http.StatusBadRequest
+	if uploadFormat(opts) == formatXLSX {
+		failStatus = http.StatusInternalServerError
+	}
+	storeUpload(w, r, buf.Bytes(), opts, parseUpload, failStatus)
+}
+
+// storeUpload is storeWorkbook for content that parse turns into sheets; a parse error is
+// reported with failStatus. The dataset goes into the request's session, or a new one.
+func storeUpload(w http.ResponseWriter, r *http.Request, data []byte, opts uploadOptions, parse func([]byte, uploadOptions) (parsedUpload, error), failStatus int) {
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	if session == "" {
+		session = newSessionToken()
+	}
+	opts.Session = session
+	result, status, err := ingestUpload(data, opts, parse, failStatus)
 	if err != nil {
-		log.Printf("ERROR: Failed to open Excel file with excelize: %v", err)
-		http.Error(w, fmt.Sprintf("Error opening Excel file: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
+	w.Header().Set(sessionHeader, session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-	sheetNames := f.GetSheetMap()
-	storeMutex.Lock()
-	defer storeMutex.Unlock()
+// uploadResult describes a stored upload; it is the JSON response of the upload endpoints.
+type uploadResult struct {
+	Dataset       string       `json:"dataset"`
+	SheetNames    []string     `json:"sheetNames"`
+	SheetErrors   []SheetError `json:"sheetErrors"`
+	DroppedSheets []string     `json:"droppedSheets"`
+	Delimiter     string       `json:"delimiter"`
+	ContentHash   string       `json:"contentHash"`
+	Cached        bool         `json:"cached"`
+	Message       string       `json:"message"`
+	Version       int          `json:"version"`           // the dataset's version number; see versions.go
+	Session       string       `json:"session,omitempty"` // see session.go
+}
 
-	names := make([]string, 0, len(sheetNames))
-	for _, sheetName := range sheetNames {
-		names = append(names, sheetName)
-		
-		rows, err := f.GetRows(sheetName)
-		if err != nil || len(rows) == 0 {
-			log.Printf("WARN: Skipping empty or unreadable sheet: %s", sheetName)
-			continue
+// ingestUpload is storeUpload without the HTTP response, for background ingestion. An error
+// comes with the HTTP status that describes it.
+func ingestUpload(data []byte, opts uploadOptions, parse func([]byte, uploadOptions) (parsedUpload, error), failStatus int) (uploadResult, int, error) {
+	if err := checkUploadSize(int64(len(data))); err != nil {
+		return uploadResult{}, http.StatusRequestEntityTooLarge, err
+	}
+	sum := sha256.Sum256(data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	dataset, err := datasetID(opts.Dataset, contentHash)
+	if err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	id := scopedKey(opts.Session, dataset)
+	if err := validateUploadMode(opts.Mode); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if err := validateUploadFormat(opts.Format); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if err := opts.resolveHeaderRow(); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if err := validateSheetPatterns(opts.Sheets); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if _, err := parseFixedWidthSpec(opts.FixedWidth); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if _, err := parseXMLFields(opts.XMLFields); err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	tags, err := parseTags(opts.Tags)
+	if err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	delim, err := parseDelimiter(opts.Delimiter)
+	if err != nil {
+		return uploadResult{}, http.StatusBadRequest, err
+	}
+	if delim != 0 {
+		opts.Delimiter = string(delim) // canonical, so "tab" and "\t" compare equal below
+	}
+
+	if opts.Idempotent {
+		storeMutex.RLock()
+		info, exists := datasets[id]
+		storeMutex.RUnlock()
+		if exists && info.Hash == contentHash && (info.Styles || !opts.CaptureStyles) && info.KeepEmpty == opts.KeepEmpty &&
+			(opts.Delimiter == "" || opts.Delimiter == info.Delimiter) && info.Layout == opts.layout() &&
+			slices.Equal(info.Selected, opts.Sheets) && info.FixedWidth == opts.FixedWidth &&
+			info.XMLMapping == opts.XMLRecord+"|"+opts.XMLFields && maps.Equal(info.Tags, tags) &&
+			(opts.Mode == uploadModeAppend || !info.Appended) {
+			log.Printf("INFO: Upload matches dataset '%s' (%s); skipping re-parse.", dataset, contentHash[:12])
+			recordUpload()
+			return uploadResult{
+				Dataset:       dataset,
+				SheetNames:    unscopedKeys(opts.Session, info.Sheets),
+				SheetErrors:   []SheetError{},
+				DroppedSheets: info.Dropped,
+				Delimiter:     info.Delimiter,
+				ContentHash:   contentHash,
+				Cached:        true,
+				Message:       "File already loaded.",
+				Version:       max(info.Version, 1),
+				Session:       opts.Session,
+			}, http.StatusOK, nil
 		}
+	}
 
-		headers := rows[0]
-		dataRows := make([][]string, len(rows)-1)
-		
-		for i, row := range rows[1:] {
-			data := make([]string, len(row))
-			for j, cell := range row {
-				data[j] = cell
+	// Parse everything before touching the store, so concurrent uploads only contend for the
+	// final swap and a failed parse leaves the previous contents in place.
+	up, err := parse(data, opts)
+	if err != nil {
+		log.Printf("ERROR: Failed to parse upload: %v", err)
+		if isLimitError(err) {
+			return uploadResult{}, http.StatusRequestEntityTooLarge, err
+		}
+		if isPasswordError(err) {
+			failStatus = http.StatusUnprocessableEntity
+		}
+		return uploadResult{}, failStatus, fmt.Errorf("Upload could not be parsed: %w", err)
+	}
+	for _, name := range up.names {
+		if err := checkSheetLimits(name, up.sheets[name]); err != nil {
+			if up.book != nil {
+				up.book.close()
 			}
-			dataRows[i] = data
+			log.Printf("ERROR: Refusing upload: %v", err)
+			return uploadResult{}, http.StatusRequestEntityTooLarge, err
 		}
+	}
+	if len(opts.Sheets) > 0 && len(up.names)+len(up.dropped)+len(up.sheetErrors) == 0 {
+		return uploadResult{}, http.StatusBadRequest, fmt.Errorf("No sheet matches the sheets filter (%s).", strings.Join(opts.Sheets, ", "))
+	}
+
+	if len(up.dropped) > 0 {
+		sort.Strings(up.dropped)
+		log.Printf("WARN: Dropped %d empty sheet(s): %s", len(up.dropped), strings.Join(up.dropped, ", "))
+	}
 
-		dataStore[sheetName] = SheetData{
-			Headers: headers,
-			Rows:    dataRows,
+	info := datasetInfo{
+		Hash: contentHash, Styles: opts.CaptureStyles, KeepEmpty: opts.KeepEmpty,
+		Dropped: up.dropped, Delimiter: up.delimiter, Layout: opts.layout(),
+		Selected: opts.Sheets, FixedWidth: opts.FixedWidth, XMLMapping: opts.XMLRecord + "|" + opts.XMLFields,
+		Uploaded: time.Now(), Filename: opts.Filename, Tags: tags,
+	}
+	for name, sheet := range up.sheets {
+		sheet = spillSheet(sheet)
+		up.sheets[name] = sheet
+		info.Bytes += sheet.bytes()
+	}
+	if up.book != nil {
+		info.books = []*lazyWorkbook{up.book}
+		info.Bytes += int64(len(data)) // stands in for the sheets not parsed yet
+	}
+	var (
+		keys    []string
+		version int
+	)
+	if opts.Mode == uploadModeAppend {
+		keys, version, err = appendDataset(id, info, up.names, up.sheets, up.pending)
+	} else {
+		keys, version, err = replaceDataset(id, info, up.names, up.sheets, up.pending)
+	}
+	if err != nil {
+		if up.book != nil {
+			up.book.close()
 		}
-		log.Printf("DEBUG: Parsed sheet '%s' with %d data rows and %d columns.", sheetName, len(dataRows), len(headers))
+		log.Printf("ERROR: Upload to dataset '%s' rejected: %v", dataset, err)
+		return uploadResult{}, http.StatusInsufficientStorage, err
 	}
-	
-	sort.Strings(names)
-	log.Printf("INFO: File processing complete. %d sheets stored.", len(names))
+	persistDataset(id)
+	recordUpload()
+	log.Printf("INFO: File processing complete. %d sheets stored in dataset '%s', %d failed.", len(keys), dataset, len(up.sheetErrors))
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"sheetNames": names,
-		"message":    "File parsed and stored successfully.",
-	})
+	message := "File parsed and stored successfully."
+	if len(up.sheetErrors) > 0 {
+		message = fmt.Sprintf("File parsed with %d unreadable sheet(s); see sheetErrors.", len(up.sheetErrors))
+	}
+	return uploadResult{
+		Dataset:       dataset,
+		SheetNames:    unscopedKeys(opts.Session, keys),
+		SheetErrors:   up.sheetErrors,
+		DroppedSheets: up.dropped,
+		Delimiter:     up.delimiter,
+		ContentHash:   contentHash,
+		Cached:        false,
+		Message:       message,
+		Version:       version,
+		Session:       opts.Session,
+	}, http.StatusOK, nil
+}
+
+// resolveHeaderRow folds SkipRows into HeaderRow, which ends up 0 for the default first row,
+// and checks HeaderRows. Setting both HeaderRow and SkipRows is fine as long as they agree.
+func (opts *uploadOptions) resolveHeaderRow() error {
+	if opts.HeaderRow < 0 || opts.SkipRows < 0 {
+		return fmt.Errorf("headerRow and skipRows must not be negative")
+	}
+	if opts.HeaderRows < 0 || opts.HeaderRows > maxHeaderRows {
+		return fmt.Errorf("headerRows must be between 1 and %d", maxHeaderRows)
+	}
+	if opts.HeaderRows == 1 {
+		opts.HeaderRows = 0
+	}
+	if opts.SkipRows > 0 {
+		if opts.HeaderRow != 0 && opts.HeaderRow != opts.SkipRows+1 {
+			return fmt.Errorf("headerRow %d disagrees with skipRows %d (which puts the headers on row %d)", opts.HeaderRow, opts.SkipRows, opts.SkipRows+1)
+		}
+		opts.HeaderRow = opts.SkipRows + 1
+	}
+	if opts.HeaderRow == 1 {
+		opts.HeaderRow = 0
+	}
+	opts.SkipRows = 0
+	return nil
+}
+
+// oleSignature starts every OLE compound file: a legacy .xls workbook, or an encrypted .xlsx.
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// oleEncrypted reports whether an OLE compound file holds an encrypted workbook, which keeps
+// its key data in an EncryptionInfo stream.
+func oleEncrypted(data []byte) bool {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Name == "EncryptionInfo" {
+			return true
+		}
+	}
+	return false
+}
+
+// errPasswordRequired reports an encrypted workbook uploaded without a password.
+var errPasswordRequired = errors.New("workbook is password protected; supply its password")
+
+// isPasswordError reports whether a parse failed for want of the right workbook password.
+func isPasswordError(err error) bool {
+	return errors.Is(err, errPasswordRequired) || errors.Is(err, excelize.ErrWorkbookPassword)
+}
+
+// parsedUpload is an uploaded file turned into sheets, ready to be stored as a dataset.
+type parsedUpload struct {
+	names       []string // plain sheet names, including pending ones
+	sheets      map[string]SheetData
+	pending     map[string]*lazySheet // sheets of a lazy upload, parsed on first use
+	book        *lazyWorkbook
+	sheetErrors []SheetError
+	dropped     []string // empty sheets left out
+	delimiter   string   // separator of a delimited text upload, "" for workbooks
+}
+
+// addRows stores a sheet's rows, split at the upload's header rows, under name; an empty sheet is
+// recorded as dropped instead unless opts.KeepEmpty is set. Sheets left out by opts.Sheets are
+// ignored.
+func (up *parsedUpload) addRows(name string, rows [][]string, opts uploadOptions) {
+	if !opts.selectsSheet(name) {
+		return
+	}
+	sheet, empty := splitSheet(rows, opts.layout(), true)
+	if empty && !opts.KeepEmpty {
+		up.dropped = append(up.dropped, name)
+		return
+	}
+	up.names = append(up.names, name)
+	up.sheets[name] = sheet
+}
+
+// validateSheetPatterns checks the glob syntax of an upload's sheets filter.
+func validateSheetPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid sheet pattern '%s': %v", p, err)
+		}
+	}
+	return nil
+}
+
+// selectsSheet reports whether the sheets filter admits a sheet. Names and patterns compare
+// case-insensitively, as Excel treats sheet names.
+func (opts uploadOptions) selectsSheet(name string) bool {
+	if len(opts.Sheets) == 0 {
+		return true
+	}
+	for _, p := range opts.Sheets {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWorkbook reads every selected sheet of an Excel workbook, or with opts.Lazy only records them.
+func parseWorkbook(data []byte, opts uploadOptions) (parsedUpload, error) {
+	if bytes.HasPrefix(data, oleSignature) {
+		if !oleEncrypted(data) {
+			return parseXLSWorkbook(data, opts) // a legacy workbook without its .xls extension
+		}
+		if opts.Password == "" {
+			return parsedUpload{}, errPasswordRequired
+		}
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data), excelize.Options{Password: opts.Password})
+	if err != nil {
+		return parsedUpload{}, err
+	}
+
+	sheetNames := f.GetSheetMap()
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, len(sheetNames)),
+		names:       make([]string, 0, len(sheetNames)),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	if opts.Lazy {
+		// The workbook stays open and each sheet is parsed on first use; see lazy.go.
+		up.book = &lazyWorkbook{f: f, captureStyles: opts.CaptureStyles, layout: opts.layout()}
+		if opts.Password == "" {
+			up.book.src = data
+		}
+		up.pending = make(map[string]*lazySheet, len(sheetNames))
+		for _, sheetName := range sheetNames {
+			if !opts.selectsSheet(sheetName) {
+				continue
+			}
+			up.names = append(up.names, sheetName)
+			up.pending[sheetName] = &lazySheet{book: up.book, name: sheetName}
+		}
+		return up, nil
+	}
+
+	defer f.Close()
+	for _, sheetName := range sheetNames {
+		if !opts.selectsSheet(sheetName) {
+			continue
+		}
+		sheet, empty, err := parseSheet(f, sheetName, opts.CaptureStyles, opts.layout())
+		if isLimitError(err) {
+			return parsedUpload{}, err
+		}
+		if err != nil {
+			log.Printf("WARN: Failed to read sheet '%s': %v", sheetName, err)
+			up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: sheetName, Error: err.Error()})
+			continue
+		}
+		if empty && !opts.KeepEmpty {
+			up.dropped = append(up.dropped, sheetName)
+			continue
+		}
+		up.names = append(up.names, sheetName)
+		up.sheets[sheetName] = sheet
+	}
+	return up, nil
 }
 
 // matchHandler executes the all-to-all column comparison logic.
@@ -220,127 +733,86 @@ func matchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req MatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: Invalid match request body: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "groups" && format != "lookup" {
+		http.Error(w, fmt.Sprintf("Unknown result format '%s' (expected groups or lookup).", format), http.StatusBadRequest)
+		return
+	}
+
+	req := MatchRequest{Normalize: profileDefaults(r)}
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 	
 	log.Printf("DEBUG: Matching sheets '%s' vs '%s'. Fuzzy: %t (Threshold: %d)", req.Sheet1, req.Sheet2, req.UseFuzzy, req.FuzzyThreshold)
 
-	storeMutex.RLock()
-	sheet1Data, ok1 := dataStore[req.Sheet1]
-	sheet2Data, ok2 := dataStore[req.Sheet2]
-	storeMutex.RUnlock()
-
-	if !ok1 || !ok2 {
-		log.Printf("ERROR: One or both sheets not found: %s, %s", req.Sheet1, req.Sheet2)
-		http.Error(w, "One or both sheets not found in store.", http.StatusBadRequest)
+	sheet1Data, sheet2Data, ok := lookupSheetPair(w, r, req.Sheet1, req.Sheet2)
+	if !ok {
 		return
 	}
 	
-	allMatches := make([]MatchGroup, 0)
-	numCols1 := len(sheet1Data.Headers)
-	numCols2 := len(sheet2Data.Headers)
-	totalComparisons := 0
-
-	matchedPairs := make(map[string]struct{}) 
-
-	for c1 := 0; c1 < numCols1; c1++ {
-		for c2 := 0; c2 < numCols2; c2++ {
-			totalComparisons++
-			matches := make([]MatchResult, 0)
-			
-			keyMap2 := make(map[string][]int) 
-			for r2, row2 := range sheet2Data.Rows {
-				if c2 < len(row2) {
-					key := standardKey(row2[c2])
-					if key != "" {
-						keyMap2[key] = append(keyMap2[key], r2 + 2)
-					}
-				}
-			}
+	ctx, done, ok := startJob(w, r, req.JobID)
+	if !ok {
+		return
+	}
+	defer done()
 
-			for r1, row1 := range sheet1Data.Rows {
-				if c1 >= len(row1) { continue }
-				val1 := row1[c1]
-				key1 := standardKey(val1)
-				row1Idx := r1 + 2
-
-				// 1. Exact/Standard Match
-				if row2Indices, ok := keyMap2[key1]; ok {
-					for _, row2Idx := range row2Indices {
-						pairKey := fmt.Sprintf("%d-%d", row1Idx, row2Idx)
-						if _, exists := matchedPairs[pairKey]; exists { continue }
-						
-						val2 := sheet2Data.Rows[row2Idx-2][c2] 
-						
-						matches = append(matches, MatchResult{
-							OriginalRow1: row1Idx,
-							OriginalRow2: row2Idx,
-							Val1: val1,
-							Val2: val2,
-							IsFuzzy: false,
-						})
-						matchedPairs[pairKey] = struct{}{}
-					}
-				}
-
-				// 2. Fuzzy Match (Only if enabled)
-				if req.UseFuzzy {
-					for r2, row2 := range sheet2Data.Rows {
-						row2Idx := r2 + 2
-						pairKey := fmt.Sprintf("%d-%d", row1Idx, row2Idx)
-						if _, exists := matchedPairs[pairKey]; exists { continue } 
-
-						if c2 >= len(row2) { continue }
-						val2 := row2[c2]
-
-						if isFuzzyMatch(val1, val2, req.FuzzyThreshold) {
-							matches = append(matches, MatchResult{
-								OriginalRow1: row1Idx,
-								OriginalRow2: row2Idx,
-								Val1: val1,
-								Val2: val2,
-								IsFuzzy: true,
-							})
-							matchedPairs[pairKey] = struct{}{}
-						}
-					}
-				}
-			}
-			
-			if len(matches) > 0 {
-				header1 := sheet1Data.Headers[c1]
-				header2 := sheet2Data.Headers[c2]
-				allMatches = append(allMatches, MatchGroup{
-					Tab1: req.Sheet1, Tab2: req.Sheet2,
-					Header1: header1, Header2: header2,
-					Matches: matches,
-				})
-			}
-		}
+	start := time.Now()
+	allMatches, totalComparisons, err := findMatches(ctx, req, sheet1Data, sheet2Data)
+	if err != nil {
+		log.Printf("ERROR: Match request failed: %v", err)
+		http.Error(w, err.Error(), matchErrorStatus(err))
+		return
 	}
-	
+	recordMatch(time.Since(start), totalComparisons)
+
 	log.Printf("INFO: Matching complete. Ran %d column pair comparisons, found %d match groups.", totalComparisons, len(allMatches))
 
+	var response interface{} = allMatches
+	if format == "lookup" {
+		response = lookupTables(allMatches)
+	} else if req.SampleSize > 0 {
+		sample := sampleMatches(allMatches, req.SampleSize, req.Seed)
+		log.Printf("INFO: Returning QA sample of %d/%d matches (seed %d).", sample.SampleSize, sample.TotalMatches, sample.Seed)
+		response = sample
+	}
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(response)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(allMatches)
+	w.Write(body.Bytes())
+	keepResult(w, r, body.Bytes())
 }
 
-// dataHandler retrieves the full data for a specific sheet.
+// dataHandler retrieves the full data for a specific sheet, deletes it on DELETE (see
+// deleteSheet) or renames it on PATCH (see patchSheet).
 func dataHandler(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
+	sheetName := strings.TrimPrefix(r.URL.Path, "/api/data/")
+	if sheetName == "" {
 		http.Error(w, "Sheet name not specified.", http.StatusBadRequest)
 		return
 	}
-	sheetName := pathParts[3]
 
-	storeMutex.RLock()
-	data, ok := dataStore[sheetName]
-	storeMutex.RUnlock()
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+	case "DELETE":
+		deleteSheet(w, session, sheetName)
+		return
+	case "PATCH":
+		patchSheet(w, r, session, sheetName)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, ok, err := getSessionSheet(session, sheetName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading sheet: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	if !ok {
 		log.Printf("WARN: Data request failed. Sheet not found: %s", sheetName)
@@ -349,18 +821,189 @@ func dataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("INFO: Serving raw data for sheet: %s", sheetName)
 
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", -1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	response := struct {
-		Headers []string     `json:"headers"`
-		Rows    [][]string   `json:"rows"`
+		Headers   []string     `json:"headers"`
+		Rows      [][]string   `json:"rows"`
+		TotalRows int          `json:"totalRows"`
+		Offset    int          `json:"offset"`
+		FirstRow  int          `json:"firstRow"` // sheet row number of the first data row
 	}{
-		Headers: data.Headers,
-		Rows:    data.Rows,
+		Headers:   data.Headers,
+		Rows:      pageRows(data.Rows, &offset, limit),
+		TotalRows: len(data.Rows),
+		Offset:    offset,
+		FirstRow:  data.rowNumber(0),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseSheet reads one worksheet into a SheetData, taking its headers from the rows layout
+// names (by default the first row). empty reports a sheet without a single non-blank cell from
+// the header row down, which comes back with no headers or rows.
+func parseSheet(f *excelize.File, sheetName string, captureStyles bool, layout sheetLayout) (sheet SheetData, empty bool, err error) {
+	rows, err := readSheetRows(f, sheetName, layout)
+	if err != nil {
+		return SheetData{}, false, err
+	}
+	if layout.HeaderRows > 1 {
+		if err := fillMergedHeaders(f, sheetName, rows, layout); err != nil {
+			return SheetData{}, false, err
+		}
+	}
+	sheet, empty = splitSheet(rows, layout, false)
+	if empty {
+		return sheet, true, nil
+	}
+
+	if captureStyles {
+		if sheet.Fills, err = readFills(f, sheetName, sheet.Rows, sheet.rowNumber(0)); err != nil {
+			return SheetData{}, false, fmt.Errorf("reading cell styles: %v", err)
+		}
+	}
+	log.Printf("DEBUG: Parsed sheet '%s' with %d data rows and %d columns.", sheetName, len(sheet.Rows), len(sheet.Headers))
+	return sheet, false, nil
+}
+
+// readSheetRows reads a sheet's rows with excelize's row iterator. The rows returned still
+// hold the whole sheet; what the iterator buys is that a sheet over the upload caps is refused
+// as soon as the excess is read rather than after all of it. Like GetRows, blank rows inside
+// the sheet are kept (as empty rows) and trailing ones dropped. Unlike GetRows, a malformed
+// row is an error rather than a silently truncated sheet.
+func readSheetRows(f *excelize.File, sheetName string, layout sheetLayout) ([][]string, error) {
+	iter, err := f.Rows(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	rows := make([][]string, 0, 64)
+	for cur := 1; iter.Next(); cur++ {
+		row, err := iter.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", cur, err)
+		}
+		if len(row) == 0 {
+			continue
+		}
+		for len(rows) < cur-1 {
+			rows = append(rows, nil)
+		}
+		rows = append(rows, row)
+		if err := checkRowLimits(sheetName, layout, len(rows), row); err != nil {
+			return nil, err
+		}
+		if cur%readLogRows == 0 {
+			log.Printf("DEBUG: Read %d rows of sheet '%s'.", cur, sheetName)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readLogRows is how often readSheetRows reports progress on a large sheet.
+const readLogRows = 100000
+
+// isEmptySheet reports whether a sheet has no non-blank cell at all. A sheet with only a
+// header row is not empty.
+func isEmptySheet(rows [][]string) bool {
+	for _, row := range rows {
+		if !isBlankRow(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBlankRow reports whether every cell of a row is blank.
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// queryInt reads an optional integer query parameter, returning def when it is absent.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := strings.TrimSpace(r.URL.Query().Get(key))
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': must be an integer", key, v)
+	}
+	return n, nil
+}
+
+// pageRows slices rows to the requested page, clamping offset into range (and writing the
+// clamped value back). A negative limit means no limit.
+func pageRows(rows [][]string, offset *int, limit int) [][]string {
+	if *offset < 0 {
+		*offset = 0
+	}
+	if *offset > len(rows) {
+		*offset = len(rows)
+	}
+	end := len(rows)
+	if limit >= 0 && limit < end-*offset {
+		end = *offset + limit
+	}
+	return rows[*offset:end]
+}
+
+// formBool reports whether a form or query value is set to a truthy value ("1", "true", "on", "yes").
+func formBool(r *http.Request, key string) bool {
+	switch strings.ToLower(strings.TrimSpace(r.FormValue(key))) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+// formList reads a form field that may be repeated and may hold comma-separated values,
+// dropping blank entries.
+func formList(r *http.Request, key string) []string {
+	var list []string
+	for _, v := range r.Form[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// formInt reads an optional integer form field, returning 0 when it is absent.
+func formInt(r *http.Request, key string) (int, error) {
+	v := strings.TrimSpace(r.FormValue(key))
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': must be an integer", key, v)
+	}
+	return n, nil
+}
+
 // serveFile is a helper to serve static files from the root directory.
 func serveFile(w http.ResponseWriter, r *http.Request, filename string, contentType string) {
 	w.Header().Set("Content-Type", contentType)
@@ -368,6 +1011,88 @@ func serveFile(w http.ResponseWriter, r *http.Request, filename string, contentT
 }
 
 func main() {
+	flag.Int64Var(&defaultBodyLimit, "body-limit", defaultBodyLimit, "Default maximum JSON request body size in bytes")
+	limitSpec := flag.String("body-limits", "", "Per-endpoint JSON body limits, e.g. /api/match=2097152,/api/export=4194304")
+	flag.Int64Var(&remoteMaxBytes, "url-max-bytes", remoteMaxBytes, "Maximum size in bytes of a workbook fetched via /api/upload-url")
+	flag.DurationVar(&remoteTimeout, "url-timeout", remoteTimeout, "Timeout for fetching a workbook via /api/upload-url")
+	flag.Int64Var(&chunkedMaxBytes, "chunked-max-bytes", chunkedMaxBytes, "Maximum size in bytes of a resumable upload")
+	flag.StringVar(&s3Endpoint, "s3-endpoint", s3Endpoint, "Endpoint of the S3-compatible service used by /api/import/s3 (e.g. a MinIO URL)")
+	flag.StringVar(&s3Region, "s3-region", s3Region, "Signing region for /api/import/s3")
+	flag.Int64Var(&storeMaxBytes, "store-max-bytes", storeMaxBytes, "Estimated size in bytes the data store may grow to; 0 is unlimited")
+	flag.DurationVar(&datasetTTL, "dataset-ttl", datasetTTL, "Delete datasets not updated for this long; 0 keeps them until deleted")
+	flag.Int64Var(&uploadMaxBytes, "upload-max-bytes", uploadMaxBytes, "Largest file in bytes that may be loaded as a dataset; 0 is unlimited")
+	flag.IntVar(&uploadMaxRows, "upload-max-rows", uploadMaxRows, "Most data rows a sheet may have; 0 is unlimited")
+	flag.IntVar(&uploadMaxColumns, "upload-max-columns", uploadMaxColumns, "Most columns a sheet may have; 0 is unlimited")
+	flag.IntVar(&spillRows, "spill-rows", spillRows, "Keep the cell text of sheets with at least this many rows in memory-mapped files; 0 keeps it in memory")
+	flag.StringVar(&spillDir, "spill-dir", spillDir, "Directory for the files of -spill-rows")
+	flag.Int64Var(&snapshotMaxBytes, "snapshot-max-bytes", snapshotMaxBytes, "Maximum decompressed size in bytes of a snapshot loaded via /api/snapshot")
+	flag.IntVar(&maxVersions, "max-versions", maxVersions, "Previous versions kept per dataset for rollback; 0 keeps none")
+	flag.IntVar(&dbMaxRows, "db-max-rows", dbMaxRows, "Maximum rows read from a query result via /api/import/db")
+	flag.Func("db", "Database /api/import/db may query, as name=dsn; repeat to configure several", addDBSource)
+	flag.BoolVar(&dbAllowClientDSN, "db-allow-dsn", dbAllowClientDSN, "Let /api/import/db requests give their own dsn instead of a -db name")
+	flag.StringVar(&googleCredentialsFile, "google-credentials", googleCredentialsFile, "Service account key file used by /api/import/google-sheet")
+	flag.BoolVar(&metricsEnabled, "metrics", metricsEnabled, "Expose Prometheus metrics at /metrics")
+	flag.StringVar(&watchDir, "watch-dir", watchDir, "Local directory or sftp://user@host/path to poll for spreadsheets to load")
+	flag.DurationVar(&watchInterval, "watch-interval", watchInterval, "How often -watch-dir is polled")
+	flag.StringVar(&watchSFTPKey, "watch-sftp-key", watchSFTPKey, "Private key file for an SFTP -watch-dir")
+	flag.StringVar(&watchKnownHosts, "watch-known-hosts", watchKnownHosts, "known_hosts file used to verify an SFTP -watch-dir server")
+	flag.StringVar(&mailURL, "imap-url", mailURL, "Mailbox to pull spreadsheet attachments from, as imaps://user@host[:port]/INBOX")
+	flag.StringVar(&mailSubject, "imap-subject", mailSubject, "Only load attachments of messages whose subject contains this text")
+	flag.DurationVar(&mailInterval, "imap-interval", mailInterval, "How often the -imap-url mailbox is checked")
+	storeSpec := flag.String("store", "", "Persist datasets across restarts, e.g. bolt:edms.db, postgres://user@host/db or redis://host:6379/0; empty keeps them in memory only")
+	walPath := flag.String("store-wal", "", "Write-ahead log file making -store writes crash-safe, e.g. edms.wal; empty writes to the store directly")
+	flag.DurationVar(&resultTTL, "result-ttl", resultTTL, "How long -store keeps match results for /api/results; 0 keeps none")
+	flag.DurationVar(&storeSyncInterval, "store-sync", storeSyncInterval, "How often a Postgres or Redis -store is polled for datasets saved by other instances; 0 disables")
+	flag.Parse()
+	if err := parseBodyLimits(*limitSpec); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+	if *storeSpec != "" {
+		var err error
+		if store, err = openStore(*storeSpec); err != nil {
+			log.Fatalf("FATAL: Cannot open store: %v", err)
+		}
+		shared, isShared := store.(sharedStore)
+		if isShared {
+			sharedDatasets = shared
+		}
+		if registry, ok := store.(jobRegistry); ok {
+			sharedJobs = registry
+		}
+		if kept, ok := store.(resultStore); ok {
+			results = kept
+		}
+		if *walPath != "" {
+			if store, err = openWAL(*walPath, store); err != nil {
+				log.Fatalf("FATAL: Cannot open the write-ahead log: %v", err)
+			}
+		}
+		if err := restoreStore(); err != nil {
+			log.Fatalf("FATAL: Cannot restore datasets from the store: %v", err)
+		}
+		if isShared && storeSyncInterval > 0 {
+			go runStoreSync(shared)
+		}
+	}
+	if datasetTTL > 0 {
+		go runExpiry()
+	}
+	if watchDir != "" {
+		src, err := newWatchSource(watchDir)
+		if err != nil {
+			log.Fatalf("FATAL: Cannot watch %s: %v", redactWatchDir(watchDir), err)
+		}
+		log.Printf("INFO: Watching %s for spreadsheets every %v.", redactWatchDir(watchDir), watchInterval)
+		go runWatcher(watchDir, src)
+	}
+	if mailURL != "" {
+		if _, err := parseMailURL(mailURL); err != nil {
+			log.Fatalf("FATAL: %v", err)
+		}
+		log.Printf("INFO: Checking %s for attachments every %v.", redactWatchDir(mailURL), mailInterval)
+		go runMailIngester(mailURL)
+	}
+
 	// --- Static File Handlers ---
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
@@ -382,8 +1107,34 @@ func main() {
 
 	// --- API Handlers ---
 	http.HandleFunc("/api/upload", uploadHandler)
+	http.HandleFunc("/api/upload/chunked", chunkedUploadHandler)
+	http.HandleFunc("/api/upload/chunked/", chunkedUploadHandler)
+	http.HandleFunc("/api/upload-url", uploadURLHandler)
+	http.HandleFunc("/api/import-url", uploadURLHandler)
+	http.HandleFunc("/api/import/s3", s3ImportHandler)
+	http.HandleFunc("/api/import/google-sheet", googleSheetImportHandler)
+	http.HandleFunc("/api/import/json", jsonImportHandler)
+	http.HandleFunc("/api/import/pdf", pdfImportHandler)
+	http.HandleFunc("/api/import/db", dbImportHandler)
+	http.HandleFunc("/api/paste", pasteHandler)
 	http.HandleFunc("/api/match", matchHandler)
 	http.HandleFunc("/api/data/", dataHandler)
+	http.HandleFunc("/api/dataset/", datasetHandler)
+	http.HandleFunc("/api/sheets", sheetsHandler)
+	http.HandleFunc("/api/sheets/search", searchSheetsHandler)
+	http.HandleFunc("/api/snapshot", snapshotHandler)
+	http.HandleFunc("/api/export", exportHandler)
+	http.HandleFunc("/api/exceptions/export", exceptionsExportHandler)
+	http.HandleFunc("/api/diff-sheets", diffHandler)
+	http.HandleFunc("/api/align", alignHandler)
+	http.HandleFunc("/api/profile", profileHandler)
+	http.HandleFunc("/api/cancel/", cancelHandler)
+	http.HandleFunc("/api/results/", resultsHandler)
+	http.HandleFunc("/api/evaluate", evaluateHandler)
+	http.HandleFunc("/api/sweep", sweepHandler)
+	if metricsEnabled {
+		http.HandleFunc("/metrics", metricsHandler)
+	}
 
 	port := "8080"
 	ip := getOutboundIP()
@@ -393,5 +1144,5 @@ func main() {
 	log.Printf("INFO: Access at: http://%s:%s", ip, port)
 	log.Printf("INFO: Also available at: http://localhost:%s", port)
 	log.Printf("=====================================================")
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, countErrors(http.DefaultServeMux)))
 }
\ No newline at end of file
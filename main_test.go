@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// putSheets adds sheets to the store under their keys for the rest of the test.
+func putSheets(t *testing.T, sheets map[string]SheetData) {
+	t.Helper()
+	storeMutex.Lock()
+	for key, data := range sheets {
+		dataStore[key] = data
+	}
+	storeMutex.Unlock()
+	t.Cleanup(func() {
+		storeMutex.Lock()
+		for key := range sheets {
+			delete(dataStore, key)
+		}
+		storeMutex.Unlock()
+	})
+}
+
+// serveJSON runs handler on a request with body encoded as JSON, sent as is when it is a
+// string, or none when it is nil.
+func serveJSON(handler http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if text, ok := body.(string); ok {
+		buf.WriteString(text)
+	} else if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(method, target, &buf))
+	return w
+}
+
+// runMatch posts req to matchHandler and decodes the groups it returns.
+func runMatch(t *testing.T, req MatchRequest) []MatchGroup {
+	t.Helper()
+	w := serveJSON(matchHandler, "POST", "/api/match", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("match: %d %s", w.Code, w.Body)
+	}
+	return decodeGroups(t, w)
+}
+
+// decodeGroups decodes the groups of a match response.
+func decodeGroups(t *testing.T, w *httptest.ResponseRecorder) []MatchGroup {
+	t.Helper()
+	var groups []MatchGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &groups); err != nil {
+		t.Fatal(err)
+	}
+	return groups
+}
+
+func TestPageRows(t *testing.T) {
+	rows := [][]string{{"a"}, {"b"}, {"c"}, {"d"}}
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          [][]string
+		wantOffset    int
+	}{
+		{"first page", 0, 2, rows[:2], 0},
+		{"middle page", 1, 2, rows[1:3], 1},
+		{"last partial page", 3, 2, rows[3:], 3},
+		{"no limit", 1, -1, rows[1:], 1},
+		{"zero limit", 2, 0, rows[2:2], 2},
+		{"negative offset", -5, 1, rows[:1], 0},
+		{"offset past end", 10, 2, rows[4:], 4},
+		{"huge limit", 1, math.MaxInt, rows[1:], 1},
+		{"huge offset and limit", math.MaxInt, math.MaxInt, rows[4:], 4},
+		{"most negative offset", math.MinInt, math.MaxInt, rows, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset := tt.offset
+			got := pageRows(rows, &offset, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pageRows(%d, %d) = %q, want %q", tt.offset, tt.limit, got, tt.want)
+			}
+			if offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", offset, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestParseWorkbookOLEFiles(t *testing.T) {
+	legacy, err := os.ReadFile("testdata/float.xls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := excelize.NewFile(excelize.Options{Password: "secret"})
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"id"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{1})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := buf.Bytes()
+
+	tests := []struct {
+		name         string
+		data         []byte
+		password     string
+		wantPassword bool // a password error
+		wantSheets   bool
+	}{
+		{"an .xls without its extension is read as one", legacy, "", false, true},
+		{"an encrypted workbook needs its password", encrypted, "", true, false},
+		{"an encrypted workbook opens with its password", encrypted, "secret", false, true},
+		{"a wrong password is reported as such", encrypted, "wrong", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.data[:8], oleSignature) {
+				t.Fatal("test file is not an OLE compound file")
+			}
+			up, err := parseWorkbook(tt.data, uploadOptions{Password: tt.password})
+			if isPasswordError(err) != tt.wantPassword {
+				t.Fatalf("error %v, want a password error: %v", err, tt.wantPassword)
+			}
+			if tt.wantSheets && (err != nil || len(up.names) == 0) {
+				t.Fatalf("got %v sheets, error %v; want sheets", up.names, err)
+			}
+		})
+	}
+}
+
+func TestIngestUploadParseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantMsg    string
+	}{
+		{"a parse error says what failed", errors.New("parsing delimited file: bare quote"), http.StatusBadRequest,
+			"Upload could not be parsed: parsing delimited file: bare quote"},
+		{"a missing password is unprocessable", errPasswordRequired, http.StatusUnprocessableEntity,
+			"Upload could not be parsed: " + errPasswordRequired.Error()},
+		{"a limit error is passed on as is", limitError("too many rows"), http.StatusRequestEntityTooLarge, "too many rows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := func([]byte, uploadOptions) (parsedUpload, error) { return parsedUpload{}, tt.err }
+			_, status, err := ingestUpload([]byte("x"), uploadOptions{Dataset: "parse-error-test"}, parse, http.StatusBadRequest)
+			if err == nil || status != tt.wantStatus || err.Error() != tt.wantMsg {
+				t.Fatalf("got %d %v, want %d %q", status, err, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// withBrokenSheet returns a workbook of sheets Good and Bad whose Bad sheet holds a cell
+// reference beyond the last Excel column.
+func withBrokenSheet(t *testing.T) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "Good")
+	f.SetSheetRow("Good", "A1", &[]interface{}{"id"})
+	f.SetSheetRow("Good", "A2", &[]interface{}{1})
+	f.NewSheet("Bad")
+	f.SetSheetRow("Bad", "A1", &[]interface{}{"id"})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, entry := range zr.File {
+		w, _ := zw.Create(entry.Name)
+		if entry.Name == "xl/worksheets/sheet2.xml" {
+			w.Write([]byte(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="A1" t="str"><v>id</v></c><c r="ZZZZ1" t="str"><v>x</v></c></row></sheetData></worksheet>`))
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, rc)
+		rc.Close()
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestUploadReportsSheetErrors(t *testing.T) {
+	data := withBrokenSheet(t)
+	tests := []struct {
+		name          string
+		sheets        []string
+		wantErrSheets []string
+	}{
+		{"the unreadable sheet is reported and the other kept", nil, []string{"Bad"}},
+		{"a sheet left out by the filter is not read", []string{"Good"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := "sheet-error-test"
+			defer func() {
+				storeMutex.Lock()
+				removeDatasetLocked(dataset)
+				storeMutex.Unlock()
+			}()
+			res, status, err := ingestUpload(data, uploadOptions{Dataset: dataset, Filename: "book.xlsx", Sheets: tt.sheets}, parseWorkbook, http.StatusBadRequest)
+			if err != nil {
+				t.Fatalf("%d %v", status, err)
+			}
+			var errSheets []string
+			for _, e := range res.SheetErrors {
+				if e.Error == "" {
+					t.Errorf("sheet %s reported without its error", e.Sheet)
+				}
+				errSheets = append(errSheets, e.Sheet)
+			}
+			if !reflect.DeepEqual(errSheets, tt.wantErrSheets) {
+				t.Fatalf("sheet errors %+v, want them for %q", res.SheetErrors, tt.wantErrSheets)
+			}
+			if want := []string{sheetKey(dataset, "Good")}; !reflect.DeepEqual(res.SheetNames, want) {
+				t.Fatalf("sheets %q, want %q", res.SheetNames, want)
+			}
+		})
+	}
+}
+
+func TestDropEmptySheets(t *testing.T) {
+	f := excelize.NewFile() // its default Sheet1 stays empty
+	f.NewSheet("Data")
+	f.SetSheetRow("Data", "A1", &[]interface{}{"id"})
+	f.SetSheetRow("Data", "A2", &[]interface{}{1})
+	f.NewSheet("Headers")
+	f.SetSheetRow("Headers", "A1", &[]interface{}{"id", "name"})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		keepEmpty   bool
+		wantSheets  []string
+		wantDropped []string
+	}{
+		{"the empty default sheet is dropped, the header-only one kept", false, []string{"Data", "Headers"}, []string{"Sheet1"}},
+		{"keepEmptySheets keeps it", true, []string{"Data", "Headers", "Sheet1"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := "empty-sheet-test"
+			defer func() {
+				storeMutex.Lock()
+				removeDatasetLocked(dataset)
+				storeMutex.Unlock()
+			}()
+			res, status, err := ingestUpload(buf.Bytes(), uploadOptions{Dataset: dataset, Filename: "book.xlsx", KeepEmpty: tt.keepEmpty}, parseWorkbook, http.StatusBadRequest)
+			if err != nil {
+				t.Fatalf("%d %v", status, err)
+			}
+			var sheets []string
+			for _, key := range res.SheetNames {
+				sheets = append(sheets, strings.TrimPrefix(key, sheetKey(dataset, "")))
+			}
+			if !reflect.DeepEqual(sheets, tt.wantSheets) {
+				t.Errorf("sheets %q, want %q", sheets, tt.wantSheets)
+			}
+			if !reflect.DeepEqual(res.DroppedSheets, tt.wantDropped) {
+				t.Errorf("dropped %q, want %q", res.DroppedSheets, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestLazySheetsParsedOnUse(t *testing.T) {
+	const dataset = "lazy-test"
+	defer func() {
+		storeMutex.Lock()
+		removeDatasetLocked(dataset)
+		storeMutex.Unlock()
+	}()
+	// The Bad sheet fails to parse, so an upload that read it would report it.
+	res, status, err := ingestUpload(withBrokenSheet(t), uploadOptions{Dataset: dataset, Filename: "book.xlsx", Lazy: true}, parseWorkbook, http.StatusBadRequest)
+	if err != nil {
+		t.Fatalf("%d %v", status, err)
+	}
+	if len(res.SheetErrors) != 0 || len(res.SheetNames) != 2 {
+		t.Fatalf("lazy upload gave sheets %q, errors %+v; want both sheets unread", res.SheetNames, res.SheetErrors)
+	}
+	good, bad := sheetKey(dataset, "Good"), sheetKey(dataset, "Bad")
+
+	tests := []struct {
+		name        string
+		use         func()
+		wantPending map[string]bool
+	}{
+		{"the upload parses no sheet", func() {}, map[string]bool{good: true, bad: true}},
+		{"a match parses only the sheets it uses", func() {
+			runMatch(t, MatchRequest{Sheet1: good, Sheet2: good})
+		}, map[string]bool{good: false, bad: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.use()
+			storeMutex.RLock()
+			defer storeMutex.RUnlock()
+			for key, want := range tt.wantPending {
+				pending := pendingSheets[key]
+				if _, parsed := dataStore[key]; (pending != nil) != want || parsed == want {
+					t.Errorf("%s pending %t, parsed %t; want pending %t", key, pending != nil, parsed, want)
+				}
+				if pending != nil && (pending.data.Headers != nil || pending.err != nil) {
+					t.Errorf("%s was read while pending", key)
+				}
+			}
+		})
+	}
+
+	if _, _, err := getSheet(bad); err == nil {
+		t.Error("reading the bad sheet on use gave no error")
+	}
+}
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ---------------------------------------------------------------------
+// --- Sheet & Column Lookup ---
+// ---------------------------------------------------------------------
+
+// lookupSheetPair fetches both sheets named in the request from the request's session, writing
+// a 400 if either is missing. The error names each missing sheet and suggests the closest
+// loaded sheet name.
+func lookupSheetPair(w http.ResponseWriter, r *http.Request, sheet1, sheet2 string) (SheetData, SheetData, bool) {
+	session, ok := requestSession(w, r)
+	if !ok {
+		return SheetData{}, SheetData{}, false
+	}
+	sheet1Data, ok1, err1 := getSessionSheet(session, sheet1)
+	sheet2Data, ok2, err2 := getSessionSheet(session, sheet2)
+	var problems []string
+	storeMutex.RLock()
+	for _, missing := range []struct {
+		name string
+		ok   bool
+		err  error
+	}{{sheet1, ok1, err1}, {sheet2, ok2, err2}} {
+		if missing.err != nil {
+			problems = append(problems, fmt.Sprintf("Sheet '%s' could not be read: %v.", missing.name, missing.err))
+			continue
+		}
+		if missing.ok {
+			continue
+		}
+		msg := fmt.Sprintf("Sheet '%s' not found", missing.name)
+		if suggestion := closestSheetName(session, missing.name); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+		}
+		problems = append(problems, msg+".")
+	}
+	storeMutex.RUnlock()
+
+	if len(problems) > 0 {
+		log.Printf("ERROR: One or both sheets not found: %s, %s", sheet1, sheet2)
+		http.Error(w, strings.Join(problems, " "), http.StatusBadRequest)
+		return SheetData{}, SheetData{}, false
+	}
+	return sheet1Data, sheet2Data, true
+}
+
+// closestSheetName returns the sheet name visible to the session nearest to name by edit
+// distance, or "" if nothing is close enough to be a plausible typo. Callers must hold storeMutex.
+func closestSheetName(session, name string) string {
+	key := standardKey(name)
+	best, bestDist := "", -1
+	consider := func(candidate string) {
+		if !inScope(session, candidate) && !inScope("", candidate) {
+			return
+		}
+		candidate = unscopedKey(session, candidate)
+		dist := levenshteinDistance(key, standardKey(candidate))
+		if bestDist < 0 || dist < bestDist || (dist == bestDist && candidate < best) {
+			best, bestDist = candidate, dist
+		}
+	}
+	for candidate := range dataStore {
+		consider(candidate)
+	}
+	for candidate := range pendingSheets {
+		consider(candidate)
+	}
+	if bestDist < 0 || bestDist*2 > max(len(key), 4) {
+		return ""
+	}
+	return best
+}
+
+// minIDUniqueness is the minimum share of distinct values a column needs to serve as a row ID.
+const minIDUniqueness = 0.95
+
+// findColumn returns the index of the header matching name (case-insensitive, trimmed), or -1.
+func findColumn(headers []string, name string) int {
+	key := standardKey(name)
+	for i, h := range headers {
+		if standardKey(h) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// cellValue returns the cell at col, or "" when the row is shorter.
+func cellValue(row []string, col int) string {
+	if col < 0 || col >= len(row) {
+		return ""
+	}
+	return row[col]
+}
+
+// cellRef returns the A1-style reference ("C5", "AA12") of a 0-based column and 1-based Excel row.
+func cellRef(col, row int) string {
+	cell, _ := excelize.CoordinatesToCellName(col+1, row)
+	return cell
+}
+
+// resolveIDColumn locates the named ID column and checks that its values are reasonably unique.
+// An empty name disables IDs for that sheet and returns -1.
+func resolveIDColumn(sheet string, data SheetData, name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	col := findColumn(data.Headers, name)
+	if col < 0 {
+		return -1, fmt.Errorf("ID column '%s' not found in sheet '%s'", name, sheet)
+	}
+
+	seen := make(map[string]struct{}, len(data.Rows))
+	nonEmpty := 0
+	for _, row := range data.Rows {
+		key := standardKey(cellValue(row, col))
+		if key == "" {
+			continue
+		}
+		nonEmpty++
+		seen[key] = struct{}{}
+	}
+	if nonEmpty == 0 || float64(len(seen)) < float64(nonEmpty)*minIDUniqueness {
+		return -1, fmt.Errorf("ID column '%s' in sheet '%s' is not unique enough (%d distinct of %d values)", name, sheet, len(seen), nonEmpty)
+	}
+	return col, nil
+}
+
+// ---------------------------------------------------------------------
+// --- Row Sources ---
+// ---------------------------------------------------------------------
+
+// RowSource yields the data rows of a sheet in order, so the engine does not depend on how a
+// sheet's rows are held.
+type RowSource interface {
+	// NextRow returns the next row, or false once the source is exhausted.
+	NextRow() ([]string, bool)
+}
+
+// sliceRowSource iterates an already parsed sheet. It is the default source.
+type sliceRowSource struct {
+	rows [][]string
+	pos  int
+}
+
+func newSliceRowSource(rows [][]string) *sliceRowSource {
+	return &sliceRowSource{rows: rows}
+}
+
+func (s *sliceRowSource) NextRow() ([]string, bool) {
+	if s.pos >= len(s.rows) {
+		return nil, false
+	}
+	row := s.rows[s.pos]
+	s.pos++
+	return row, true
+}
+
+// matchSide describes one side of a comparison.
+type matchSide struct {
+	Headers []string
+	Source  RowSource
+	IDCol   int          // -1 when no ID column is designated
+	Keys    []normalizer // per column key functions
+	Fills   [][]string   // cell fill colors by data row; only needed for MatchRequest.ColorMode
+
+	FirstRow int // 1-based Excel row of the first data row, used for reported row numbers
+}
+
+// matchIndex holds the sheet2 rows together with a per-column key map. It is built
+// one row at a time, as the sheet2 source yields them.
+type matchIndex struct {
+	rows    [][]string
+	keys    [][]string         // normalized keys, parallel to rows
+	keyMaps []map[string][]int // per column: normalized key -> 0-based row indices
+	norm    []normalizer
+
+	// Length blocking for fuzzy matching: per column, key byte length -> 0-based row indices
+	// (ascending), plus the sorted distinct lengths seen.
+	lenBuckets []map[int][]int
+	lengths    [][]int
+}
+
+func newMatchIndex(norm []normalizer) *matchIndex {
+	ix := &matchIndex{
+		keyMaps:    make([]map[string][]int, len(norm)),
+		norm:       norm,
+		lenBuckets: make([]map[int][]int, len(norm)),
+		lengths:    make([][]int, len(norm)),
+	}
+	for c := range ix.keyMaps {
+		ix.keyMaps[c] = make(map[string][]int)
+		ix.lenBuckets[c] = make(map[int][]int)
+	}
+	return ix
+}
+
+// add appends a row to the index and registers its non-empty cells by key.
+func (ix *matchIndex) add(row []string) {
+	rowIdx := len(ix.rows)
+	n := len(row)
+	if n > len(ix.norm) {
+		n = len(ix.norm)
+	}
+	keys := make([]string, n)
+	for c := range keys {
+		keys[c] = ix.norm[c](row[c])
+		if keys[c] != "" {
+			ix.keyMaps[c][keys[c]] = append(ix.keyMaps[c][keys[c]], rowIdx)
+		}
+
+		l := len(keys[c])
+		if _, seen := ix.lenBuckets[c][l]; !seen {
+			pos := sort.SearchInts(ix.lengths[c], l)
+			ix.lengths[c] = append(ix.lengths[c], 0)
+			copy(ix.lengths[c][pos+1:], ix.lengths[c][pos:])
+			ix.lengths[c][pos] = l
+		}
+		ix.lenBuckets[c][l] = append(ix.lenBuckets[c][l], rowIdx)
+	}
+	ix.rows = append(ix.rows, row)
+	ix.keys = append(ix.keys, keys)
+}
+
+// fuzzyCandidates returns, in ascending row order, the rows whose key in column c has a length
+// that can still satisfy the threshold against a key of length len1: a pair can only match when
+// |len1-len2|*100 <= max(len1, len2)*threshold, because the edit distance is at least the length gap.
+func (ix *matchIndex) fuzzyCandidates(c, len1, threshold int) []int {
+	var candidates []int
+	buckets := 0
+	for _, len2 := range ix.lengths[c] {
+		gap := len1 - len2
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap*100 > max(len1, len2)*threshold {
+			continue
+		}
+		candidates = append(candidates, ix.lenBuckets[c][len2]...)
+		buckets++
+	}
+	if buckets > 1 {
+		sort.Ints(candidates)
+	}
+	return candidates
+}
+
+// firstOccurrence reports whether row r (0-based) is the first row holding its non-blank key in column c.
+func (ix *matchIndex) firstOccurrence(r, c int) bool {
+	key := ix.keys[r][c]
+	return key != "" && ix.keyMaps[c][key][0] == r
+}
+
+// candidates returns the rows to score with a fuzzy algorithm for a key of length len1 in
+// column c, in ascending row order: length-blocked when the algorithm allows it, otherwise
+// every row that has a value in that column.
+func (ix *matchIndex) candidates(alg *fuzzyAlgorithm, c, len1, threshold int) []int {
+	if alg.lengthBlocked {
+		return ix.fuzzyCandidates(c, len1, threshold)
+	}
+	rows := make([]int, 0, len(ix.keys))
+	for r, keys := range ix.keys {
+		if c < len(keys) {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// ---------------------------------------------------------------------
+// --- Matching ---
+// ---------------------------------------------------------------------
+
+// findMatches runs the all-to-all column comparison over two stored sheets, or the composite
+// key or weighted comparison when the request has KeyColumns, and returns the match groups along with the
+// number of column pairs compared. Errors indicate an invalid request,
+// or ctx's error if it ends first.
+func findMatches(ctx context.Context, req MatchRequest, sheet1Data, sheet2Data SheetData) ([]MatchGroup, int, error) {
+	if err := validateSimilarityFormat(req.SimilarityFormat); err != nil {
+		return nil, 0, err
+	}
+	if err := validateColorMode(req.ColorMode, map[string]SheetData{req.Sheet1: sheet1Data, req.Sheet2: sheet2Data}); err != nil {
+		return nil, 0, err
+	}
+	algorithm, err := resolveAlgorithm(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := validateAlgorithmOptions(req); err != nil {
+		return nil, 0, err
+	}
+	if err := validateScoring(req); err != nil {
+		return nil, 0, err
+	}
+	if err := validateAssignment(req.Assignment); err != nil {
+		return nil, 0, err
+	}
+	// From here on the algorithm is canonical and UseFuzzy says whether it has a fuzzy pass.
+	req.Algorithm = algorithm
+	req.UseFuzzy = fuzzyAlgorithms[algorithm] != nil
+
+	if err := validateColumnPairs(req, sheet1Data.Headers, sheet2Data.Headers); err != nil {
+		return nil, 0, err
+	}
+
+	idCol1, err := resolveIDColumn(req.Sheet1, sheet1Data, req.IDColumn1)
+	if err != nil {
+		return nil, 0, err
+	}
+	idCol2, err := resolveIDColumn(req.Sheet2, sheet2Data, req.IDColumn2)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	side1 := matchSide{
+		Headers: sheet1Data.Headers, Source: newSliceRowSource(sheet1Data.Rows), IDCol: idCol1,
+		Keys: req.Normalize.columnNormalizers(sheet1Data), Fills: sheet1Data.Fills, FirstRow: sheet1Data.rowNumber(0),
+	}
+	side2 := matchSide{
+		Headers: sheet2Data.Headers, Source: newSliceRowSource(sheet2Data.Rows), IDCol: idCol2,
+		Keys: req.Normalize.columnNormalizers(sheet2Data), Fills: sheet2Data.Fills, FirstRow: sheet2Data.rowNumber(0),
+	}
+	var groups []MatchGroup
+	var comparisons int
+	switch {
+	case len(req.KeyColumns) > 0 && (req.ColorMode != "" || req.IsTargeted || len(req.ColumnPairs) > 0):
+		return nil, 0, fmt.Errorf("keyColumns cannot be combined with colorMode, isTargeted or columnPairs")
+	case req.Scoring == scoringWeighted:
+		groups, comparisons, err = weightedMatches(ctx, req, side1, side2, sheet1Data, sheet2Data)
+	case len(req.KeyColumns) > 0:
+		var keyStart [2]int
+		if side1, side2, keyStart, err = compositeSides(req, sheet1Data, sheet2Data, idCol1, idCol2); err != nil {
+			return nil, 0, err
+		}
+		if groups, comparisons, err = matchSources(ctx, req, side1, side2); err == nil {
+			finishCompositeGroups(groups, keyStart)
+		}
+	default:
+		groups, comparisons, err = matchSources(ctx, req, side1, side2)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if req.BestMatchOnly {
+		keepBestMatches(groups, req.IncludeRunnersUp)
+	}
+	if req.Assignment != "" {
+		if groups, err = assignOneToOne(groups, req.Assignment); err != nil {
+			return nil, 0, err
+		}
+	}
+	groups = limitGroups(groups, req.MinGroupSize, req.MaxGroups)
+	if err := sortMatches(groups, req.SortBy, req.SortOrder, req.SortGroups); err != nil {
+		return nil, 0, err
+	}
+	if req.IncludeCellRefs {
+		addCellRefs(groups)
+	}
+	return groups, comparisons, nil
+}
+
+// addCellRefs fills in the A1-style cell reference of both values of every match.
+func addCellRefs(groups []MatchGroup) {
+	for _, g := range groups {
+		for i := range g.Matches {
+			m := &g.Matches[i]
+			m.Cell1 = cellRef(g.col1, m.OriginalRow1)
+			m.Cell2 = cellRef(g.col2, m.OriginalRow2)
+		}
+	}
+}
+
+// keepBestMatches reduces each group to the highest scoring match per sheet1 row (the first one
+// in scan order on ties), optionally attaching up to runnersUp of the discarded candidates, best first.
+func keepBestMatches(groups []MatchGroup, runnersUp int) {
+	for gi := range groups {
+		g := &groups[gi]
+		byRow := make(map[int][]MatchResult)
+		var order []int
+		for _, m := range g.Matches {
+			if _, ok := byRow[m.OriginalRow1]; !ok {
+				order = append(order, m.OriginalRow1)
+			}
+			byRow[m.OriginalRow1] = append(byRow[m.OriginalRow1], m)
+		}
+
+		best := make([]MatchResult, 0, len(order))
+		for _, row := range order {
+			candidates := byRow[row]
+			sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+			m := candidates[0]
+			for _, c := range candidates[1:] {
+				if len(m.RunnersUp) >= runnersUp {
+					break
+				}
+				m.RunnersUp = append(m.RunnersUp, RunnerUp{
+					OriginalRow2: c.OriginalRow2, Val2: c.Val2, IsFuzzy: c.IsFuzzy, ID2: c.ID2, Similarity: c.Similarity,
+				})
+			}
+			best = append(best, m)
+		}
+		g.Matches = best
+	}
+}
+
+// limitGroups drops groups smaller than minSize and, when maxGroups is set, keeps only the
+// largest maxGroups groups ordered by match count (ties keep their column order).
+func limitGroups(groups []MatchGroup, minSize, maxGroups int) []MatchGroup {
+	if minSize > 1 {
+		kept := groups[:0]
+		for _, g := range groups {
+			if len(g.Matches) >= minSize {
+				kept = append(kept, g)
+			}
+		}
+		groups = kept
+	}
+	if maxGroups > 0 && len(groups) > 0 {
+		sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Matches) > len(groups[j].Matches) })
+		if len(groups) > maxGroups {
+			groups = groups[:maxGroups]
+		}
+	}
+	return groups
+}
+
+// sortMatches orders each group's matches by similarity, row or value. Sorting is stable, so ties
+// keep scan order and results stay deterministic. With acrossGroups the groups are then ordered
+// by their first match.
+func sortMatches(groups []MatchGroup, by, order string, acrossGroups bool) error {
+	var less func(a, b MatchResult) bool
+	byRow := func(a, b MatchResult) bool {
+		if a.OriginalRow1 != b.OriginalRow1 {
+			return a.OriginalRow1 < b.OriginalRow1
+		}
+		return a.OriginalRow2 < b.OriginalRow2
+	}
+	switch by {
+	case "":
+		return nil
+	case "similarity":
+		less = func(a, b MatchResult) bool { return a.score < b.score }
+	case "row":
+		less = byRow
+	case "value":
+		less = func(a, b MatchResult) bool {
+			if a.Val1 != b.Val1 {
+				return a.Val1 < b.Val1
+			}
+			return a.Val2 < b.Val2
+		}
+	default:
+		return fmt.Errorf("unknown sortBy '%s' (expected similarity, row or value)", by)
+	}
+
+	desc := by == "similarity"
+	switch order {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		return fmt.Errorf("unknown sortOrder '%s' (expected asc or desc)", order)
+	}
+	if desc {
+		asc := less
+		less = func(a, b MatchResult) bool { return asc(b, a) }
+	}
+
+	for _, g := range groups {
+		sort.SliceStable(g.Matches, func(i, j int) bool { return less(g.Matches[i], g.Matches[j]) })
+	}
+	if acrossGroups {
+		sort.SliceStable(groups, func(i, j int) bool { return less(groups[i].Matches[0], groups[j].Matches[0]) })
+	}
+	return nil
+}
+
+// matchSources is the match engine. Sheet2 rows are fed into the index as they arrive;
+// sheet1 rows are then streamed against it, so neither side has to be a materialized slice.
+// A row pair is reported at most once, under the first column pair (in header order) that matches it.
+// It checks ctx between rows and stops with its error once ctx ends.
+func matchSources(ctx context.Context, req MatchRequest, side1, side2 matchSide) ([]MatchGroup, int, error) {
+	numCols1 := len(side1.Headers)
+	numCols2 := len(side2.Headers)
+
+	index := newMatchIndex(side2.Keys)
+	for row2, ok := side2.Source.NextRow(); ok; row2, ok = side2.Source.NextRow() {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		index.add(row2)
+	}
+
+	selected, comparisons := selectColumnPairs(req, side1.Headers, side2.Headers)
+	colorOK := colorFilter(req.ColorMode, side1.Fills, side2.Fills)
+	fuzzy := fuzzyAlgorithms[req.Algorithm]
+	params := newScoreParams(req)
+	scorers := make([]scoreFunc, numCols2) // per sheet2 column, prepared on first use
+
+	pairMatches := make([][]MatchResult, numCols1*numCols2)
+	matchedPairs := make(map[[2]int]struct{})
+
+	// With DistinctOnly, only the first row holding a value takes part, on either side,
+	// and blank cells are not values at all.
+	var seen1 []map[string]bool
+	if req.DistinctOnly {
+		seen1 = make([]map[string]bool, numCols1)
+		for c := range seen1 {
+			seen1[c] = make(map[string]bool)
+		}
+	}
+
+	r1 := 0
+	for row1, ok := side1.Source.NextRow(); ok; row1, ok = side1.Source.NextRow() {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		row1Idx := r1 + side1.FirstRow
+		r1++
+
+		for c1 := 0; c1 < numCols1; c1++ {
+			if c1 >= len(row1) {
+				continue
+			}
+			val1 := row1[c1]
+			key1 := side1.Keys[c1](val1)
+			if seen1 != nil {
+				if key1 == "" || seen1[c1][key1] {
+					continue
+				}
+				seen1[c1][key1] = true
+			}
+
+			for c2 := 0; c2 < numCols2; c2++ {
+				if !selected[c1*numCols2+c2] {
+					continue
+				}
+				matches := pairMatches[c1*numCols2+c2]
+
+				// 1. Exact/Standard Match
+				exactRows := index.keyMaps[c2][key1]
+				if req.DistinctOnly && len(exactRows) > 1 {
+					exactRows = exactRows[:1]
+				}
+				for _, r2 := range exactRows {
+					row2Idx := r2 + side2.FirstRow
+					pairKey := [2]int{row1Idx, row2Idx}
+					if _, exists := matchedPairs[pairKey]; exists {
+						continue
+					}
+					if colorOK != nil && !colorOK(r1-1, c1, r2, c2) {
+						continue
+					}
+
+					row2 := index.rows[r2]
+					matches = append(matches, MatchResult{
+						OriginalRow1: row1Idx,
+						OriginalRow2: row2Idx,
+						Val1:         val1,
+						Val2:         row2[c2],
+						IsFuzzy:      false,
+						ID1:          cellValue(row1, side1.IDCol),
+						ID2:          cellValue(row2, side2.IDCol),
+						Similarity:   formatSimilarity(req.SimilarityFormat, 0, 1),
+						score:        1,
+					})
+					matchedPairs[pairKey] = struct{}{}
+				}
+
+				// 2. Fuzzy Match (Only if enabled)
+				if fuzzy != nil {
+					if scorers[c2] == nil {
+						scorers[c2] = fuzzy.columnScorer(index, c2, params)
+					}
+					for _, r2 := range index.candidates(fuzzy, c2, len(key1), req.FuzzyThreshold) {
+						row2 := index.rows[r2]
+						row2Idx := r2 + side2.FirstRow
+						pairKey := [2]int{row1Idx, row2Idx}
+						if _, exists := matchedPairs[pairKey]; exists {
+							continue
+						}
+						if colorOK != nil && !colorOK(r1-1, c1, r2, c2) {
+							continue
+						}
+
+						val2 := row2[c2]
+						key2 := index.keys[r2][c2]
+						if req.DistinctOnly && !index.firstOccurrence(r2, c2) {
+							continue
+						}
+
+						if dist, ratio, ok := scorers[c2](key1, key2, params); ok {
+							matches = append(matches, MatchResult{
+								OriginalRow1: row1Idx,
+								OriginalRow2: row2Idx,
+								Val1:         val1,
+								Val2:         val2,
+								IsFuzzy:      true,
+								ID1:          cellValue(row1, side1.IDCol),
+								ID2:          cellValue(row2, side2.IDCol),
+								Similarity:   formatSimilarity(req.SimilarityFormat, dist, ratio),
+								Algorithm:    req.Algorithm,
+								score:        ratio,
+							})
+							matchedPairs[pairKey] = struct{}{}
+						}
+					}
+				}
+
+				pairMatches[c1*numCols2+c2] = matches
+			}
+		}
+	}
+
+	allMatches := make([]MatchGroup, 0)
+	for c1 := 0; c1 < numCols1; c1++ {
+		for c2 := 0; c2 < numCols2; c2++ {
+			matches := pairMatches[c1*numCols2+c2]
+			if len(matches) > 0 {
+				allMatches = append(allMatches, MatchGroup{
+					Tab1: req.Sheet1, Tab2: req.Sheet2,
+					Header1: side1.Headers[c1], Header2: side2.Headers[c2],
+					Matches: matches,
+					col1:    c1, col2: c2,
+				})
+			}
+		}
+	}
+
+	return allMatches, comparisons, nil
+}
+
+// ColumnPair names a sheet1 column and the sheet2 column to compare it with.
+type ColumnPair struct {
+	Col1 string `json:"col1"`
+	Col2 string `json:"col2"`
+}
+
+// validateColumnPairs rejects column pairs naming headers the sheets do not have.
+func validateColumnPairs(req MatchRequest, headers1, headers2 []string) error {
+	for _, pair := range req.ColumnPairs {
+		if findColumn(headers1, pair.Col1) < 0 {
+			return fmt.Errorf("column '%s' not found in sheet '%s'", pair.Col1, req.Sheet1)
+		}
+		if findColumn(headers2, pair.Col2) < 0 {
+			return fmt.Errorf("column '%s' not found in sheet '%s'", pair.Col2, req.Sheet2)
+		}
+	}
+	return nil
+}
+
+// selectColumnPairs decides which (c1, c2) column pairs take part in matching, indexed as
+// c1*len(headers2)+c2, and returns how many were selected. Explicit ColumnPairs select exactly
+// those pairs. Otherwise all-to-all mode selects every pair, and targeted mode selects only
+// pairs of non-blank headers that agree after standardKey normalization, or (with fuzzy
+// matching on) whose headers are a fuzzy match under the request threshold.
+func selectColumnPairs(req MatchRequest, headers1, headers2 []string) ([]bool, int) {
+	selected := make([]bool, len(headers1)*len(headers2))
+	count := 0
+	if len(req.ColumnPairs) > 0 {
+		for _, pair := range req.ColumnPairs {
+			c1, c2 := findColumn(headers1, pair.Col1), findColumn(headers2, pair.Col2)
+			if c1 >= 0 && c2 >= 0 && !selected[c1*len(headers2)+c2] {
+				selected[c1*len(headers2)+c2] = true
+				count++
+			}
+		}
+		log.Printf("INFO: Comparing %d requested column pair(s) of %d.", count, len(selected))
+		return selected, count
+	}
+	for c1, h1 := range headers1 {
+		for c2, h2 := range headers2 {
+			key1, key2 := standardKey(h1), standardKey(h2)
+			ok := !req.IsTargeted || (key1 != "" && key2 != "" &&
+				(key1 == key2 || (req.UseFuzzy && isFuzzyKeyMatch(key1, key2, req.FuzzyThreshold))))
+			if ok {
+				selected[c1*len(headers2)+c2] = true
+				count++
+			}
+		}
+	}
+	if req.IsTargeted {
+		log.Printf("INFO: Targeted matching selected %d of %d column pairs.", count, len(selected))
+	}
+	return selected, count
+}
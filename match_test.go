@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chanSource is a RowSource fed by a goroutine, as a parser still reading a file would feed it.
+type chanSource <-chan []string
+
+func (c chanSource) NextRow() ([]string, bool) {
+	row, ok := <-c
+	return row, ok
+}
+
+// feed sends rows one at a time from a separate goroutine.
+func feed(rows [][]string) chanSource {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		for _, row := range rows {
+			ch <- row
+		}
+	}()
+	return ch
+}
+
+func TestMatchSourcesIncremental(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Name", "City"}, Rows: [][]string{
+		{"Alice", "Paris"}, {"Bob", "Rome"}, {"Carol", "Oslo"}, {"", "Lima"}, {"alice", "Paris"},
+	}}
+	sheet2 := SheetData{Headers: []string{"Client", "Town"}, Rows: [][]string{
+		{"Alicia", "Paris"}, {"Bob", "Roma"}, {"Dave", "Oslo"}, {"carol"},
+	}}
+	tests := []struct {
+		name string
+		req  MatchRequest
+	}{
+		{"exact", MatchRequest{Sheet1: "A", Sheet2: "B", Algorithm: algorithmExact}},
+		{"levenshtein", MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, Algorithm: algorithmLevenshtein, FuzzyThreshold: 2}},
+		{"token", MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, Algorithm: algorithmToken, FuzzyThreshold: 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			side := func(data SheetData, source RowSource) matchSide {
+				return matchSide{
+					Headers: data.Headers, Source: source, IDCol: -1,
+					Keys: tt.req.Normalize.columnNormalizers(data), FirstRow: data.rowNumber(0),
+				}
+			}
+			batch, batchN, err := matchSources(context.Background(), tt.req,
+				side(sheet1, newSliceRowSource(sheet1.Rows)), side(sheet2, newSliceRowSource(sheet2.Rows)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamed, streamedN, err := matchSources(context.Background(), tt.req,
+				side(sheet1, feed(sheet1.Rows)), side(sheet2, feed(sheet2.Rows)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(batch) == 0 {
+				t.Fatal("no matches; the case tests nothing")
+			}
+			if !reflect.DeepEqual(streamed, batch) || streamedN != batchN {
+				t.Errorf("incremental sources gave %+v (%d comparisons), batch %+v (%d)", streamed, streamedN, batch, batchN)
+			}
+		})
+	}
+}
+
+// idPairs returns the ID1->ID2 pairs of every match in the groups.
+func idPairs(groups []MatchGroup) map[string]string {
+	pairs := make(map[string]string)
+	for _, g := range groups {
+		for _, m := range g.Matches {
+			pairs[m.ID1] = m.ID2
+		}
+	}
+	return pairs
+}
+
+func TestMatchIDColumns(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Key", "Email"}, Rows: [][]string{{"k1", "a@x.com"}, {"k2", "b@x.com"}, {"k3", "c@x.com"}}}
+	sheet2 := SheetData{Headers: []string{"Ref", "Mail"}, Rows: [][]string{{"r1", "c@x.com"}, {"r2", "a@x.com"}, {"r3", "b@x.com"}}}
+	reordered := SheetData{Headers: sheet2.Headers, Rows: [][]string{sheet2.Rows[2], sheet2.Rows[0], sheet2.Rows[1]}}
+	dupes := SheetData{Headers: sheet2.Headers, Rows: [][]string{{"r1", "c@x.com"}, {"r1", "a@x.com"}, {"r1", "b@x.com"}}}
+	want := map[string]string{"k1": "r2", "k2": "r3", "k3": "r1"}
+
+	tests := []struct {
+		name    string
+		sheet2  SheetData
+		id2     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"IDs are reported for both rows", sheet2, "Ref", want, false},
+		{"IDs survive a reorder of the rows", reordered, "Ref", want, false},
+		{"an ID column missing from the sheet is refused", sheet2, "Nope", nil, true},
+		{"a column of repeated values is refused as an ID", dupes, "Ref", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", IDColumn1: "Key", IDColumn2: tt.id2, ColumnPairs: []ColumnPair{{Col1: "Email", Col2: "Mail"}}}
+			groups, _, err := findMatches(context.Background(), req, sheet1, tt.sheet2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(idPairs(groups), tt.want) {
+				t.Fatalf("ID pairs %v, want %v", idPairs(groups), tt.want)
+			}
+		})
+	}
+}
+
+func TestSheetNotFoundSuggestions(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"suggest/Customers": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}}},
+		"suggest/Orders":    {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}}},
+	})
+	tests := []struct {
+		name           string
+		sheet1, sheet2 string
+		want           string
+	}{
+		{"a near miss is suggested", "suggest/Custmers", "suggest/Orders",
+			"Sheet 'suggest/Custmers' not found (did you mean 'suggest/Customers'?)."},
+		{"each missing sheet is named", "suggest/Custmers", "suggest/Ordres",
+			"Sheet 'suggest/Custmers' not found (did you mean 'suggest/Customers'?). Sheet 'suggest/Ordres' not found (did you mean 'suggest/Orders'?)."},
+		{"nothing close is not suggested", "suggest/Customers", "warehouse/stock-levels-2024",
+			"Sheet 'warehouse/stock-levels-2024' not found."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveJSON(matchHandler, "POST", "/api/match", MatchRequest{Sheet1: tt.sheet1, Sheet2: tt.sheet2})
+			if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusBadRequest || got != tt.want {
+				t.Fatalf("got %d %q, want 400 %q", w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitGroups(t *testing.T) {
+	// sized returns groups named after their match counts.
+	sized := func(sizes ...int) []MatchGroup {
+		groups := make([]MatchGroup, len(sizes))
+		for i, n := range sizes {
+			groups[i] = MatchGroup{Header1: string(rune('a' + i))}
+			for j := 0; j < n; j++ {
+				groups[i].Matches = append(groups[i].Matches, MatchResult{OriginalRow1: j + 2})
+			}
+		}
+		return groups
+	}
+	tests := []struct {
+		name              string
+		sizes             []int
+		minSize, maxCount int
+		want              []string // Header1 of the groups kept, in order
+	}{
+		{"no limits keep every group in order", []int{1, 5, 3}, 0, 0, []string{"a", "b", "c"}},
+		{"MaxGroups keeps the largest", []int{1, 5, 3, 5}, 0, 2, []string{"b", "d"}},
+		{"MinGroupSize drops the tail in order", []int{1, 5, 3, 2}, 3, 0, []string{"b", "c"}},
+		{"both apply together", []int{1, 5, 3, 4}, 2, 2, []string{"b", "d"}},
+		{"MaxGroups beyond the count keeps all, sorted", []int{1, 5, 3}, 0, 10, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, g := range limitGroups(sized(tt.sizes...), tt.minSize, tt.maxCount) {
+				got = append(got, g.Header1)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// randomWords returns n seeded words of 3 to 12 letters from a small alphabet, so that many
+// pairs are within a few edits of each other.
+func randomWords(rng *rand.Rand, n int) [][]string {
+	rows := make([][]string, n)
+	for i := range rows {
+		b := make([]byte, 3+rng.Intn(10))
+		for j := range b {
+			b[j] = "abcd"[rng.Intn(4)]
+		}
+		rows[i] = []string{string(b)}
+	}
+	return rows
+}
+
+func TestLengthBlockingKeepsMatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sheet1 := SheetData{Headers: []string{"Code"}, Rows: randomWords(rng, 150)}
+	sheet2 := SheetData{Headers: []string{"Code"}, Rows: randomWords(rng, 150)}
+	for _, threshold := range []int{0, 10, 25, 50} {
+		t.Run(fmt.Sprintf("threshold %d", threshold), func(t *testing.T) {
+			// Every pair within the threshold, found by comparing all of them.
+			want := make(map[[2]int]bool)
+			for i, a := range sheet1.Rows {
+				for j, b := range sheet2.Rows {
+					if isFuzzyKeyMatch(standardKey(a[0]), standardKey(b[0]), threshold) {
+						want[[2]int{i + 2, j + 2}] = true
+					}
+				}
+			}
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, FuzzyThreshold: threshold}
+			groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[[2]int]bool)
+			for _, g := range groups {
+				for _, m := range g.Matches {
+					got[[2]int{m.OriginalRow1, m.OriginalRow2}] = true
+				}
+			}
+			if len(want) == 0 || !reflect.DeepEqual(got, want) {
+				t.Fatalf("blocked matching found %d pairs, comparing all of them %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestCellRefs(t *testing.T) {
+	tests := []struct {
+		col, row int
+		want     string
+	}{
+		{0, 2, "A2"},
+		{25, 5, "Z5"},
+		{26, 5, "AA5"},
+		{27, 10, "AB10"},
+		{51, 3, "AZ3"},
+		{701, 7, "ZZ7"},
+		{702, 7, "AAA7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := cellRef(tt.col, tt.row); got != tt.want {
+				t.Errorf("cellRef(%d, %d) = %q, want %q", tt.col, tt.row, got, tt.want)
+			}
+		})
+	}
+
+	// A match in column AB of sheet1 and column B of sheet2, whose header sits on row 3.
+	headers := make([]string, 28)
+	row := make([]string, 28)
+	for i := range headers {
+		headers[i], row[i] = fmt.Sprintf("H%d", i), fmt.Sprintf("v%d", i)
+	}
+	row[27] = "Ann"
+	sheet1 := SheetData{Headers: headers, Rows: [][]string{make([]string, 28), row}}
+	sheet2 := SheetData{Headers: []string{"ID", "Name"}, Rows: [][]string{{"1", "Ann"}}, sheetLayout: sheetLayout{HeaderRow: 3}}
+	req := MatchRequest{Sheet1: "A", Sheet2: "B", IncludeCellRefs: true, ColumnPairs: []ColumnPair{{Col1: "H27", Col2: "Name"}}}
+	groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Matches) != 1 {
+		t.Fatalf("got %+v, want one match", groups)
+	}
+	if m := groups[0].Matches[0]; m.Cell1 != "AB3" || m.Cell2 != "B4" {
+		t.Errorf("cells %s and %s, want AB3 and B4", m.Cell1, m.Cell2)
+	}
+}
+
+func TestSortMatches(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathan"}, {"Kitten"}, {"Apple"}}}
+	sheet2 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathon"}, {"Sitten"}, {"Apple"}}}
+	tests := []struct {
+		name       string
+		by, order  string
+		want       []string // Val1 in result order
+		wantScores []float64
+		wantErr    bool
+	}{
+		{"scan order by default", "", "", []string{"Jonathan", "Kitten", "Apple"}, []float64{87.5, 83.33, 100}, false},
+		{"similarity is descending by default", "similarity", "", []string{"Apple", "Jonathan", "Kitten"}, []float64{100, 87.5, 83.33}, false},
+		{"similarity ascending", "similarity", "asc", []string{"Kitten", "Jonathan", "Apple"}, []float64{83.33, 87.5, 100}, false},
+		{"value is ascending by default", "value", "", []string{"Apple", "Jonathan", "Kitten"}, []float64{100, 87.5, 83.33}, false},
+		{"row descending", "row", "desc", []string{"Apple", "Kitten", "Jonathan"}, []float64{100, 83.33, 87.5}, false},
+		{"an unknown key is refused", "score", "", nil, nil, true},
+		{"an unknown order is refused", "row", "down", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, FuzzyThreshold: 20, SortBy: tt.by, SortOrder: tt.order}
+			groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			var scores []float64
+			for _, m := range groups[0].Matches {
+				got = append(got, m.Val1)
+				scores = append(scores, m.Similarity)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(scores, tt.wantScores) {
+				t.Fatalf("order %q (%v), want %q (%v)", got, scores, tt.want, tt.wantScores)
+			}
+		})
+	}
+}
+
+func TestDistinctOnly(t *testing.T) {
+	// Low-cardinality columns: every "red" row of one sheet pairs with every "red" row of the other.
+	sheet1 := SheetData{Headers: []string{"Color"}, Rows: [][]string{{"red"}, {"blue"}, {"red"}, {"red"}, {"green"}, {"blue"}}}
+	sheet2 := SheetData{Headers: []string{"Color"}, Rows: [][]string{{"blue"}, {"red"}, {"Red"}, {"blue"}, {"teal"}}}
+	tests := []struct {
+		name     string
+		distinct bool
+		want     [][2]int // matched row pairs
+	}{
+		{"every duplicate pair is reported", false, [][2]int{{2, 3}, {2, 4}, {3, 2}, {3, 5}, {4, 3}, {4, 4}, {5, 3}, {5, 4}, {7, 2}, {7, 5}}},
+		{"distinct values match once, at their first rows", true, [][2]int{{2, 3}, {3, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", DistinctOnly: tt.distinct}
+			groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][2]int
+			for _, g := range groups {
+				for _, m := range g.Matches {
+					got = append(got, [2]int{m.OriginalRow1, m.OriginalRow2})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("pairs %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnersUp(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathan"}}}
+	sheet2 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Jonathon"}, {"Jonathan"}, {"Jnathan"}, {"Jonathans"}}}
+	all := []RunnerUp{
+		{OriginalRow2: 5, Val2: "Jonathans", IsFuzzy: true, Similarity: 88.89},
+		{OriginalRow2: 2, Val2: "Jonathon", IsFuzzy: true, Similarity: 87.5},
+		{OriginalRow2: 4, Val2: "Jnathan", IsFuzzy: true, Similarity: 87.5},
+	}
+	tests := []struct {
+		name      string
+		runnersUp int
+		want      []RunnerUp
+	}{
+		{"none unless asked for", 0, nil},
+		{"the next best, with lower scores", 2, all[:2]},
+		{"no more than were discarded", 10, all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, FuzzyThreshold: 20, BestMatchOnly: true, IncludeRunnersUp: tt.runnersUp}
+			groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(groups) != 1 || len(groups[0].Matches) != 1 {
+				t.Fatalf("got %+v, want the best match only", groups)
+			}
+			best := groups[0].Matches[0]
+			if best.OriginalRow2 != 3 || best.Similarity != 100 {
+				t.Errorf("best match row %d (%v), want the exact one on row 3", best.OriginalRow2, best.Similarity)
+			}
+			if !reflect.DeepEqual(best.RunnersUp, tt.want) {
+				t.Errorf("runners-up %+v, want %+v", best.RunnersUp, tt.want)
+			}
+			for _, r := range best.RunnersUp {
+				if r.Similarity >= best.Similarity {
+					t.Errorf("runner-up row %d scores %v, not below the best", r.OriginalRow2, r.Similarity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Metrics ---
+// ---------------------------------------------------------------------
+
+// metricsEnabled exposes /metrics in the Prometheus text format (-metrics flag).
+var metricsEnabled = false
+
+// matchDurationBuckets are the upper bounds, in seconds, of the match duration histogram.
+var matchDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// errorKey labels an error response by the route that served it and its status code.
+type errorKey struct {
+	route string
+	code  int
+}
+
+var metrics = struct {
+	sync.Mutex
+	uploads       uint64
+	matchRequests uint64
+	comparisons   uint64
+	errors        map[errorKey]uint64
+
+	durationCounts []uint64 // per bucket, non-cumulative; the last slot is +Inf
+	durationSum    float64
+}{
+	errors:         make(map[errorKey]uint64),
+	durationCounts: make([]uint64, len(matchDurationBuckets)+1),
+}
+
+// recordUpload counts a processed workbook upload.
+func recordUpload() {
+	metrics.Lock()
+	metrics.uploads++
+	metrics.Unlock()
+}
+
+// recordMatch counts a completed match request with its duration and comparison count.
+func recordMatch(elapsed time.Duration, comparisons int) {
+	seconds := elapsed.Seconds()
+	bucket := sort.SearchFloat64s(matchDurationBuckets, seconds)
+
+	metrics.Lock()
+	metrics.matchRequests++
+	metrics.comparisons += uint64(comparisons)
+	metrics.durationCounts[bucket]++
+	metrics.durationSum += seconds
+	metrics.Unlock()
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// countErrors wraps a mux and counts 4xx/5xx responses by route pattern, so every handler's
+// http.Error calls show up without each one having to report itself.
+func countErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		if rec.status < 400 {
+			return
+		}
+		_, route := mux.Handler(r)
+		metrics.Lock()
+		metrics.errors[errorKey{route, rec.status}]++
+		metrics.Unlock()
+	})
+}
+
+// metricsHandler writes all metrics in the Prometheus text exposition format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	storeMutex.RLock()
+	sheets, rows, sets := len(dataStore), 0, len(datasets)
+	for _, data := range dataStore {
+		rows += len(data.Rows)
+	}
+	storeMutex.RUnlock()
+
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	gauge := func(name, help string, v int) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+	}
+
+	counter("edms_uploads_total", "Workbook uploads processed.", metrics.uploads)
+	counter("edms_match_requests_total", "Completed /api/match requests.", metrics.matchRequests)
+	counter("edms_match_comparisons_total", "Column pair comparisons performed by /api/match.", metrics.comparisons)
+
+	fmt.Fprintf(w, "# HELP edms_match_duration_seconds Time spent matching in /api/match.\n# TYPE edms_match_duration_seconds histogram\n")
+	var cumulative uint64
+	for i, le := range matchDurationBuckets {
+		cumulative += metrics.durationCounts[i]
+		fmt.Fprintf(w, "edms_match_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += metrics.durationCounts[len(matchDurationBuckets)]
+	fmt.Fprintf(w, "edms_match_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "edms_match_duration_seconds_sum %s\n", strconv.FormatFloat(metrics.durationSum, 'g', -1, 64))
+	fmt.Fprintf(w, "edms_match_duration_seconds_count %d\n", cumulative)
+
+	fmt.Fprintf(w, "# HELP edms_http_errors_total Error responses by route and status code.\n# TYPE edms_http_errors_total counter\n")
+	keys := make([]errorKey, 0, len(metrics.errors))
+	for k := range metrics.errors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "edms_http_errors_total{route=%q,code=\"%d\"} %d\n", k.route, k.code, metrics.errors[k])
+	}
+
+	gauge("edms_store_datasets", "Datasets currently held in memory.", sets)
+	gauge("edms_store_sheets", "Sheets currently held in memory.", sheets)
+	gauge("edms_store_rows", "Data rows currently held in memory.", rows)
+}
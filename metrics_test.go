@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics serves /metrics through h and returns each sample's value by name and labels.
+func scrapeMetrics(t *testing.T, h http.Handler) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape: %d %s", w.Code, w.Body)
+	}
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+func TestMetricsCount(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"metrics/A": {Headers: []string{"Name", "City"}, Rows: [][]string{{"Ann", "Oslo"}}},
+		"metrics/B": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}}},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/match", matchHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	h := countErrors(mux)
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]float64 // increase of each sample
+	}{
+		{"a match counts the request, its comparisons and its duration",
+			`{"sheet1":"metrics/A","sheet2":"metrics/B"}`,
+			map[string]float64{"edms_match_requests_total": 1, "edms_match_comparisons_total": 2, "edms_match_duration_seconds_count": 1}},
+		{"an error is counted by route and status",
+			`{"sheet1":"metrics/A","sheet2":"metrics/Nope"}`,
+			map[string]float64{"edms_match_requests_total": 0, `edms_http_errors_total{route="/api/match",code="400"}`: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := scrapeMetrics(t, h)
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/match", strings.NewReader(tt.body)))
+			after := scrapeMetrics(t, h)
+			for name, want := range tt.want {
+				if got := after[name] - before[name]; got != want {
+					t.Errorf("%s rose by %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
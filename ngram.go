@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- N-gram Matching ---
+// ---------------------------------------------------------------------
+
+// The "ngram" algorithm compares keys as sets of character n-grams (trigrams by default),
+// taken word by word with each word padded by a space on both sides, so the grams do not
+// depend on word order: "Smith John" and "John Smith" share every trigram. The overlap of the
+// two sets is measured as a Dice coefficient, 2|A∩B| / (|A|+|B|), or as Jaccard similarity,
+// |A∩B| / |A∪B|. Its threshold is MinSimilarity, the least 0-1 similarity a pair needs; when
+// that is 0 the usual FuzzyThreshold rule applies instead.
+
+// Values for MatchRequest.NGramMeasure.
+const (
+	ngramDice    = "dice"
+	ngramJaccard = "jaccard"
+)
+
+// Bounds of MatchRequest.NGramSize; 0 means ngramDefaultSize.
+const (
+	ngramDefaultSize = 3
+	ngramMaxSize     = 8
+)
+
+// validateNGramOptions rejects n-gram settings out of range.
+func validateNGramOptions(req MatchRequest) error {
+	if req.NGramSize < 0 || req.NGramSize > ngramMaxSize {
+		return fmt.Errorf("ngramSize must be between 1 and %d", ngramMaxSize)
+	}
+	switch req.NGramMeasure {
+	case "", ngramDice, ngramJaccard:
+	default:
+		return fmt.Errorf("unknown ngramMeasure '%s' (expected dice or jaccard)", req.NGramMeasure)
+	}
+	if req.MinSimilarity < 0 || req.MinSimilarity > 1 {
+		return fmt.Errorf("minSimilarity must be between 0 and 1")
+	}
+	return nil
+}
+
+// ngramScore compares keys by the overlap of their n-gram sets.
+func ngramScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	grams1, grams2 := ngramSet(key1, p.ngramSize), ngramSet(key2, p.ngramSize)
+	if len(grams1) == 0 || len(grams2) == 0 {
+		return 0, 0, false
+	}
+	shared := 0
+	for g := range grams1 {
+		if _, ok := grams2[g]; ok {
+			shared++
+		}
+	}
+	var ratio float64
+	if p.ngramJaccard {
+		ratio = float64(shared) / float64(len(grams1)+len(grams2)-shared)
+	} else {
+		ratio = 2 * float64(shared) / float64(len(grams1)+len(grams2))
+	}
+	if p.minSimilarity > 0 {
+		if ratio < p.minSimilarity {
+			return 0, 0, false
+		}
+	} else if (1-ratio)*100 > float64(p.threshold) {
+		return 0, 0, false
+	}
+	return levenshteinDistance(key1, key2), ratio, true
+}
+
+// ngramSet returns the n-grams of a key's words, each padded with a space on both sides for
+// n > 1, so a word's first and last letters count as much as its middle ones.
+func ngramSet(key string, n int) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, word := range strings.FieldsFunc(key, notAlphanumeric) {
+		runes := []rune(word)
+		if n > 1 {
+			runes = []rune(" " + word + " ")
+		}
+		if len(runes) < n {
+			set[string(runes)] = struct{}{}
+			continue
+		}
+		for i := 0; i+n <= len(runes); i++ {
+			set[string(runes[i:i+n])] = struct{}{}
+		}
+	}
+	return set
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeOptions controls how cell values are turned into match keys. The zero value
+// reproduces standardKey (trim + lowercase) for every column.
+type NormalizeOptions struct {
+	CaseSensitive      bool              `json:"caseSensitive"`      // keep case instead of lowercasing
+	TrimOnlyColumns    []string          `json:"trimOnlyColumns"`    // headers of case-significant columns: trimmed but never lowercased
+	IgnoreDiacritics   bool              `json:"ignoreDiacritics"`   // strip accents so "résumé" keys as "resume"
+	StripWrappers      bool              `json:"stripWrappers"`      // drop balanced surrounding quotes/brackets ("[ABC]" -> "ABC")
+	StripSymbols       bool              `json:"stripSymbols"`       // drop leading/trailing currency symbols and a trailing "%" ("$1,000" -> "1,000")
+	NameColumns        []string          `json:"nameColumns"`        // headers of person-name columns; "Last, First" is reordered to "First Last"
+	DropMiddleInitials bool              `json:"dropMiddleInitials"` // in name columns, drop single-letter middle tokens ("John Q. Smith" -> "John Smith")
+	AddressColumns     []string          `json:"addressColumns"`     // headers of address columns, keyed by standardized address ("12 Main St." -> "12 main street")
+	ExpandUnits        bool              `json:"expandUnits"`        // expand unit abbreviations token by token ("5 kg" -> "5 kilogram")
+	UnitAliases        map[string]string `json:"unitAliases"`        // additions/overrides to defaultUnitAliases
+	AlphanumericOnly   bool              `json:"alphanumericOnly"`   // replace punctuation with spaces and collapse whitespace ("Acme,  Inc." -> "acme inc")
+	RemoveWhitespace   bool              `json:"removeWhitespace"`   // drop all whitespace, so "AB 12 CD" keys like "AB12CD"
+	Anagram            bool              `json:"anagram"`            // compare the sorted characters of each value, so "ABC" keys like "CAB"
+	NumericKeys        bool              `json:"numericKeys"`        // key numbers by value ("1,000.50" -> "1000.5") in columns that are mostly numeric
+	NumericMinFraction float64           `json:"numericMinFraction"` // share of a column's non-empty values that must be numbers for NumericKeys (default 0.9)
+}
+
+// defaultNumericMinFraction is used when NumericMinFraction is unset.
+const defaultNumericMinFraction = 0.9
+
+// normalizer turns a raw cell value into its match key.
+type normalizer func(string) string
+
+// columnNormalizer builds the key pipeline for the column with the given header; numeric
+// says whether the column qualified for NumericKeys.
+func (o NormalizeOptions) columnNormalizer(header string, numeric bool) normalizer {
+	// Case folding and diacritic stripping are independent steps, so every combination works.
+	steps := []normalizer{strings.TrimSpace}
+	lower := !o.CaseSensitive && !headerIn(o.TrimOnlyColumns, header)
+	if lower {
+		steps = append(steps, strings.ToLower)
+	}
+	if o.IgnoreDiacritics {
+		steps = append(steps, stripDiacritics)
+	}
+	if o.StripWrappers {
+		steps = append(steps, stripWrappers)
+	}
+	if o.StripSymbols {
+		steps = append(steps, stripSymbols)
+	}
+	if numeric {
+		steps = append(steps, canonicalNumber)
+	}
+	if o.isNameColumn(header) {
+		dropInitials := o.DropMiddleInitials
+		steps = append(steps, func(v string) string { return canonicalPersonName(v, dropInitials) })
+	}
+	if o.isAddressColumn(header) {
+		steps = append(steps, canonicalAddress)
+	}
+
+	if o.ExpandUnits {
+		units := o.unitDictionary()
+		steps = append(steps, func(v string) string { return expandUnits(v, units) })
+	}
+	if o.AlphanumericOnly {
+		steps = append(steps, alphanumericOnly)
+	}
+	if o.RemoveWhitespace {
+		steps = append(steps, removeWhitespace)
+	}
+	if o.Anagram {
+		steps = append(steps, sortCharacters)
+	}
+
+	if len(steps) == 2 && lower {
+		return standardKey
+	}
+	return func(v string) string {
+		for _, step := range steps {
+			v = step(v)
+		}
+		return v
+	}
+}
+
+// columnNormalizers builds one normalizer per column of the sheet.
+func (o NormalizeOptions) columnNormalizers(data SheetData) []normalizer {
+	keys := make([]normalizer, len(data.Headers))
+	for i := range data.Headers {
+		keys[i] = o.sheetColumnNormalizer(data, i)
+	}
+	return keys
+}
+
+// sheetColumnNormalizer builds the normalizer for column col, deciding once for the whole
+// column whether it is numeric.
+func (o NormalizeOptions) sheetColumnNormalizer(data SheetData, col int) normalizer {
+	return o.columnNormalizer(data.Headers[col], o.isNumericColumn(data.Rows, col))
+}
+
+// isNumericColumn reports whether NumericKeys applies to column col: at least NumericMinFraction
+// of its non-empty values must be numbers (after stripSymbols, when enabled). Deciding per column
+// keeps a mostly-text column textual even when some of its cells happen to look like numbers.
+func (o NormalizeOptions) isNumericColumn(rows [][]string, col int) bool {
+	if !o.NumericKeys {
+		return false
+	}
+	minFraction := o.NumericMinFraction
+	if minFraction <= 0 {
+		minFraction = defaultNumericMinFraction
+	}
+	values, numbers := 0, 0
+	for _, row := range rows {
+		v := strings.TrimSpace(cellValue(row, col))
+		if v == "" {
+			continue
+		}
+		if o.StripSymbols {
+			v = stripSymbols(v)
+		}
+		values++
+		if _, ok := parseNumber(v); ok {
+			numbers++
+		}
+	}
+	return values > 0 && float64(numbers) >= minFraction*float64(values)
+}
+
+func (o NormalizeOptions) isNameColumn(header string) bool {
+	return headerIn(o.NameColumns, header)
+}
+
+func (o NormalizeOptions) isAddressColumn(header string) bool {
+	return headerIn(o.AddressColumns, header)
+}
+
+// headerIn reports whether header is in the list, comparing headers by standardKey.
+func headerIn(headers []string, header string) bool {
+	key := standardKey(header)
+	for _, h := range headers {
+		if standardKey(h) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stripDiacritics removes combining marks after canonical decomposition ("é" -> "e").
+func stripDiacritics(v string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	out, _, err := transform.String(t, v)
+	if err != nil {
+		return v
+	}
+	return out
+}
+
+// wrapperPairs maps each opening quote or bracket to its closing counterpart.
+var wrapperPairs = map[rune]rune{
+	'"': '"', '\'': '\'', '`': '`', '“': '”', '‘': '’', '«': '»',
+	'(': ')', '[': ']', '{': '}', '<': '>',
+}
+
+// stripWrappers removes surrounding quote or bracket pairs, repeatedly ("[ 'ABC' ]" -> "ABC").
+// A pair is only removed when it wraps the whole value: "(a) (b)" and "\"a\" \"b\"" are kept.
+func stripWrappers(v string) string {
+	for {
+		r := []rune(v)
+		if len(r) < 2 {
+			return v
+		}
+		open, last := r[0], r[len(r)-1]
+		if closing, ok := wrapperPairs[open]; !ok || closing != last || !wrapsWhole(r, open, closing) {
+			return v
+		}
+		v = strings.TrimSpace(string(r[1 : len(r)-1]))
+	}
+}
+
+// wrapsWhole reports whether the opening rune at r[0] is closed only by the final rune.
+func wrapsWhole(r []rune, open, closing rune) bool {
+	inner := r[1 : len(r)-1]
+	if open == closing {
+		for _, c := range inner {
+			if c == open {
+				return false
+			}
+		}
+		return true
+	}
+	depth := 0
+	for _, c := range inner {
+		switch c {
+		case open:
+			depth++
+		case closing:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// stripSymbols removes currency symbols at either end of a value and one trailing percent
+// sign, keeping digits and separators as they are ("€ 12,50" -> "12,50", "50%" -> "50").
+// A minus sign in front of the symbol is kept ("-$5" -> "-5").
+func stripSymbols(v string) string {
+	isCurrency := func(r rune) bool { return unicode.Is(unicode.Sc, r) }
+	if rest, ok := strings.CutPrefix(v, "-"); ok && strings.IndexFunc(rest, isCurrency) == 0 {
+		return "-" + stripSymbols(rest)
+	}
+	v = strings.TrimSpace(strings.TrimFunc(v, isCurrency))
+	v = strings.TrimSpace(strings.TrimSuffix(v, "%"))
+	return strings.TrimSpace(strings.TrimFunc(v, isCurrency))
+}
+
+// defaultUnitAliases maps common unit abbreviations to the spelled-out unit.
+var defaultUnitAliases = map[string]string{
+	"kg": "kilogram", "kgs": "kilogram", "g": "gram", "gr": "gram", "mg": "milligram",
+	"lb": "pound", "lbs": "pound", "oz": "ounce",
+	"l": "liter", "ltr": "liter", "ml": "milliliter",
+	"m": "meter", "cm": "centimeter", "mm": "millimeter", "km": "kilometer",
+	"in": "inch", "ft": "foot", "yd": "yard",
+	"pc": "piece", "pcs": "piece", "ea": "each", "pk": "pack", "doz": "dozen",
+}
+
+// unitDictionary merges the request's aliases over the defaults, keyed by lowercase abbreviation.
+func (o NormalizeOptions) unitDictionary() map[string]string {
+	units := make(map[string]string, len(defaultUnitAliases)+len(o.UnitAliases))
+	for k, v := range defaultUnitAliases {
+		units[k] = v
+	}
+	for k, v := range o.UnitAliases {
+		units[strings.ToLower(strings.TrimSpace(k))] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return units
+}
+
+// expandUnits replaces unit abbreviations token by token, also splitting a number glued
+// to its unit ("5kg" -> "5 kilogram"). Tokens are re-joined with single spaces.
+func expandUnits(v string, units map[string]string) string {
+	tokens := strings.Fields(v)
+	for i, t := range tokens {
+		if full, ok := units[strings.ToLower(t)]; ok {
+			tokens[i] = full
+			continue
+		}
+		split := strings.IndexFunc(t, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' && r != ',' })
+		if split > 0 {
+			if full, ok := units[strings.ToLower(t[split:])]; ok {
+				tokens[i] = t[:split] + " " + full
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// alphanumericOnly keeps letters and digits, joining the runs between other characters with single spaces.
+func alphanumericOnly(v string) string {
+	return strings.Join(strings.FieldsFunc(v, notAlphanumeric), " ")
+}
+
+func notAlphanumeric(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// removeWhitespace deletes every whitespace rune, including internal spacing.
+func removeWhitespace(v string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, v)
+}
+
+// sortCharacters returns the runes of v in sorted order, keying values by their character multiset.
+func sortCharacters(v string) string {
+	r := []rune(v)
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return string(r)
+}
+
+// numberPattern matches plain decimal numbers, optionally signed, with comma thousands
+// separators and an exponent ("-1,234.5", "0042", "1e3").
+var numberPattern = regexp.MustCompile(`^[-+]?(\d{1,3}(,\d{3})+|\d+)?(\.\d+)?([eE][-+]?\d+)?$`)
+
+// parseNumber parses v if it matches numberPattern.
+func parseNumber(v string) (float64, bool) {
+	if !numberPattern.MatchString(v) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+	return f, err == nil
+}
+
+// canonicalNumber rewrites a number in its shortest form ("1,000.50" -> "1000.5", "007" -> "7",
+// "1.5e3" -> "1500"); other values are returned unchanged. It rewrites the decimal digits
+// rather than going through a float, so long account numbers and amounts keep every digit.
+// A number with an exponent beyond numberMaxExponent is returned unchanged.
+func canonicalNumber(v string) string {
+	if !numberPattern.MatchString(v) {
+		return v
+	}
+	s := strings.ReplaceAll(v, ",", "")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	mantissa, exponent, hasExp := strings.Cut(strings.ToLower(s), "e")
+	shift := 0
+	if hasExp {
+		n, err := strconv.Atoi(exponent)
+		if err != nil || n > numberMaxExponent || n < -numberMaxExponent {
+			return v
+		}
+		shift = n
+	}
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	if whole == "" && frac == "" {
+		return v
+	}
+
+	// The number is 0.digits * 10^point.
+	digits, point := whole+frac, len(whole)+shift
+	trimmed := strings.TrimLeft(digits, "0")
+	point -= len(digits) - len(trimmed)
+	digits = strings.TrimRight(trimmed, "0")
+	if digits == "" {
+		return "0"
+	}
+	switch {
+	case point <= 0:
+		digits = "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		digits += strings.Repeat("0", point-len(digits))
+	default:
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if neg {
+		return "-" + digits
+	}
+	return digits
+}
+
+// numberMaxExponent bounds the exponents canonicalNumber writes out in full.
+const numberMaxExponent = 400
+
+// canonicalPersonName rewrites "Last, First Middle" as "First Middle Last" and collapses
+// internal whitespace. Values with no comma (or more than one) keep their word order.
+func canonicalPersonName(v string, dropMiddleInitials bool) string {
+	if last, first, ok := strings.Cut(v, ","); ok && !strings.Contains(first, ",") {
+		v = strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+	}
+	tokens := strings.Fields(v)
+	if dropMiddleInitials && len(tokens) > 2 {
+		kept := []string{tokens[0]}
+		for _, t := range tokens[1 : len(tokens)-1] {
+			if len(strings.TrimSuffix(t, ".")) > 1 {
+				kept = append(kept, t)
+			}
+		}
+		tokens = append(kept, tokens[len(tokens)-1])
+	}
+	return strings.Join(tokens, " ")
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"1,000.50", "1000.5"},
+		{"007", "7"},
+		{"0", "0"},
+		{"-0.00", "0"},
+		{"+5", "5"},
+		{"-12.340", "-12.34"},
+		{".5", "0.5"},
+		{"100", "100"},
+		{"1e3", "1000"},
+		{"1.5E+3", "1500"},
+		{"1.5e-3", "0.0015"},
+		{"0.000", "0"},
+		{"9007199254740993", "9007199254740993"}, // 2^53+1, not representable as a float64
+		{"12345678901234567890.123456789", "12345678901234567890.123456789"},
+		{"1,234,567,890,123,456,789", "1234567890123456789"},
+		{"1e999", "1e999"}, // exponent too large: unchanged
+		{"abc", "abc"},
+		{"12a", "12a"},
+		{"", ""},
+		{"-", "-"},
+		{"1,00", "1,00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := canonicalNumber(tt.in); got != tt.want {
+				t.Errorf("canonicalNumber(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumericKeysPerColumn(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        NormalizeOptions
+		column      []string
+		wantNumeric bool
+		value, want string // a value of the column and its key
+	}{
+		{
+			name:        "numeric column",
+			opts:        NormalizeOptions{NumericKeys: true},
+			column:      []string{"007", "1,000.50", "42", "", "3.0"},
+			wantNumeric: true,
+			value:       "007", want: "7",
+		},
+		{
+			name:        "mostly-text column stays textual despite some numbers",
+			opts:        NormalizeOptions{NumericKeys: true},
+			column:      []string{"Apple", "Banana", "007", "Cherry", "12"},
+			wantNumeric: false,
+			value:       "007", want: "007",
+		},
+		{
+			name:        "lower fraction admits the column",
+			opts:        NormalizeOptions{NumericKeys: true, NumericMinFraction: 0.4},
+			column:      []string{"Apple", "Banana", "007", "Cherry", "12"},
+			wantNumeric: true,
+			value:       "007", want: "7",
+		},
+		{
+			name:        "nine in ten non-empty values is enough; blanks do not count",
+			opts:        NormalizeOptions{NumericKeys: true},
+			column:      []string{"1", "2", "", "3", "4", "5", "", "6", "7", "8", "9", "n/a", ""},
+			wantNumeric: true,
+			value:       "007", want: "7",
+		},
+		{
+			name:        "an empty column is not numeric",
+			opts:        NormalizeOptions{NumericKeys: true},
+			column:      []string{"", " ", ""},
+			wantNumeric: false,
+			value:       "007", want: "007",
+		},
+		{
+			name:        "symbols count as numbers when stripped",
+			opts:        NormalizeOptions{NumericKeys: true, StripSymbols: true},
+			column:      []string{"$1,000", "$20.50", "€3"},
+			wantNumeric: true,
+			value:       "$1,000.00", want: "1000",
+		},
+		{
+			name:        "off unless requested",
+			column:      []string{"007", "42"},
+			wantNumeric: false,
+			value:       "007", want: "007",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := SheetData{Headers: []string{"Value"}}
+			for _, v := range tt.column {
+				data.Rows = append(data.Rows, []string{v})
+			}
+			if got := tt.opts.isNumericColumn(data.Rows, 0); got != tt.wantNumeric {
+				t.Errorf("isNumericColumn = %t, want %t", got, tt.wantNumeric)
+			}
+			if got := tt.opts.columnNormalizers(data)[0](tt.value); got != tt.want {
+				t.Errorf("key of %q = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonNameKeys(t *testing.T) {
+	names := NormalizeOptions{NameColumns: []string{"Name"}}
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		header   string
+		a, b     string
+		wantSame bool
+	}{
+		{"\"Last, First\" keys as \"First Last\"", names, "Name", "Smith, John", "John Smith", true},
+		{"header case does not matter", names, "name", "Smith, John", "John Smith", true},
+		{"off unless the column is named", NormalizeOptions{}, "Name", "Smith, John", "John Smith", false},
+		{"other columns keep their order", names, "Company", "Smith, John", "John Smith", false},
+		{"middle initials are kept by default", names, "Name", "Smith, John Q.", "John Smith", false},
+		{"middle initials dropped on request", NormalizeOptions{NameColumns: []string{"Name"}, DropMiddleInitials: true}, "Name", "Smith, John Q.", "John Smith", true},
+		{"two commas are not reordered", names, "Name", "Smith, John, Jr", "John Jr Smith", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer(tt.header, false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestCaseAndAccentToggles(t *testing.T) {
+	tests := []struct {
+		name string
+		opts NormalizeOptions
+		want map[string]string // key of each value
+	}{
+		{"fold case, keep accents", NormalizeOptions{},
+			map[string]string{"résumé": "résumé", "RÉSUMÉ": "résumé", "resume": "resume"}},
+		{"fold case and accents", NormalizeOptions{IgnoreDiacritics: true},
+			map[string]string{"résumé": "resume", "RÉSUMÉ": "resume", "resume": "resume"}},
+		{"keep case and accents", NormalizeOptions{CaseSensitive: true},
+			map[string]string{"résumé": "résumé", "RÉSUMÉ": "RÉSUMÉ", "resume": "resume"}},
+		{"keep case, fold accents", NormalizeOptions{CaseSensitive: true, IgnoreDiacritics: true},
+			map[string]string{"résumé": "resume", "RÉSUMÉ": "RESUME", "resume": "resume"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer("Word", false)
+			for v, want := range tt.want {
+				if got := key(v); got != want {
+					t.Errorf("key of %q = %q, want %q", v, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnagramKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		a, b     string
+		wantSame bool
+	}{
+		{"permuted characters match", NormalizeOptions{Anagram: true}, "ABC", "CAB", true},
+		{"different characters do not", NormalizeOptions{Anagram: true}, "ABC", "ABD", false},
+		{"repeated characters count", NormalizeOptions{Anagram: true}, "AAB", "ABB", false},
+		{"case still folds", NormalizeOptions{Anagram: true}, "abc", "CBA", true},
+		{"off unless requested", NormalizeOptions{}, "ABC", "CAB", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer("Flags", false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestRemoveWhitespaceKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		a, b     string
+		wantSame bool
+	}{
+		{"spaced and unspaced codes match", NormalizeOptions{RemoveWhitespace: true}, "AB 12 CD", "AB12CD", true},
+		{"tabs and runs of spaces go too", NormalizeOptions{RemoveWhitespace: true}, "GB29\tNWBK  6016", "gb29nwbk6016", true},
+		{"composes with alphanumeric-only", NormalizeOptions{RemoveWhitespace: true, AlphanumericOnly: true}, "AB-12 CD", "AB12CD", true},
+		{"other characters still differ", NormalizeOptions{RemoveWhitespace: true}, "AB 12 CD", "AB12CE", false},
+		{"off unless requested", NormalizeOptions{}, "AB 12 CD", "AB12CD", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer("Code", false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestExpandUnitKeys(t *testing.T) {
+	units := NormalizeOptions{ExpandUnits: true}
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		a, b     string
+		wantSame bool
+	}{
+		{"an abbreviation matches the full unit", units, "5 kg bag", "5 kilogram bag", true},
+		{"a unit glued to its number", units, "5kg bag", "5 kilogram bag", true},
+		{"abbreviation case does not matter", units, "12 PCS", "12 piece", true},
+		{"different units stay apart", units, "5 kg bag", "5 gram bag", false},
+		{"aliases extend the dictionary", NormalizeOptions{ExpandUnits: true, UnitAliases: map[string]string{"Ctn": "carton"}}, "2 ctn", "2 carton", true},
+		{"aliases override a default", NormalizeOptions{ExpandUnits: true, UnitAliases: map[string]string{"in": "inside"}}, "5 in", "5 inch", false},
+		{"off unless requested", NormalizeOptions{}, "5 kg bag", "5 kilogram bag", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer("Description", false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestTrimOnlyColumns(t *testing.T) {
+	trimOnly := NormalizeOptions{TrimOnlyColumns: []string{"Code"}}
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		header   string
+		a, b     string
+		wantSame bool
+	}{
+		{"surrounding whitespace is trimmed", trimOnly, "Code", "  ABC  ", "ABC", true},
+		{"case is kept", trimOnly, "Code", "  ABC  ", "abc", false},
+		{"other columns still fold case", trimOnly, "Name", "  ABC  ", "abc", true},
+		{"composes with other steps", NormalizeOptions{TrimOnlyColumns: []string{"Code"}, StripWrappers: true}, "Code", " [ABC] ", "ABC", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer(tt.header, false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestStripSymbolKeys(t *testing.T) {
+	symbols := NormalizeOptions{StripSymbols: true}
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		a, b     string
+		wantSame bool
+	}{
+		{"a leading currency symbol", symbols, "$1,000", "1,000", true},
+		{"a trailing currency symbol", symbols, "1.000 €", "1.000", true},
+		{"a trailing percent sign", symbols, "50%", "50", true},
+		{"separators are kept", symbols, "$1,000", "1000", false},
+		{"composes with numeric keys", NormalizeOptions{StripSymbols: true, NumericKeys: true}, "$1,000", "1000", true},
+		{"off unless requested", NormalizeOptions{}, "$1,000", "1,000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := SheetData{Headers: []string{"Amount"}, Rows: [][]string{{tt.a}, {tt.b}}}
+			key := tt.opts.columnNormalizers(data)[0]
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestStripWrapperKeys(t *testing.T) {
+	wrappers := NormalizeOptions{StripWrappers: true}
+	tests := []struct {
+		name     string
+		opts     NormalizeOptions
+		a, b     string
+		wantSame bool
+	}{
+		{"double quotes", wrappers, `"ABC"`, "ABC", true},
+		{"single quotes", wrappers, "'ABC'", "ABC", true},
+		{"square brackets", wrappers, "[123]", "123", true},
+		{"parentheses", wrappers, "(123)", "123", true},
+		{"nested wrappers", wrappers, `["ABC"]`, "ABC", true},
+		{"unbalanced wrappers stay", wrappers, `"ABC`, "ABC", false},
+		{"mismatched pairs stay", wrappers, "[ABC)", "ABC", false},
+		{"inner brackets stay", wrappers, "[A] [B]", "A] [B", false},
+		{"off unless requested", NormalizeOptions{}, `"ABC"`, "ABC", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.opts.columnNormalizer("Code", false)
+			if got := key(tt.a) == key(tt.b); got != tt.wantSame {
+				t.Errorf("keys %q and %q: same = %t, want %t", key(tt.a), key(tt.b), got, tt.wantSame)
+			}
+		})
+	}
+}
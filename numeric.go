@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Numeric Matching ---
+// ---------------------------------------------------------------------
+
+// The "numeric" algorithm matches values as numbers, so "1,200.00" reconciles with "1200"
+// and "$1,200" with "1200.004". Both keys must parse as numbers, after currency symbols and a
+// trailing "%" are stripped, and their difference must be within MatchRequest.Tolerance:
+// an absolute amount such as "0.01", or a percentage of the larger magnitude such as "2%".
+// Without a tolerance values must be equal. The tolerance replaces FuzzyThreshold for this
+// algorithm; the ratio reported is 1 - |a-b| / max(|a|, |b|).
+
+// parseTolerance reads MatchRequest.Tolerance as an absolute amount or, with a "%" suffix, a
+// relative one.
+func parseTolerance(s string) (abs, rel float64, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "±")
+	if s == "" {
+		return 0, 0, nil
+	}
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, 0, fmt.Errorf("invalid tolerance '%s' (expected an amount such as 0.01 or a percentage such as 2%%)", s)
+	}
+	if percent {
+		return 0, f / 100, nil
+	}
+	return f, 0, nil
+}
+
+// numericSlack is the rounding allowed for, relative to the larger magnitude: one unit in the
+// last place of a float64.
+const numericSlack = 0x1p-52
+
+// numericScore compares keys as numbers within the request's tolerance.
+func numericScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	a, ok1 := parseNumber(stripSymbols(key1))
+	b, ok2 := parseNumber(stripSymbols(key2))
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	diff, scale := math.Abs(a-b), math.Max(math.Abs(a), math.Abs(b))
+	// Reading decimals into floats is off by up to half a unit in the last place each, which
+	// must not tip a difference of exactly the tolerance over it (1.00 against 1.01 at 0.01).
+	if within := diff - scale*numericSlack; within > p.toleranceAbs && within > p.toleranceRel*scale {
+		return 0, 0, false
+	}
+	ratio := 1.0
+	if scale > 0 {
+		ratio = math.Max(1-diff/scale, 0)
+	}
+	return levenshteinDistance(key1, key2), ratio, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNumericScoreTolerance(t *testing.T) {
+	tests := []struct {
+		a, b      string
+		tolerance string
+		want      bool
+	}{
+		{"1.00", "1.01", "0.01", true}, // exactly the tolerance apart
+		{"1.01", "1.00", "0.01", true},
+		{"1.00", "1.0101", "0.01", false},
+		{"0.1", "0.3", "0.2", true},
+		{"1,200.00", "1200", "", true},
+		{"$1,200", "1200.004", "0.01", true},
+		{"1200", "1200.01", "", false},
+		{"100", "102", "2%", true}, // 2% of the larger, 102
+		{"100", "98", "2%", true},
+		{"100", "97.9", "2%", false},
+		{"1000000000000000", "1000000000000001", "1", true},
+		{"1000000000000000", "1000000000000002", "1", false},
+		{"-5", "5", "10", true},
+		{"abc", "1", "100", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b+" at "+tt.tolerance, func(t *testing.T) {
+			p := newScoreParams(MatchRequest{Tolerance: tt.tolerance})
+			if _, _, got := numericScore(tt.a, tt.b, p); got != tt.want {
+				t.Errorf("numericScore(%q, %q) at %q matched %t, want %t", tt.a, tt.b, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTolerance(t *testing.T) {
+	tests := []struct {
+		in       string
+		abs, rel float64
+		wantErr  bool
+	}{
+		{"", 0, 0, false},
+		{"0.01", 0.01, 0, false},
+		{"±0.5", 0.5, 0, false},
+		{"2%", 0, 0.02, false},
+		{" 2 % ", 0, 0.02, false},
+		{"-1", 0, 0, true},
+		{"abc", 0, 0, true},
+		{"Inf", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			abs, rel, err := parseTolerance(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTolerance(%q) err = %v, want error %t", tt.in, err, tt.wantErr)
+			}
+			if abs != tt.abs || rel != tt.rel {
+				t.Errorf("parseTolerance(%q) = %v, %v, want %v, %v", tt.in, abs, rel, tt.abs, tt.rel)
+			}
+		})
+	}
+}
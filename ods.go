@@ -0,0 +1,201 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- OpenDocument Spreadsheets ---
+// ---------------------------------------------------------------------
+
+const (
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+)
+
+// parseODSWorkbook reads every sheet of an OpenDocument spreadsheet (.ods). Like .xls, fill
+// colors and lazy loading are not supported, and trailing blank rows and cells are dropped.
+func parseODSWorkbook(data []byte, opts uploadOptions) (parsedUpload, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+			break
+		}
+	}
+	if content == nil {
+		return parsedUpload{}, fmt.Errorf("content.xml not found; not an OpenDocument spreadsheet")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	defer rc.Close()
+
+	tables, err := readODSTables(rc, opts)
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	if opts.CaptureStyles || opts.Lazy {
+		log.Printf("WARN: captureStyles and lazy are not supported for .ods spreadsheets; ignoring.")
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, len(tables)),
+		names:       make([]string, 0, len(tables)),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	for _, t := range tables {
+		up.addRows(t.name, t.rows, opts)
+	}
+	return up, nil
+}
+
+// odsTable is one table:table element of content.xml.
+type odsTable struct {
+	name string
+	rows [][]string
+}
+
+// readODSTables streams content.xml into tables. Repeated rows and cells are expanded, except
+// that blank ones are only materialized when real content follows them: spreadsheets commonly
+// pad a sheet with a million repeated empty rows. Tables the upload selects are refused as
+// soon as they are over the upload caps.
+func readODSTables(r io.Reader, opts uploadOptions) ([]odsTable, error) {
+	dec := xml.NewDecoder(r)
+	var (
+		tables     []odsTable
+		cur        *odsTable
+		selected   bool // whether opts selects the current table
+		row        []string
+		rowRepeat  int
+		blankRows  int // blank rows not yet appended
+		blankCells int // blank cells of the current row not yet appended
+		inCell     bool
+		cellRepeat int
+		cellValue  string // office:value, used when the cell has no text
+		text       strings.Builder
+		paragraphs int
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				tables = append(tables, odsTable{name: odsAttr(t, odsTableNS, "name")})
+				cur = &tables[len(tables)-1]
+				selected = opts.selectsSheet(cur.name)
+				blankRows = 0
+			case cur != nil && t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				row, blankCells = nil, 0
+				rowRepeat = odsRepeat(t, "number-rows-repeated")
+			case cur != nil && t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell = true
+				cellRepeat = odsRepeat(t, "number-columns-repeated")
+				cellValue = odsAttr(t, odsOfficeNS, "value")
+				text.Reset()
+				paragraphs = 0
+			case inCell && t.Name.Space == odsTextNS:
+				switch t.Name.Local {
+				case "p":
+					if paragraphs > 0 {
+						text.WriteByte('\n')
+					}
+					paragraphs++
+				case "s":
+					n := 1
+					if c, err := strconv.Atoi(odsAttr(t, odsTextNS, "c")); err == nil && c > 0 {
+						n = c
+					}
+					text.WriteString(strings.Repeat(" ", n))
+				case "tab":
+					text.WriteByte('\t')
+				case "line-break":
+					text.WriteByte('\n')
+				}
+			}
+		case xml.CharData:
+			if inCell && paragraphs > 0 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space != odsTableNS || cur == nil:
+			case t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell":
+				inCell = false
+				v := text.String()
+				if v == "" {
+					v = cellValue
+				}
+				if v == "" {
+					blankCells += cellRepeat
+					continue
+				}
+				for ; blankCells > 0; blankCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, v)
+				}
+			case t.Name.Local == "table-row":
+				if len(row) == 0 {
+					blankRows += rowRepeat
+					continue
+				}
+				for ; blankRows > 0; blankRows-- {
+					cur.rows = append(cur.rows, []string{})
+				}
+				for i := 0; i < rowRepeat; i++ {
+					cur.rows = append(cur.rows, append([]string(nil), row...))
+					if selected {
+						if err := checkRowLimits(cur.name, opts.layout(), len(cur.rows), row); err != nil {
+							return nil, err
+						}
+					}
+				}
+			case t.Name.Local == "table":
+				cur = nil
+			}
+		}
+	}
+	return tables, nil
+}
+
+// odsAttr returns the value of the attribute space:local, or "".
+func odsAttr(e xml.StartElement, space, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// odsRepeat reads a table:number-*-repeated attribute, defaulting to 1.
+func odsRepeat(e xml.StartElement, local string) int {
+	n, err := strconv.Atoi(odsAttr(e, odsTableNS, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// ---------------------------------------------------------------------
+// --- Parquet Uploads ---
+// ---------------------------------------------------------------------
+
+// A Parquet file is read as one sheet named after the file, with a column per leaf of its
+// schema. Nested fields are headed by their dotted path and the values of repeated fields are
+// joined into one cell, so a data lake extract with lists still fits the rows-and-columns model.
+
+// parquetReadBatch is how many rows are read from a row group at a time.
+const parquetReadBatch = 1024
+
+// parquetPreallocRows caps the rows allocated up front, before any has been read.
+const parquetPreallocRows = 1 << 16
+
+// parquetListSuffix ends the path of a list's elements in the standard three-level encoding.
+const parquetListSuffix = ".list.element"
+
+// parseParquetUpload reads a Parquet file as a single sheet. Dates, timestamps and decimals
+// are rendered as text the way a spreadsheet would show them; nulls are blank cells.
+func parseParquetUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return parsedUpload{}, err
+	}
+
+	paths := f.Schema().Columns()
+	headers := make([]string, len(paths))
+	formats := make([]func(parquet.Value) string, len(paths))
+	for _, path := range paths {
+		leaf, ok := f.Schema().Lookup(path...)
+		if !ok {
+			return parsedUpload{}, fmt.Errorf("column %s missing from schema", strings.Join(path, "."))
+		}
+		headers[leaf.ColumnIndex] = strings.TrimSuffix(strings.Join(path, "."), parquetListSuffix)
+		formats[leaf.ColumnIndex] = parquetFormatter(leaf.Node.Type().LogicalType())
+	}
+
+	name := strings.TrimSuffix(filepath.Base(opts.Filename), filepath.Ext(opts.Filename))
+	if name == "" || name == "." {
+		name = "Sheet1"
+	}
+	// NumRows comes from the file's footer, so it only bounds the initial allocation.
+	prealloc := parquetPreallocRows
+	if n := f.NumRows(); n < int64(prealloc) {
+		prealloc = int(n)
+	}
+	if uploadMaxRows > 0 && uploadMaxRows < prealloc {
+		prealloc = uploadMaxRows
+	}
+	rows := make([][]string, 0, prealloc+1)
+	rows = append(rows, headers)
+	buf := make([]parquet.Row, parquetReadBatch)
+	for _, rg := range f.RowGroups() {
+		rr := rg.Rows()
+		for {
+			n, err := rr.ReadRows(buf)
+			for _, values := range buf[:n] {
+				row := make([]string, len(headers))
+				for _, v := range values {
+					if v.IsNull() {
+						continue
+					}
+					c := v.Column()
+					if s := formats[c](v); row[c] == "" {
+						row[c] = s
+					} else {
+						row[c] += ", " + s
+					}
+				}
+				rows = append(rows, row)
+				if err := checkRowLimits(name, sheetLayout{}, len(rows), row); err != nil {
+					rr.Close()
+					return parsedUpload{}, err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rr.Close()
+				return parsedUpload{}, fmt.Errorf("row %d: %v", len(rows), err)
+			}
+		}
+		rr.Close()
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, 1),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	opts.HeaderRow, opts.HeaderRows = 0, 0 // the schema is the header
+	up.addRows(name, rows, opts)
+	return up, nil
+}
+
+// parquetFormatter returns the function rendering a column's values as cell text, going by
+// its logical type. Types without a special rendering use the physical value.
+func parquetFormatter(lt *format.LogicalType) func(parquet.Value) string {
+	if lt == nil {
+		return parquetPhysical
+	}
+	switch t := lt.Value.(type) {
+	case *format.DateType:
+		return func(v parquet.Value) string {
+			return time.Unix(int64(v.Int32())*86400, 0).UTC().Format("2006-01-02")
+		}
+	case *format.TimestampType:
+		unit := time.Millisecond
+		switch t.Unit.Value.(type) {
+		case *format.MicroSeconds:
+			unit = time.Microsecond
+		case *format.NanoSeconds:
+			unit = time.Nanosecond
+		}
+		return func(v parquet.Value) string {
+			return formatParquetTime(time.Unix(0, v.Int64()*int64(unit)))
+		}
+	case *format.DecimalType:
+		scale := int(t.Scale)
+		return func(v parquet.Value) string {
+			var unscaled *big.Int
+			switch v.Kind() {
+			case parquet.Int32:
+				unscaled = big.NewInt(int64(v.Int32()))
+			case parquet.Int64:
+				unscaled = big.NewInt(v.Int64())
+			default:
+				unscaled = twosComplement(v.ByteArray())
+			}
+			return formatDecimal(unscaled, scale)
+		}
+	}
+	return parquetPhysical
+}
+
+// parquetPhysical renders a value by its physical type. INT96 is the legacy timestamp
+// encoding of Hive and Spark: nanoseconds within the day, then the Julian day number.
+func parquetPhysical(v parquet.Value) string {
+	if v.Kind() == parquet.Int96 {
+		i := v.Int96()
+		nanos := int64(i[1])<<32 | int64(i[0])
+		days := int64(i[2]) - 2440588 // Julian day of the Unix epoch
+		return formatParquetTime(time.Unix(days*86400, nanos))
+	}
+	return v.String()
+}
+
+// formatParquetTime prints a timestamp in UTC, with fractional seconds only when present.
+func formatParquetTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+// twosComplement reads a big-endian two's complement integer, as decimals stored in byte
+// arrays are.
+func twosComplement(b []byte) *big.Int {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return n
+}
+
+// formatDecimal prints unscaled × 10^-scale with exactly scale decimal places.
+func formatDecimal(unscaled *big.Int, scale int) string {
+	if scale <= 0 {
+		return unscaled.String()
+	}
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	s := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParseParquetUploadRowLimit(t *testing.T) {
+	defer func(rows int) { uploadMaxRows = rows }(uploadMaxRows)
+
+	type record struct {
+		ID   int64  `parquet:"id"`
+		Name string `parquet:"name"`
+	}
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[record](&buf)
+	if _, err := w.Write([]record{{1, "a"}, {2, "b"}, {3, "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		maxRows  int
+		wantRows int
+		refused  bool
+	}{
+		{"no cap", 0, 3, false},
+		{"at the cap", 3, 3, false},
+		{"over the cap", 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploadMaxRows = tt.maxRows
+			up, err := parseParquetUpload(buf.Bytes(), uploadOptions{Filename: "people.parquet"})
+			if tt.refused {
+				if !isLimitError(err) {
+					t.Fatalf("err = %v, want a limit error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(up.sheets["people"].Rows); got != tt.wantRows {
+				t.Errorf("rows = %d, want %d", got, tt.wantRows)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Clipboard Paste ---
+// ---------------------------------------------------------------------
+
+// A range copied from Excel or Google Sheets reaches the clipboard as tab-separated text,
+// with cells holding tabs or line breaks quoted. /api/paste takes that text as the raw
+// request body and stores it as one sheet; the upload options that apply to text (dataset,
+// sheet, mode, idempotent, headerRow, skipRows, headerRows) go in the query string.
+
+// pasteHandler handles POST /api/paste?sheet=Name, storing pasted text like a .tsv upload.
+// The sheet defaults to "Pasted".
+func pasteHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling paste request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Read the body before touching the form, which would otherwise consume a body sent as
+	// application/x-www-form-urlencoded.
+	limit := bodyLimitFor(r.URL.Path)
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("ERROR: Request body for %s exceeds %d bytes.", r.URL.Path, limit)
+			http.Error(w, fmt.Sprintf("Request body too large (limit %d bytes).", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		http.Error(w, "Nothing to paste: the request body is empty.", http.StatusBadRequest)
+		return
+	}
+
+	ints := make(map[string]int)
+	for _, key := range []string{"headerRow", "skipRows", "headerRows"} {
+		n, err := formInt(r, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ints[key] = n
+	}
+	sheet := r.FormValue("sheet")
+	if sheet == "" {
+		sheet = "Pasted"
+	}
+	opts := uploadOptions{
+		Dataset:    r.FormValue("dataset"),
+		Idempotent: formBool(r, "idempotent"),
+		Mode:       r.FormValue("mode"),
+		Format:     formatTSV,
+		HeaderRow:  ints["headerRow"],
+		SkipRows:   ints["skipRows"],
+		HeaderRows: ints["headerRows"],
+		Filename:   sheet + ".tsv",
+	}
+	log.Printf("INFO: Received %d bytes of pasted text for sheet '%s'.", len(data), sheet)
+	storeUpload(w, r, data, opts, parseUpload, http.StatusBadRequest)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ---------------------------------------------------------------------
+// --- PDF Tables ---
+// ---------------------------------------------------------------------
+
+// PDFs have no notion of a table, only of text drawn at positions, so extraction is best
+// effort. Text on a page is grouped into lines by baseline and each line into cells wherever
+// a gap is wider than pdfCellGap. A run of consecutive lines with at least two cells is taken
+// as a table, with its first line as the header; its columns are the x ranges that the
+// cells of the run overlap on. Scanned PDFs carry no text and yield nothing, and a table
+// continuing onto the next page becomes a second sheet.
+
+// Layout thresholds, in multiples of the font size.
+const (
+	pdfLineTolerance = 0.5  // baselines closer than this are one line
+	pdfWordGap       = 0.15 // a wider gap between text runs is a space
+	pdfCellGap       = 1.0  // a wider gap starts a new cell
+)
+
+// pdfCell is a run of text on a line, spanning x0 to x1.
+type pdfCell struct {
+	x0, x1 float64
+	text   string
+}
+
+// parsePDFUpload extracts the tables of every page of a PDF into sheets named
+// "Page 1 Table 1" and so on. A page that cannot be read is reported in sheetErrors.
+func parsePDFUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return parsedUpload{}, err
+	}
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	found := 0
+	for p := 1; p <= r.NumPage(); p++ {
+		tables, err := pdfPageTables(r.Page(p))
+		if err != nil {
+			log.Printf("WARN: Failed to read PDF page %d: %v", p, err)
+			up.sheetErrors = append(up.sheetErrors, SheetError{Sheet: fmt.Sprintf("Page %d", p), Error: err.Error()})
+			continue
+		}
+		for t, rows := range tables {
+			up.addRows(fmt.Sprintf("Page %d Table %d", p, t+1), rows, opts)
+		}
+		found += len(tables)
+	}
+	if found == 0 && len(up.sheetErrors) == 0 {
+		return parsedUpload{}, fmt.Errorf("no tables found (a scanned PDF has no text to extract)")
+	}
+	log.Printf("DEBUG: Extracted %d table(s) from %d PDF page(s).", found, r.NumPage())
+	return up, nil
+}
+
+// pdfPageTables returns the tables detected on a page, each as rows of cells.
+func pdfPageTables(page pdf.Page) (tables [][][]string, err error) {
+	// The PDF reader panics on some malformed content streams instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed page: %v", r)
+		}
+	}()
+	if page.V.IsNull() {
+		return nil, nil
+	}
+
+	var run [][]pdfCell
+	flush := func() {
+		if len(run) >= 2 {
+			tables = append(tables, pdfTableRows(run))
+		}
+		run = nil
+	}
+	for _, line := range pdfLines(page.Content().Text) {
+		if len(line) < 2 {
+			flush()
+			continue
+		}
+		run = append(run, line)
+	}
+	flush()
+	return tables, nil
+}
+
+// pdfLines groups a page's text into lines from top to bottom, each split into cells from
+// left to right.
+func pdfLines(texts []pdf.Text) [][]pdfCell {
+	texts = append([]pdf.Text(nil), texts...)
+	sort.SliceStable(texts, func(i, j int) bool { return texts[i].Y > texts[j].Y })
+
+	var lines [][]pdf.Text
+	for _, t := range texts {
+		n := len(lines)
+		if n > 0 && lines[n-1][0].Y-t.Y <= pdfLineTolerance*maxFloat(t.FontSize, 1) {
+			lines[n-1] = append(lines[n-1], t)
+			continue
+		}
+		if strings.TrimSpace(t.S) != "" { // a space cannot start a line
+			lines = append(lines, []pdf.Text{t})
+		}
+	}
+
+	cells := make([][]pdfCell, len(lines))
+	for i, line := range lines {
+		sort.SliceStable(line, func(a, b int) bool { return line[a].X < line[b].X })
+		var cur *pdfCell
+		for _, t := range line {
+			em := maxFloat(t.FontSize, 1)
+			if strings.TrimSpace(t.S) == "" {
+				// Space glyphs separate words; without font widths they are the only sign of it.
+				if cur != nil && !strings.HasSuffix(cur.text, " ") {
+					cur.text += " "
+				}
+				continue
+			}
+			if cur != nil {
+				if gap := t.X - cur.x1; gap <= pdfCellGap*em {
+					if gap > pdfWordGap*em && !strings.HasSuffix(cur.text, " ") {
+						cur.text += " "
+					}
+					cur.text += t.S
+					cur.x1 = maxFloat(cur.x1, t.X+t.W)
+					continue
+				}
+			}
+			cells[i] = append(cells[i], pdfCell{x0: t.X, x1: t.X + t.W, text: t.S})
+			cur = &cells[i][len(cells[i])-1]
+		}
+	}
+	return cells
+}
+
+// pdfTableRows lays a run of lines out on shared columns: the x ranges left after merging
+// every cell span that overlaps another. Cells falling in the same column are joined.
+func pdfTableRows(lines [][]pdfCell) [][]string {
+	var spans []pdfCell
+	for _, line := range lines {
+		spans = append(spans, line...)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].x0 < spans[j].x0 })
+	var columns []pdfCell
+	for _, s := range spans {
+		if n := len(columns); n > 0 && s.x0 <= columns[n-1].x1 {
+			columns[n-1].x1 = maxFloat(columns[n-1].x1, s.x1)
+			continue
+		}
+		columns = append(columns, pdfCell{x0: s.x0, x1: s.x1})
+	}
+
+	rows := make([][]string, len(lines))
+	for i, line := range lines {
+		rows[i] = make([]string, len(columns))
+		for _, cell := range line {
+			c := sort.Search(len(columns), func(c int) bool { return columns[c].x1 >= cell.x0 })
+			text := strings.TrimSpace(cell.text)
+			if rows[i][c] != "" {
+				text = rows[i][c] + " " + text
+			}
+			rows[i][c] = text
+		}
+	}
+	return rows
+}
+
+// maxFloat is max for float64; the package's max takes ints.
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// pdfImportHandler handles POST /api/import/pdf, an upload form whose file is read as a PDF
+// whatever its name.
+func pdfImportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling PDF import request.")
+	buf, opts, ok := readUploadForm(w, r)
+	if !ok {
+		return
+	}
+	opts.Format = formatPDF
+	storeWorkbook(w, r, buf, opts)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// ---------------------------------------------------------------------
+// --- Postgres Store ---
+// ---------------------------------------------------------------------
+
+// With -store postgres://..., datasets are kept in three tables: edms_datasets holds each
+// dataset's datasetInfo, edms_sheets each sheet's headers and layout, and edms_rows each row
+// as a text array. Several instances can share one database; each polls it every
+// storeSyncInterval for the datasets the others saved or deleted (see syncStore). Match
+// results are kept in edms_results until they expire (see results.go). The store also acts
+// as the jobRegistry: running jobs are claimed in edms_jobs, and cancellations are sent with
+// NOTIFY on edms_cancel to the instance running the job.
+
+// pgSchema creates the store's tables. saved is the dataset's Uploaded stamp in Unix
+// nanoseconds, which instances compare to tell whether their copy is current.
+const pgSchema = `
+CREATE TABLE IF NOT EXISTS edms_datasets (
+	id    text PRIMARY KEY,
+	info  jsonb NOT NULL,
+	saved bigint NOT NULL
+);
+CREATE TABLE IF NOT EXISTS edms_sheets (
+	key     text PRIMARY KEY,
+	dataset text NOT NULL REFERENCES edms_datasets (id) ON DELETE CASCADE,
+	meta    jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS edms_sheets_dataset ON edms_sheets (dataset);
+CREATE TABLE IF NOT EXISTS edms_rows (
+	key   text NOT NULL REFERENCES edms_sheets (key) ON DELETE CASCADE,
+	n     integer NOT NULL,
+	cells text[],
+	fills text[],
+	PRIMARY KEY (key, n)
+);
+CREATE TABLE IF NOT EXISTS edms_results (
+	key     text PRIMARY KEY,
+	body    bytea NOT NULL,
+	expires timestamptz NOT NULL
+);
+CREATE TABLE IF NOT EXISTS edms_jobs (
+	id       text PRIMARY KEY,
+	instance text NOT NULL,
+	expires  timestamptz NOT NULL
+);`
+
+// pgCancelChannel is the NOTIFY channel job cancellations are sent on, the job ID as payload.
+const pgCancelChannel = "edms_cancel"
+
+// pgJobTTL bounds how long a job stays claimed, so the claims of an instance that died mid-job
+// expire.
+const pgJobTTL = time.Hour
+
+// pgListenRetry is how long relayCancels waits before reconnecting.
+const pgListenRetry = 5 * time.Second
+
+// pgStore keeps datasets, results and job claims in a Postgres database.
+type pgStore struct {
+	db       *sql.DB
+	instance string             // identifies this instance's job claims
+	stop     context.CancelFunc // ends relayCancels
+}
+
+func openPGStore(dsn string) (*pgStore, error) {
+	name := dsn
+	if u, err := url.Parse(dsn); err == nil {
+		name = u.Redacted()
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", name, err)
+	}
+	s := &pgStore{db: db, instance: randomID()}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	err = s.run(ctx, func(c *pgx.Conn) error {
+		_, err := c.Exec(ctx, pgSchema)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("preparing %s: %v", name, err)
+	}
+	var listen context.Context
+	listen, s.stop = context.WithCancel(context.Background())
+	go s.relayCancels(listen, dsn)
+	return s, nil
+}
+
+// run calls f with a pooled connection, for the pgx features database/sql lacks: arrays and
+// COPY.
+func (s *pgStore) run(ctx context.Context, f func(*pgx.Conn) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(dc any) error {
+		return f(dc.(*stdlib.Conn).Conn())
+	})
+}
+
+func (s *pgStore) load() (map[string]datasetInfo, map[string]SheetData, error) {
+	return s.read("")
+}
+
+func (s *pgStore) loadDataset(id string) (datasetInfo, map[string]SheetData, bool, error) {
+	infos, sheets, err := s.read(id)
+	info, ok := infos[id]
+	return info, sheets, ok, err
+}
+
+// read loads one dataset, or every dataset when id is "".
+func (s *pgStore) read(id string) (map[string]datasetInfo, map[string]SheetData, error) {
+	infos := make(map[string]datasetInfo)
+	sheets := make(map[string]SheetData)
+	ctx := context.Background()
+	err := s.run(ctx, func(c *pgx.Conn) error {
+		tx, err := c.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, _ := tx.Query(ctx, `SELECT id, info FROM edms_datasets WHERE $1 = '' OR id = $1`, id)
+		var key string
+		var raw []byte
+		_, err = pgx.ForEachRow(rows, []any{&key, &raw}, func() error {
+			var info datasetInfo
+			if err := json.Unmarshal(raw, &info); err != nil {
+				return fmt.Errorf("dataset '%s': %v", key, err)
+			}
+			infos[key] = info
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, _ = tx.Query(ctx, `SELECT key, meta FROM edms_sheets WHERE $1 = '' OR dataset = $1`, id)
+		_, err = pgx.ForEachRow(rows, []any{&key, &raw}, func() error {
+			var data SheetData
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return fmt.Errorf("sheet '%s': %v", key, err)
+			}
+			sheets[key] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, _ = tx.Query(ctx, `SELECT r.key, r.cells, r.fills FROM edms_rows r JOIN edms_sheets s ON s.key = r.key
+			WHERE $1 = '' OR s.dataset = $1 ORDER BY r.key, r.n`, id)
+		var cells, fills []string
+		_, err = pgx.ForEachRow(rows, []any{&key, &cells, &fills}, func() error {
+			data := sheets[key]
+			data.Rows = append(data.Rows, cells)
+			if data.Fills != nil {
+				data.Fills = append(data.Fills, fills)
+			}
+			sheets[key] = data
+			cells, fills = nil, nil // the next row gets arrays of its own
+			return nil
+		})
+		return err
+	})
+	return infos, sheets, err
+}
+
+func (s *pgStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	return s.run(ctx, func(c *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, c, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `INSERT INTO edms_datasets (id, info, saved) VALUES ($1, $2, $3)
+				ON CONFLICT (id) DO UPDATE SET info = EXCLUDED.info, saved = EXCLUDED.saved`, id, infoJSON, info.Uploaded.UnixNano())
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM edms_sheets WHERE dataset = $1`, id); err != nil {
+				return err
+			}
+			for key, data := range sheets {
+				// The rows go to edms_rows; an empty Fills records that the sheet has fills.
+				meta := data
+				meta.Rows = nil
+				if data.Fills != nil {
+					meta.Fills = [][]string{}
+				}
+				metaJSON, err := json.Marshal(meta)
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx, `INSERT INTO edms_sheets (key, dataset, meta) VALUES ($1, $2, $3)`, key, id, metaJSON); err != nil {
+					return err
+				}
+				i := 0
+				_, err = tx.CopyFrom(ctx, pgx.Identifier{"edms_rows"}, []string{"key", "n", "cells", "fills"},
+					pgx.CopyFromFunc(func() ([]any, error) {
+						if i == len(data.Rows) {
+							return nil, nil
+						}
+						var fills []string
+						if i < len(data.Fills) {
+							fills = data.Fills[i]
+						}
+						row := []any{key, i, data.Rows[i], fills}
+						i++
+						return row, nil
+					}))
+				if err != nil {
+					return fmt.Errorf("sheet '%s': %v", key, err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (s *pgStore) remove(id string) error {
+	_, err := s.db.Exec(`DELETE FROM edms_datasets WHERE id = $1`, id)
+	return err
+}
+
+func (s *pgStore) stamps() (map[string]int64, error) {
+	rows, err := s.db.Query(`SELECT id, saved FROM edms_datasets`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stamps := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var saved int64
+		if err := rows.Scan(&id, &saved); err != nil {
+			return nil, err
+		}
+		stamps[id] = saved
+	}
+	return stamps, rows.Err()
+}
+
+func (s *pgStore) close() error {
+	s.stop()
+	return s.db.Close()
+}
+
+// saveResult stores a result and drops those that have expired.
+func (s *pgStore) saveResult(key string, body []byte, expires time.Time) error {
+	if _, err := s.db.Exec(`DELETE FROM edms_results WHERE expires <= $1`, time.Now()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO edms_results (key, body, expires) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET body = EXCLUDED.body, expires = EXCLUDED.expires`, key, body, expires)
+	return err
+}
+
+func (s *pgStore) loadResult(key string) ([]byte, bool, error) {
+	var body []byte
+	err := s.db.QueryRow(`SELECT body FROM edms_results WHERE key = $1 AND expires > $2`, key, time.Now()).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	return body, err == nil, err
+}
+
+// claim inserts the job's row, or takes over one whose claim has expired. Expiry is judged by
+// the database's clock, which all instances share.
+func (s *pgStore) claim(id string) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO edms_jobs (id, instance, expires) VALUES ($1, $2, now() + $3 * interval '1 second')
+		ON CONFLICT (id) DO UPDATE SET instance = EXCLUDED.instance, expires = EXCLUDED.expires
+		WHERE edms_jobs.expires <= now()`, id, s.instance, int64(pgJobTTL/time.Second))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *pgStore) release(id string) {
+	if _, err := s.db.Exec(`DELETE FROM edms_jobs WHERE id = $1 AND instance = $2`, id, s.instance); err != nil {
+		log.Printf("WARN: Failed to release job '%s': %v", id, err)
+	}
+}
+
+func (s *pgStore) cancel(id string) (bool, error) {
+	var running bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM edms_jobs WHERE id = $1 AND expires > now())`, id).Scan(&running)
+	if err != nil || !running {
+		return false, err
+	}
+	_, err = s.db.Exec(`SELECT pg_notify($1, $2)`, pgCancelChannel, id)
+	return true, err
+}
+
+// relayCancels cancels the jobs of this instance that are cancelled through another one. It
+// listens on a connection of its own, outside the pool, and reconnects if that drops, until
+// ctx ends.
+func (s *pgStore) relayCancels(ctx context.Context, dsn string) {
+	for {
+		err := listenCancels(ctx, dsn)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("WARN: Lost the job cancellation channel, reconnecting in %v: %v", pgListenRetry, err)
+		time.Sleep(pgListenRetry)
+	}
+}
+
+// listenCancels relays cancellations until the connection fails.
+func listenCancels(ctx context.Context, dsn string) error {
+	c, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer c.Close(context.Background())
+	if _, err := c.Exec(ctx, "LISTEN "+pgCancelChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := c.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if cancelLocalJob(n.Payload) {
+			log.Printf("INFO: Cancelled job '%s' at the request of another instance.", n.Payload)
+		}
+	}
+}
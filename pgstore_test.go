@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestPGStore opens the database named by EDMS_TEST_POSTGRES, skipping the test when it is
+// unset.
+func openTestPGStore(t *testing.T) *pgStore {
+	t.Helper()
+	dsn := os.Getenv("EDMS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("EDMS_TEST_POSTGRES is not set")
+	}
+	s, err := openPGStore(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.close() })
+	return s
+}
+
+func TestPGJobRegistry(t *testing.T) {
+	a := openTestPGStore(t)
+	b := openTestPGStore(t) // a second instance sharing the database
+	job := "pg-test-" + randomID()
+	defer a.release(job)
+
+	tests := []struct {
+		name string
+		run  func() (bool, error)
+		want bool
+	}{
+		{"the first claim wins", func() (bool, error) { return a.claim(job) }, true},
+		{"another instance cannot claim a running job", func() (bool, error) { return b.claim(job) }, false},
+		{"another instance can cancel it", func() (bool, error) { return b.cancel(job) }, true},
+		{"a released job is no longer running", func() (bool, error) { a.release(job); return b.cancel(job) }, false},
+		{"a released job can be claimed again", func() (bool, error) { return b.claim(job) }, true},
+		{"only the claiming instance releases it", func() (bool, error) { a.release(job); return a.cancel(job) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	b.release(job)
+}
+
+func TestPGCancelReachesRunningInstance(t *testing.T) {
+	a := openTestPGStore(t)
+	b := openTestPGStore(t)
+	job := "pg-test-" + randomID()
+	cancelled := make(chan struct{})
+	var once sync.Once // both stores listen in this process
+	jobMutex.Lock()
+	jobs[job] = func() { once.Do(func() { close(cancelled) }) }
+	jobMutex.Unlock()
+	defer func() {
+		jobMutex.Lock()
+		delete(jobs, job)
+		jobMutex.Unlock()
+		a.release(job)
+	}()
+	if ok, err := a.claim(job); !ok || err != nil {
+		t.Fatalf("claim: %v %v", ok, err)
+	}
+	time.Sleep(100 * time.Millisecond) // let the listeners connect
+	if ok, err := b.cancel(job); !ok || err != nil {
+		t.Fatalf("cancel: %v %v", ok, err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job was not cancelled")
+	}
+}
+
+func TestPGResults(t *testing.T) {
+	s := openTestPGStore(t)
+	key := "pg-test-" + randomID()
+	tests := []struct {
+		name      string
+		expires   time.Duration
+		wantFound bool
+	}{
+		{"a result is kept until it expires", time.Hour, true},
+		{"an expired result is gone", -time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.saveResult(key, []byte("[]\n"), time.Now().Add(tt.expires)); err != nil {
+				t.Fatal(err)
+			}
+			body, found, err := s.loadResult(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound || found && string(body) != "[]\n" {
+				t.Fatalf("got %q %v, want found %v", body, found, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// ---------------------------------------------------------------------
+// --- Phone Number Matching ---
+// ---------------------------------------------------------------------
+
+// The "phone" algorithm matches values on the phone number they hold, compared in E.164 form
+// after parsing with libphonenumber's rules, so "+1 (555) 010-2222", "011 1 555 010 2222" and
+// "5550102222" are one number. Numbers written without a country code are read as numbers of
+// MatchRequest.PhoneRegion, "US" by default, so a UK column would set "GB" to match
+// "020 7946 0000" with "+44 20 7946 0000". Extensions are ignored, and values that cannot be
+// a phone number never match. The threshold plays no part: numbers match or they do not.
+
+// defaultPhoneRegion is the region of numbers without a country code when PhoneRegion is unset.
+const defaultPhoneRegion = "US"
+
+// validatePhoneOptions rejects unknown phone regions.
+func validatePhoneOptions(req MatchRequest) error {
+	if req.PhoneRegion == "" || phonenumbers.GetSupportedRegions()[strings.ToUpper(req.PhoneRegion)] {
+		return nil
+	}
+	return fmt.Errorf("unknown phoneRegion '%s' (expected a two-letter region code such as US or GB)", req.PhoneRegion)
+}
+
+// phoneColumn returns the score function for sheet2 column c.
+func phoneColumn(ix *matchIndex, c int, p scoreParams) scoreFunc {
+	return canonicalColumn(ix, c, func(v string) string { return canonicalPhone(v, p.phoneRegion) })
+}
+
+// canonicalPhone returns the E.164 form of the number in v, or "" when v cannot be one.
+func canonicalPhone(v, region string) string {
+	num, err := phonenumbers.Parse(v, region)
+	if err != nil || !phonenumbers.IsPossibleNumber(num) {
+		return ""
+	}
+	return phonenumbers.Format(num, phonenumbers.E164)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Phonetic Matching ---
+// ---------------------------------------------------------------------
+
+// The "phonetic" algorithm compares how keys sound rather than how they are spelled: each
+// word is reduced to its Metaphone code, so "Catherine" and "Katharine" both become K0RN, and
+// the codes are compared by edit distance. Soundex would miss that pair, as it keeps the first
+// letter as written. The threshold applies to the codes: 0 accepts only keys that sound alike
+// word for word, and higher values tolerate codes differing a little.
+
+// phoneticScore compares keys by the similarity of their phonetic codes.
+func phoneticScore(key1, key2 string, p scoreParams) (int, float64, bool) {
+	code1, code2 := phoneticCode(key1), phoneticCode(key2)
+	if code1 == "" || code2 == "" {
+		return 0, 0, false
+	}
+	ratio := editRatio(levenshteinDistance(code1, code2), code1, code2)
+	if (1-ratio)*100 > float64(p.threshold) {
+		return 0, 0, false
+	}
+	return levenshteinDistance(key1, key2), ratio, true
+}
+
+// phoneticCode returns the Metaphone codes of a key's words, separated by spaces.
+func phoneticCode(key string) string {
+	words := strings.FieldsFunc(key, notAlphanumeric)
+	codes := make([]string, 0, len(words))
+	for _, word := range words {
+		if code := metaphone(word); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return strings.Join(codes, " ")
+}
+
+// metaphone returns the Metaphone code of one word, following Lawrence Philips' original
+// rules, with 0 standing for "th". Letters outside a-z are dropped and digits are kept as they
+// are, so "unit 12" and "unit 21" still differ.
+func metaphone(word string) string {
+	w := make([]byte, 0, len(word))
+	for _, r := range strings.ToLower(word) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			w = append(w, byte(r))
+		}
+	}
+	if len(w) == 0 {
+		return ""
+	}
+
+	// Initial letter exceptions.
+	switch s := string(w); {
+	case strings.HasPrefix(s, "ae"), strings.HasPrefix(s, "gn"), strings.HasPrefix(s, "kn"),
+		strings.HasPrefix(s, "pn"), strings.HasPrefix(s, "wr"):
+		w = w[1:]
+	case strings.HasPrefix(s, "wh"):
+		w = w[1:]
+		w[0] = 'w'
+	case w[0] == 'x':
+		w[0] = 's'
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	vowel := func(c byte) bool { return c != 0 && strings.IndexByte("aeiou", c) >= 0 }
+	frontVowel := func(c byte) bool { return c != 0 && strings.IndexByte("eiy", c) >= 0 }
+
+	var code strings.Builder
+	for i, c := range w {
+		if c == at(i-1) && c != 'c' {
+			continue // doubled letters sound once
+		}
+		prev, next := at(i-1), at(i+1)
+		switch c {
+		case 'a', 'e', 'i', 'o', 'u':
+			if i == 0 {
+				code.WriteByte(c - 'a' + 'A')
+			}
+		case 'b':
+			if !(prev == 'm' && i == len(w)-1) {
+				code.WriteByte('B')
+			}
+		case 'c':
+			switch {
+			case next == 'i' && at(i+2) == 'a', next == 'h' && prev != 's':
+				code.WriteByte('X')
+			case frontVowel(next):
+				if prev != 's' {
+					code.WriteByte('S')
+				}
+			default:
+				code.WriteByte('K')
+			}
+		case 'd':
+			if next == 'g' && frontVowel(at(i+2)) {
+				code.WriteByte('J')
+			} else {
+				code.WriteByte('T')
+			}
+		case 'g':
+			switch {
+			case next == 'h' && !vowel(at(i+2)):
+			case next == 'n' && (i+2 == len(w) || at(i+2) == 'e' && at(i+3) == 'd' && i+4 == len(w)):
+			case frontVowel(next):
+				code.WriteByte('J')
+			default:
+				code.WriteByte('K')
+			}
+		case 'h':
+			if vowel(next) && strings.IndexByte("cgpst", prev) < 0 {
+				code.WriteByte('H')
+			}
+		case 'k':
+			if prev != 'c' {
+				code.WriteByte('K')
+			}
+		case 'p':
+			if next == 'h' {
+				code.WriteByte('F')
+			} else {
+				code.WriteByte('P')
+			}
+		case 'q':
+			code.WriteByte('K')
+		case 's':
+			if next == 'h' || next == 'i' && (at(i+2) == 'o' || at(i+2) == 'a') {
+				code.WriteByte('X')
+			} else {
+				code.WriteByte('S')
+			}
+		case 't':
+			switch {
+			case next == 'i' && (at(i+2) == 'o' || at(i+2) == 'a'):
+				code.WriteByte('X')
+			case next == 'h':
+				code.WriteByte('0')
+			case next == 'c' && at(i+2) == 'h':
+			default:
+				code.WriteByte('T')
+			}
+		case 'v':
+			code.WriteByte('F')
+		case 'w', 'y':
+			if vowel(next) {
+				code.WriteByte(c - 'a' + 'A')
+			}
+		case 'x':
+			code.WriteString("KS")
+		case 'z':
+			code.WriteByte('S')
+		default: // f, j, l, m, n, r and digits sound as written
+			if c >= 'a' {
+				c -= 'a' - 'A'
+			}
+			code.WriteByte(c)
+		}
+	}
+	return code.String()
+}
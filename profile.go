@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ---------------------------------------------------------------------
+// --- Session Profiles ---
+// ---------------------------------------------------------------------
+
+// sessionHeader identifies the client session a normalization profile belongs to.
+const sessionHeader = "X-EDMS-Session"
+
+var (
+	profiles     = make(map[string]NormalizeOptions)
+	profileMutex sync.RWMutex
+)
+
+// sessionID returns the session named by the request header, or "" when there is none.
+func sessionID(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(sessionHeader))
+}
+
+// profileDefaults returns the session's stored normalization profile, or the zero options.
+// Handlers use it to pre-fill Normalize before decoding a request, so any option the
+// request spells out overrides the profile while the rest keep the profile's value.
+func profileDefaults(r *http.Request) NormalizeOptions {
+	id := sessionID(r)
+	if id == "" {
+		return NormalizeOptions{}
+	}
+	profileMutex.RLock()
+	defer profileMutex.RUnlock()
+	return profiles[id].clone()
+}
+
+// clone copies the options so that decoding a request into them cannot modify a stored profile.
+func (o NormalizeOptions) clone() NormalizeOptions {
+	o.NameColumns = append([]string(nil), o.NameColumns...)
+	o.TrimOnlyColumns = append([]string(nil), o.TrimOnlyColumns...)
+	if o.UnitAliases != nil {
+		aliases := make(map[string]string, len(o.UnitAliases))
+		for k, v := range o.UnitAliases {
+			aliases[k] = v
+		}
+		o.UnitAliases = aliases
+	}
+	return o
+}
+
+// profileHandler serves /api/profile: POST stores the session's default normalization options
+// (a NormalizeOptions object), GET returns them and DELETE clears them.
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+	id := sessionID(r)
+	if id == "" {
+		http.Error(w, sessionHeader+" header is required.", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		var opts NormalizeOptions
+		if !decodeJSONBody(w, r, &opts) {
+			return
+		}
+		profileMutex.Lock()
+		profiles[id] = opts
+		profileMutex.Unlock()
+		log.Printf("INFO: Stored normalization profile for session '%s'.", id)
+	case "GET":
+	case "DELETE":
+		profileMutex.Lock()
+		delete(profiles, id)
+		profileMutex.Unlock()
+		log.Printf("INFO: Cleared normalization profile for session '%s'.", id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profileDefaults(r))
+}
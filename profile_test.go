@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveSession runs handler on a request of the session with a raw JSON body.
+func serveSession(handler http.HandlerFunc, method, target, session, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if session != "" {
+		r.Header.Set(sessionHeader, session)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestProfileDefaults(t *testing.T) {
+	putSheets(t, map[string]SheetData{
+		"profile/A": {Headers: []string{"Name"}, Rows: [][]string{{"Ann"}, {"Zoë"}}},
+		"profile/B": {Headers: []string{"Name"}, Rows: [][]string{{"ann"}, {"Zoe"}}},
+	})
+	const session = "profile-test"
+	if w := serveSession(profileHandler, "POST", "/api/profile", session, `{"caseSensitive":true}`); w.Code != http.StatusOK {
+		t.Fatalf("store profile: %d %s", w.Code, w.Body)
+	}
+	defer serveSession(profileHandler, "DELETE", "/api/profile", session, "")
+
+	tests := []struct {
+		name      string
+		session   string
+		normalize string
+		want      []string // matched sheet1 values
+	}{
+		{"the profile applies", session, "", []string{}},
+		{"the request overrides it", session, `,"normalize":{"caseSensitive":false}`, []string{"Ann"}},
+		{"options the request leaves out keep the profile's", session, `,"normalize":{"ignoreDiacritics":true}`, []string{"Zoë"}},
+		{"both combine", session, `,"normalize":{"caseSensitive":false,"ignoreDiacritics":true}`, []string{"Ann", "Zoë"}},
+		{"other sessions are unaffected", "other-session", "", []string{"Ann"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"sheet1":"profile/A","sheet2":"profile/B"` + tt.normalize + `}`
+			w := serveSession(matchHandler, "POST", "/api/match", tt.session, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("match: %d %s", w.Code, w.Body)
+			}
+			got := []string{}
+			for _, g := range decodeGroups(t, w) {
+				for _, m := range g.Matches {
+					got = append(got, m.Val1)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	serveSession(profileHandler, "DELETE", "/api/profile", session, "")
+	if w := serveSession(matchHandler, "POST", "/api/match", session, `{"sheet1":"profile/A","sheet2":"profile/B"}`); len(decodeGroups(t, w)) != 1 {
+		t.Errorf("a cleared profile still applies: %s", w.Body)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Store Quota & Expiry ---
+// ---------------------------------------------------------------------
+
+// A long-running server can cap the data store. With -store-max-bytes set, an upload that
+// would take the store's estimated size past the quota first discards the oldest versions
+// kept for rollback and, if that is not enough, fails with 507 Insufficient Storage. Sizes are
+// estimates: the cells' text plus string and slice headers, the file size for sheets of lazy
+// uploads not parsed yet, and every version counted in full even where it shares sheets with
+// the current contents. With -dataset-ttl set, a background sweep deletes datasets and
+// versions not updated within the TTL.
+
+// Quota and expiry settings, set from flags in main; 0 disables either.
+var (
+	storeMaxBytes int64
+	datasetTTL    time.Duration
+)
+
+// errStoreFull is returned when an upload does not fit in the store quota.
+var errStoreFull = errors.New("Store is full")
+
+// bytes estimates the memory a sheet holds. The text of spilled rows is not counted.
+func (d SheetData) bytes() int64 {
+	return rowsBytes([][]string{d.Headers}, true) + rowsBytes(d.Rows, !d.spilled) + rowsBytes(d.Fills, true)
+}
+
+// rowsBytes estimates the memory of rows: their slice and string headers, and the text too
+// unless withText is false.
+func rowsBytes(rows [][]string, withText bool) int64 {
+	n := int64(0)
+	for _, row := range rows {
+		n += 24 + 16*int64(len(row))
+		if !withText {
+			continue
+		}
+		for _, cell := range row {
+			n += int64(len(cell))
+		}
+	}
+	return n
+}
+
+// storeBytesLocked returns the estimated size of every dataset and version. Callers must hold
+// storeMutex.
+func storeBytesLocked() int64 {
+	n := int64(0)
+	for id, info := range datasets {
+		n += info.Bytes
+		for _, v := range versions[id] {
+			n += v.info.Bytes
+		}
+	}
+	return n
+}
+
+// reserveLocked makes room for adding bytes to the store, discarding versions oldest first if
+// need be, or returns an error wrapping errStoreFull. The books of discarded versions are
+// closed unless listed in keep. Callers must hold storeMutex.
+func reserveLocked(adding int64, keep ...*lazyWorkbook) error {
+	if storeMaxBytes <= 0 {
+		return nil
+	}
+	used := storeBytesLocked()
+	need := used + adding - storeMaxBytes
+	if need <= 0 {
+		return nil
+	}
+
+	type oldVersion struct {
+		id string
+		v  datasetVersion
+	}
+	var old []oldVersion
+	reclaimable := int64(0)
+	for id, history := range versions {
+		for _, v := range history {
+			old = append(old, oldVersion{id, v})
+			reclaimable += v.info.Bytes
+		}
+	}
+	if reclaimable < need {
+		return fmt.Errorf("%w: the upload needs about %s but only %s of the %s quota is free; delete datasets to make room",
+			errStoreFull, formatBytes(adding), formatBytes(max64(storeMaxBytes-used, 0)), formatBytes(storeMaxBytes))
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].v.info.Uploaded.Before(old[j].v.info.Uploaded) })
+	dropped := make(map[string]int)
+	for _, o := range old {
+		if need <= 0 {
+			break
+		}
+		need -= o.v.info.Bytes
+		dropped[o.id]++
+	}
+	for id, n := range dropped {
+		evicted := versions[id][:n]
+		versions[id] = append([]datasetVersion(nil), versions[id][n:]...)
+		for _, v := range evicted {
+			closeUnusedBooksLocked(id, v.info.books, keep...)
+		}
+		log.Printf("INFO: Discarded %d old version(s) of dataset '%s' to stay within the store quota.", n, id)
+	}
+	return nil
+}
+
+// runExpiry deletes expired datasets and versions until the process exits.
+func runExpiry() {
+	interval := datasetTTL / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	} else if interval < time.Second {
+		interval = time.Second
+	}
+	for range time.Tick(interval) {
+		expireDatasets(time.Now())
+	}
+}
+
+// expireDatasets deletes the datasets and versions last updated more than datasetTTL before now.
+func expireDatasets(now time.Time) {
+	cutoff := now.Add(-datasetTTL)
+	var expired []string
+	storeMutex.Lock()
+	for id, info := range datasets {
+		if info.Uploaded.Before(cutoff) {
+			removeDatasetLocked(id)
+			expired = append(expired, id)
+		}
+	}
+	for id, history := range versions {
+		n := 0
+		for n < len(history) && history[n].info.Uploaded.Before(cutoff) {
+			n++
+		}
+		if n > 0 {
+			versions[id] = append([]datasetVersion(nil), history[n:]...)
+			for _, v := range history[:n] {
+				closeUnusedBooksLocked(id, v.info.books)
+			}
+		}
+	}
+	storeMutex.Unlock()
+
+	for _, id := range expired {
+		unpersistDataset(id)
+		log.Printf("INFO: Dataset '%s' expired after %v.", id, datasetTTL)
+	}
+}
+
+// formatBytes prints a byte count in binary units ("12.5 MiB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// max64 is max for int64; the package's max takes ints.
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------
+// --- Redis Store ---
+// ---------------------------------------------------------------------
+
+// With -store redis://..., datasets are kept in Redis so instances behind a load balancer
+// share them: datasetInfo as JSON under edms:dataset:{id}, each sheet as JSON under
+// edms:sheet:{key}, the sheet keys of a dataset in the set edms:sheets:{id}, and the stamp
+// each dataset was saved at in the hash edms:saved, which syncStore polls. A sheet is one Redis
+// string, so it must stay under Redis's 512 MB value limit. Match results are kept under
+// edms:result:{key}, expiring with them. The store also acts as the jobRegistry: running jobs
+// are claimed under edms:job:{id}, and cancellations are published on edms:cancel for the
+// instance running the job.
+
+// Redis key names.
+const (
+	redisSaved         = "edms:saved"
+	redisDatasetPrefix = "edms:dataset:"
+	redisSheetsPrefix  = "edms:sheets:"
+	redisSheetPrefix   = "edms:sheet:"
+	redisResultPrefix  = "edms:result:"
+	redisJobPrefix     = "edms:job:"
+	redisCancelChannel = "edms:cancel"
+)
+
+// redisJobTTL bounds how long a job stays claimed, so the claims of an instance that died
+// mid-job expire.
+const redisJobTTL = time.Hour
+
+// redisRelease deletes a job claim only if this instance still holds it.
+var redisRelease = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// redisStore keeps datasets, results and job claims in Redis.
+type redisStore struct {
+	client   *redis.Client
+	instance string // identifies this instance's job claims
+}
+
+func openRedisStore(spec string) (*redisStore, error) {
+	name := spec
+	if u, err := url.Parse(spec); err == nil {
+		name = u.Redacted()
+	}
+	opts, err := redis.ParseURL(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL '%s': %v", name, err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to %s: %v", name, err)
+	}
+	s := &redisStore{client: client, instance: randomID()}
+	go s.relayCancels()
+	return s, nil
+}
+
+func (s *redisStore) load() (map[string]datasetInfo, map[string]SheetData, error) {
+	ids, err := s.client.HKeys(context.Background(), redisSaved).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	infos := make(map[string]datasetInfo, len(ids))
+	sheets := make(map[string]SheetData)
+	for _, id := range ids {
+		info, dataset, found, err := s.loadDataset(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			continue // deleted meanwhile
+		}
+		infos[id] = info
+		for key, data := range dataset {
+			sheets[key] = data
+		}
+	}
+	return infos, sheets, nil
+}
+
+func (s *redisStore) loadDataset(id string) (datasetInfo, map[string]SheetData, bool, error) {
+	ctx := context.Background()
+	raw, err := s.client.Get(ctx, redisDatasetPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return datasetInfo{}, nil, false, nil
+	}
+	if err != nil {
+		return datasetInfo{}, nil, false, err
+	}
+	var info datasetInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return datasetInfo{}, nil, false, fmt.Errorf("dataset '%s': %v", id, err)
+	}
+
+	keys, err := s.client.SMembers(ctx, redisSheetsPrefix+id).Result()
+	if err != nil || len(keys) == 0 {
+		return info, map[string]SheetData{}, true, err
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = redisSheetPrefix + key
+	}
+	values, err := s.client.MGet(ctx, names...).Result()
+	if err != nil {
+		return datasetInfo{}, nil, false, err
+	}
+	sheets := make(map[string]SheetData, len(keys))
+	for i, v := range values {
+		text, ok := v.(string)
+		if !ok {
+			continue // deleted by a concurrent save
+		}
+		var data SheetData
+		if err := json.Unmarshal([]byte(text), &data); err != nil {
+			return datasetInfo{}, nil, false, fmt.Errorf("sheet '%s': %v", keys[i], err)
+		}
+		sheets[keys[i]] = data
+	}
+	return info, sheets, true, nil
+}
+
+func (s *redisStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	ctx := context.Background()
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]byte, len(sheets))
+	for key, data := range sheets {
+		if values[key], err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	old, err := s.client.SMembers(ctx, redisSheetsPrefix+id).Result()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range old {
+			if _, kept := values[key]; !kept {
+				p.Del(ctx, redisSheetPrefix+key)
+			}
+		}
+		p.Del(ctx, redisSheetsPrefix+id)
+		for key, v := range values {
+			p.Set(ctx, redisSheetPrefix+key, v, 0)
+			p.SAdd(ctx, redisSheetsPrefix+id, key)
+		}
+		p.Set(ctx, redisDatasetPrefix+id, infoJSON, 0)
+		p.HSet(ctx, redisSaved, id, info.Uploaded.UnixNano())
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) remove(id string) error {
+	ctx := context.Background()
+	keys, err := s.client.SMembers(ctx, redisSheetsPrefix+id).Result()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.Del(ctx, redisSheetPrefix+key)
+		}
+		p.Del(ctx, redisSheetsPrefix+id, redisDatasetPrefix+id)
+		p.HDel(ctx, redisSaved, id)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) stamps() (map[string]int64, error) {
+	saved, err := s.client.HGetAll(context.Background(), redisSaved).Result()
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]int64, len(saved))
+	for id, v := range saved {
+		if stamps[id], err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("stamp of dataset '%s': %v", id, err)
+		}
+	}
+	return stamps, nil
+}
+
+func (s *redisStore) close() error {
+	return s.client.Close()
+}
+
+func (s *redisStore) saveResult(key string, body []byte, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		return nil // expired already
+	}
+	return s.client.Set(context.Background(), redisResultPrefix+key, body, ttl).Err()
+}
+
+func (s *redisStore) loadResult(key string) ([]byte, bool, error) {
+	body, err := s.client.Get(context.Background(), redisResultPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return body, err == nil, err
+}
+
+func (s *redisStore) claim(id string) (bool, error) {
+	return s.client.SetNX(context.Background(), redisJobPrefix+id, s.instance, redisJobTTL).Result()
+}
+
+func (s *redisStore) release(id string) {
+	if err := redisRelease.Run(context.Background(), s.client, []string{redisJobPrefix + id}, s.instance).Err(); err != nil {
+		log.Printf("WARN: Failed to release job '%s': %v", id, err)
+	}
+}
+
+func (s *redisStore) cancel(id string) (bool, error) {
+	ctx := context.Background()
+	n, err := s.client.Exists(ctx, redisJobPrefix+id).Result()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, s.client.Publish(ctx, redisCancelChannel, id).Err()
+}
+
+// relayCancels cancels the jobs of this instance that are cancelled through another one. The
+// subscription reconnects by itself if the connection drops.
+func (s *redisStore) relayCancels() {
+	sub := s.client.Subscribe(context.Background(), redisCancelChannel)
+	for msg := range sub.Channel() {
+		if cancelLocalJob(msg.Payload) {
+			log.Printf("INFO: Cancelled job '%s' at the request of another instance.", msg.Payload)
+		}
+	}
+}
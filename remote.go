@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits for server-side fetches of remote workbooks.
+var (
+	remoteMaxBytes int64 = 50 << 20
+	remoteTimeout        = 30 * time.Second
+)
+
+// UploadURLRequest asks the server to fetch a workbook from a URL instead of a direct upload.
+// The embedded Format may name the file's format; otherwise the URL's extension or, failing
+// that, the response's Content-Type decides.
+type UploadURLRequest struct {
+	URL string `json:"url"`
+	uploadOptions
+}
+
+// contentTypeFormats maps response media types to upload formats, for URLs without a
+// recognizable extension.
+var contentTypeFormats = map[string]string{
+	"text/csv":                  formatCSV,
+	"text/tab-separated-values": formatTSV,
+	"application/vnd.ms-excel":  formatXLS,
+	"application/vnd.oasis.opendocument.spreadsheet": formatODS,
+	"application/zip":                formatZIP,
+	"application/json":               formatJSON,
+	"application/vnd.apache.parquet": formatParquet,
+	"application/pdf":                formatPDF,
+	"application/xml":                formatXML,
+	"text/xml":                       formatXML,
+	xlsxContentType:                  formatXLSX,
+}
+
+// fetchRemoteFile downloads an http(s) URL with the configured timeout and size cap, returning
+// the body and its Content-Type. The int is the HTTP status to report to the client alongside any error.
+func fetchRemoteFile(rawURL string) (*bytes.Buffer, string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("invalid URL '%s': only absolute http and https URLs are supported", rawURL)
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+	return fetchRemote(req)
+}
+
+// fetchRemote performs a prepared GET request under the same limits as fetchRemoteFile.
+func fetchRemote(req *http.Request) (*bytes.Buffer, string, int, error) {
+	u := req.URL
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", http.StatusBadGateway, fmt.Errorf("error fetching %s: %v", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", http.StatusBadGateway, fmt.Errorf("fetching %s returned %s", u.Redacted(), resp.Status)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	body := http.MaxBytesReader(nil, resp.Body, remoteMaxBytes)
+	if _, err := io.Copy(buf, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "", http.StatusRequestEntityTooLarge, fmt.Errorf("remote file exceeds %d bytes", remoteMaxBytes)
+		}
+		return nil, "", http.StatusBadGateway, fmt.Errorf("error reading %s: %v", u.Redacted(), err)
+	}
+	return buf, resp.Header.Get("Content-Type"), http.StatusOK, nil
+}
+
+// detectRemoteFormat falls back to the Content-Type of a fetched file when neither an explicit
+// format nor the file name's extension says what it is.
+func (opts *uploadOptions) detectRemoteFormat(contentType string) {
+	if _, known := formatExtensions[strings.ToLower(path.Ext(opts.Filename))]; opts.Format != "" || known {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	opts.Format = contentTypeFormats[mediaType]
+}
+
+// uploadURLHandler fetches a workbook from a URL and stores it like a direct upload. It serves
+// both /api/upload-url and /api/import-url.
+func uploadURLHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling URL upload request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req UploadURLRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	buf, contentType, status, err := fetchRemoteFile(req.URL)
+	if err != nil {
+		log.Printf("ERROR: URL upload failed: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("INFO: Fetched remote file (%d bytes).", buf.Len())
+
+	if u, err := url.Parse(req.URL); err == nil {
+		req.Filename = path.Base(u.Path)
+	}
+	req.detectRemoteFormat(contentType)
+	storeWorkbook(w, r, buf, req.uploadOptions)
+}
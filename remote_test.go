@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUploadURL(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people.csv":
+			w.Write([]byte("id,name\n1,Ann\n2,Bob\n"))
+		case "/download":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Write([]byte("id,name\n1,Ann\n"))
+		case "/big.csv":
+			w.Write([]byte("id\n" + strings.Repeat("1\n", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+	defer func(n int64) { remoteMaxBytes = n }(remoteMaxBytes)
+	remoteMaxBytes = 100
+
+	const session = "url-test"
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantSheets []string
+		wantMsg    string
+	}{
+		{"a csv is fetched and stored", remote.URL + "/people.csv", http.StatusOK, []string{"remote/people"}, ""},
+		{"the Content-Type names a format the path does not", remote.URL + "/download", http.StatusOK, []string{"remote/download"}, ""},
+		{"a file over the cap is refused", remote.URL + "/big.csv", http.StatusRequestEntityTooLarge, nil, "exceeds 100 bytes"},
+		{"a failed fetch is a bad gateway", remote.URL + "/gone.csv", http.StatusBadGateway, nil, "404 Not Found"},
+		{"other schemes are refused", "ftp://example.com/people.csv", http.StatusBadRequest, nil, "only absolute http and https URLs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				storeMutex.Lock()
+				removeDatasetLocked(scopedKey(session, "remote"))
+				storeMutex.Unlock()
+			}()
+			body, _ := json.Marshal(map[string]string{"url": tt.url, "dataset": "remote"})
+			r := httptest.NewRequest("POST", "/api/upload-url", bytes.NewReader(body))
+			r.Header.Set(sessionHeader, session)
+			w := httptest.NewRecorder()
+			uploadURLHandler(w, r)
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantMsg) {
+				t.Fatalf("got %d %q, want %d with %q", w.Code, w.Body, tt.wantStatus, tt.wantMsg)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var res uploadResult
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res.SheetNames, tt.wantSheets) {
+				t.Fatalf("sheets %q, want %q", res.SheetNames, tt.wantSheets)
+			}
+			if data, ok, _ := getSessionSheet(session, res.SheetNames[0]); !ok || len(data.Rows) == 0 || data.Rows[0][1] != "Ann" {
+				t.Fatalf("stored sheet %+v (found %t), want Ann's row first", data, ok)
+			}
+		})
+	}
+}
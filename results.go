@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Stored Results ---
+// ---------------------------------------------------------------------
+
+// With a store that implements resultStore, the response of every match job is also saved
+// under its job ID for resultTTL, so GET /api/results/{id} serves it again after a restart or
+// from another instance sharing the store. Results are keyed within the client's session, as
+// datasets are.
+
+// resultStore persists match results by scoped job ID. It is implemented by the stores.
+type resultStore interface {
+	saveResult(key string, body []byte, expires time.Time) error // replaces any result held before
+	loadResult(key string) ([]byte, bool, error)                 // false once the result has expired
+}
+
+// results is the configured resultStore; nil keeps no results.
+var results resultStore
+
+// resultTTL is how long a stored result can be fetched; set from a flag in main.
+var resultTTL = 24 * time.Hour
+
+// keepResult saves the response body of the request's match job, if results are stored.
+func keepResult(w http.ResponseWriter, r *http.Request, body []byte) {
+	job := w.Header().Get(jobHeader)
+	if results == nil || job == "" || resultTTL <= 0 {
+		return
+	}
+	key := scopedKey(sessionID(r), job)
+	if err := results.saveResult(key, body, time.Now().Add(resultTTL)); err != nil {
+		log.Printf("ERROR: Failed to store the result of job '%s': %v", job, err)
+	}
+}
+
+// resultsHandler serves GET /api/results/{id}, the stored result of a finished match job.
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	job := strings.TrimPrefix(r.URL.Path, "/api/results/")
+	if job == "" {
+		http.Error(w, "Job not specified.", http.StatusBadRequest)
+		return
+	}
+	if results == nil {
+		http.Error(w, "Results are not stored; start the server with -store.", http.StatusNotFound)
+		return
+	}
+	body, found, err := results.loadResult(scopedKey(session, job))
+	if err != nil {
+		log.Printf("ERROR: Failed to load the result of job '%s': %v", job, err)
+		http.Error(w, "Error reading the result from the store.", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("No stored result for job '%s'.", job), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
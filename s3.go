@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- S3 Import ---
+// ---------------------------------------------------------------------
+
+// S3-compatible service used by /api/import/s3. Credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables; without them
+// requests are sent unsigned, which works for public buckets.
+var (
+	s3Endpoint = "https://s3.amazonaws.com"
+	s3Region   = "us-east-1"
+)
+
+// S3ImportRequest names an object to load from a bucket, stored like a direct upload.
+type S3ImportRequest struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	uploadOptions
+}
+
+// s3ObjectURL builds the path-style URL of an object, which MinIO and S3 both accept.
+func s3ObjectURL(endpoint, bucket, key string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint '%s'", endpoint)
+	}
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + s3Escape(bucket) + "/" + strings.Join(segments, "/")
+	if u.Path, err = url.PathUnescape(escaped); err != nil {
+		return nil, err
+	}
+	u.RawPath = escaped
+	return u, nil
+}
+
+// s3Escape percent-encodes everything but RFC 3986 unreserved characters, as SigV4 requires.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body, used for GET requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signS3Request adds an AWS Signature Version 4 Authorization header to a body-less request
+// without query parameters.
+func signS3Request(req *http.Request, accessKey, secretKey, sessionToken, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, emptyPayloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3ImportHandler handles POST /api/import/s3, loading one object from a bucket.
+func s3ImportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("INFO: Handling S3 import request.")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req S3ImportRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Bucket == "" || req.Key == "" || strings.Contains(req.Bucket, "/") {
+		http.Error(w, "Both bucket and key are required.", http.StatusBadRequest)
+		return
+	}
+
+	u, err := s3ObjectURL(s3Endpoint, req.Bucket, req.Key)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	get, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if accessKey := os.Getenv("AWS_ACCESS_KEY_ID"); accessKey != "" {
+		signS3Request(get, accessKey, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"), s3Region, time.Now())
+	}
+
+	buf, contentType, status, err := fetchRemote(get)
+	if err != nil {
+		log.Printf("ERROR: S3 import failed: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("INFO: Fetched s3://%s/%s (%d bytes).", req.Bucket, req.Key, buf.Len())
+
+	req.Filename = path.Base(req.Key)
+	req.detectRemoteFormat(contentType)
+	storeWorkbook(w, r, buf, req.uploadOptions)
+}
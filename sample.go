@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// SampledMatch is a single match drawn for QA review, tagged with the column pair it came from.
+type SampledMatch struct {
+	Header1 string `json:"header1"`
+	Header2 string `json:"header2"`
+	MatchResult
+}
+
+// MatchSample is the response returned instead of the full group list when a sample is requested.
+type MatchSample struct {
+	TotalMatches int            `json:"totalMatches"`
+	SampleSize   int            `json:"sampleSize"`
+	Seed         int64          `json:"seed"`
+	Sample       []SampledMatch `json:"sample"`
+}
+
+// requestRand returns the random source of a request. Every randomized step of a request
+// draws from a generator seeded with MatchRequest.Seed, so the same request (seed 0 when
+// unset) always gives byte-identical output.
+func requestRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// sampleMatches draws up to n matches across all groups using a seeded RNG,
+// so the same seed over the same results always yields the same sample.
+// The sample keeps the original group/row order to make side-by-side review easier.
+func sampleMatches(groups []MatchGroup, n int, seed int64) MatchSample {
+	total := 0
+	for _, g := range groups {
+		total += len(g.Matches)
+	}
+	if n > total {
+		n = total
+	}
+
+	rng := requestRand(seed)
+	picked := rng.Perm(total)[:n]
+	sort.Ints(picked)
+
+	sample := make([]SampledMatch, 0, n)
+	offset, gi := 0, 0
+	for _, idx := range picked {
+		for idx >= offset+len(groups[gi].Matches) {
+			offset += len(groups[gi].Matches)
+			gi++
+		}
+		g := groups[gi]
+		sample = append(sample, SampledMatch{
+			Header1:     g.Header1,
+			Header2:     g.Header2,
+			MatchResult: g.Matches[idx-offset],
+		})
+	}
+
+	return MatchSample{
+		TotalMatches: total,
+		SampleSize:   len(sample),
+		Seed:         seed,
+		Sample:       sample,
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// sampleGroups returns groups holding n matches in all, numbered by OriginalRow1.
+func sampleGroups(n int) []MatchGroup {
+	groups := []MatchGroup{{Header1: "a", Header2: "a"}, {Header1: "b", Header2: "b"}}
+	for i := 0; i < n; i++ {
+		g := &groups[i%2]
+		g.Matches = append(g.Matches, MatchResult{OriginalRow1: i + 2})
+	}
+	return groups
+}
+
+func TestSampleMatches(t *testing.T) {
+	groups := sampleGroups(50)
+	tests := []struct {
+		name     string
+		n        int
+		seed     int64
+		wantSize int
+	}{
+		{"a sample of n", 10, 42, 10},
+		{"seed 0 is a fixed seed too", 10, 0, 10},
+		{"n beyond the total returns every match", 80, 7, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := sampleMatches(groups, tt.n, tt.seed)
+			again := sampleMatches(groups, tt.n, tt.seed)
+			if !reflect.DeepEqual(first, again) {
+				t.Fatalf("the same seed gave %v, then %v", first.Sample, again.Sample)
+			}
+			if first.SampleSize != tt.wantSize || len(first.Sample) != tt.wantSize || first.TotalMatches != 50 || first.Seed != tt.seed {
+				t.Fatalf("got size %d (%d drawn) of %d, seed %d", first.SampleSize, len(first.Sample), first.TotalMatches, first.Seed)
+			}
+			seen := make(map[int]bool)
+			for _, m := range first.Sample {
+				if seen[m.OriginalRow1] {
+					t.Fatalf("match of row %d drawn twice", m.OriginalRow1)
+				}
+				seen[m.OriginalRow1] = true
+				if want := []string{"a", "b"}[m.OriginalRow1%2]; m.Header1 != want {
+					t.Fatalf("match of row %d tagged with group %q, want %q", m.OriginalRow1, m.Header1, want)
+				}
+			}
+		})
+	}
+
+	if a, b := sampleMatches(groups, 10, 1), sampleMatches(groups, 10, 2); reflect.DeepEqual(a.Sample, b.Sample) {
+		t.Error("seeds 1 and 2 drew the same sample")
+	}
+}
+
+func TestSeededOutputIsReproducible(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := randomWords(rng, 200)
+	putSheets(t, map[string]SheetData{
+		"seed/A": {Headers: []string{"Word"}, Rows: words},
+		"seed/B": {Headers: []string{"Word"}, Rows: words},
+	})
+	match := MatchRequest{Sheet1: "seed/A", Sheet2: "seed/B", SampleSize: 20, Seed: 7}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		req     func(seed int64) interface{}
+	}{
+		{"a sampled match", matchHandler, "/api/match", func(seed int64) interface{} {
+			req := match
+			req.Seed = seed
+			return req
+		}},
+		{"a csv export with its summary", exportHandler, "/api/export", func(seed int64) interface{} {
+			req := match
+			req.Seed = seed
+			return ExportRequest{MatchRequest: req, Format: "csv", Summary: true, GeneratedAt: "2026-01-02T03:04:05Z"}
+		}},
+		{"an xlsx export with its summary", exportHandler, "/api/export", func(seed int64) interface{} {
+			req := match
+			req.Seed = seed
+			return ExportRequest{MatchRequest: req, Summary: true, GeneratedAt: "2026-01-02T03:04:05Z"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := serveJSON(tt.handler, "POST", tt.target, tt.req(7))
+			again := serveJSON(tt.handler, "POST", tt.target, tt.req(7))
+			if first.Code != http.StatusOK || again.Code != http.StatusOK {
+				t.Fatalf("status %d, then %d: %s", first.Code, again.Code, first.Body)
+			}
+			if !bytes.Equal(first.Body.Bytes(), again.Body.Bytes()) {
+				t.Fatal("the same seed gave different output")
+			}
+		})
+	}
+
+	a := serveJSON(matchHandler, "POST", "/api/match", tests[0].req(7))
+	b := serveJSON(matchHandler, "POST", "/api/match", tests[0].req(8))
+	if bytes.Equal(a.Body.Bytes(), b.Body.Bytes()) {
+		t.Error("seeds 7 and 8 drew the same sample")
+	}
+}
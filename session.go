@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Session Workspaces ---
+// ---------------------------------------------------------------------
+
+// Datasets uploaded over HTTP belong to the uploader's session, named by the same
+// sessionHeader that selects a normalization profile. An upload without one starts a new
+// session, whose token comes back in that header and as "session" in the response; later
+// requests send it to reach the session's sheets. Clients keep using "dataset/sheet" keys, so
+// two sessions can load the same dataset names without clobbering each other.
+//
+// Datasets loaded by the background ingesters are shared. Requests without a session see only
+// those, and a session sees them behind its own datasets of the same name.
+
+// sessionScope starts the internal dataset IDs of sessions: "@token/dataset". Dataset names
+// may not start with it, so no client key can name another session's sheets.
+const sessionScope = "@"
+
+// maxSessionLength caps the length of a session token.
+const maxSessionLength = 64
+
+// validSession reports whether a session token is usable as a dataset scope: up to
+// maxSessionLength letters, digits, '.', '_' or '-'.
+func validSession(id string) bool {
+	if id == "" || len(id) > maxSessionLength {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("._-", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestSession returns the request's session, "" when it has none. It writes a 400 and
+// returns false for a malformed token.
+func requestSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := sessionID(r)
+	if id != "" && !validSession(id) {
+		http.Error(w, fmt.Sprintf("Invalid %s header: use up to %d letters, digits, '.', '_' or '-'.", sessionHeader, maxSessionLength), http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+// newSessionToken returns a random, unguessable session token.
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// scopedKey turns a client's dataset name or sheet key into the internal one of the session.
+// A key that already looks scoped yields "", which names nothing.
+func scopedKey(session, key string) string {
+	if strings.HasPrefix(key, sessionScope) {
+		return ""
+	}
+	if session == "" {
+		return key
+	}
+	return sessionScope + session + "/" + key
+}
+
+// unscopedKey is the inverse of scopedKey. Keys of other scopes are returned unchanged.
+func unscopedKey(session, key string) string {
+	if session == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, sessionScope+session+"/")
+}
+
+// unscopedKeys returns a copy of keys as the session's client sees them.
+func unscopedKeys(session string, keys []string) []string {
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = unscopedKey(session, key)
+	}
+	return out
+}
+
+// inScope reports whether an internal key belongs to the session's scope.
+func inScope(session, key string) bool {
+	if session == "" {
+		return !strings.HasPrefix(key, sessionScope)
+	}
+	return strings.HasPrefix(key, sessionScope+session+"/")
+}
+
+// getSessionSheet is fetchSheet for a client's sheet key: the session's own sheet, else the
+// shared one.
+func getSessionSheet(session, key string) (SheetData, bool, error) {
+	data, ok, err := fetchSheet(scopedKey(session, key))
+	if ok || session == "" {
+		return data, ok, err
+	}
+	return fetchSheet(scopedKey("", key))
+}
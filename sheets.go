@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Sheet Listing ---
+// ---------------------------------------------------------------------
+
+// sheetListing describes one stored sheet in the response of GET /api/sheets. A sheet of a
+// lazy upload that has not been read yet is Pending, with no counts or headers, since
+// listing does not parse it.
+type sheetListing struct {
+	Sheet    string            `json:"sheet"`
+	Dataset  string            `json:"dataset"`
+	Rows     int               `json:"rows"`
+	Columns  int               `json:"columns"`
+	Headers  []string          `json:"headers"`
+	Uploaded time.Time         `json:"uploaded"`
+	Filename string            `json:"filename"`
+	Version  int               `json:"version"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Shared   bool              `json:"shared,omitempty"` // loaded by a background ingester rather than this session
+	Pending  bool              `json:"pending,omitempty"`
+}
+
+// sheetsHandler serves GET /api/sheets, listing every sheet the request's session can reach.
+func sheetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	sheets := listSheets(session)
+	log.Printf("INFO: Listing %d sheet(s).", len(sheets))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sheets": sheets})
+}
+
+// listSheets returns the sheets a session can reach: its own, then the shared ones it does
+// not shadow, each group ordered by key.
+func listSheets(session string) []sheetListing {
+	storeMutex.RLock()
+	var own, shared []sheetListing
+	for id, info := range datasets {
+		mine := inScope(session, id)
+		if !mine && !inScope("", id) {
+			continue // another session's
+		}
+		for _, key := range info.Sheets {
+			listing := sheetListing{
+				Sheet:    unscopedKey(session, key),
+				Dataset:  unscopedKey(session, id),
+				Headers:  []string{},
+				Uploaded: info.Uploaded,
+				Filename: info.Meta[key].File,
+				Tags:     info.Meta[key].Tags,
+				Version:  info.Version,
+			}
+			if data, ok := dataStore[key]; ok {
+				listing.Rows, listing.Columns = len(data.Rows), len(data.Headers)
+				if data.Headers != nil {
+					listing.Headers = data.Headers
+				}
+			} else {
+				listing.Pending = pendingSheets[key] != nil
+			}
+			if mine {
+				own = append(own, listing)
+				continue
+			}
+			ownKey := scopedKey(session, key)
+			if _, shadowed := dataStore[ownKey]; shadowed || pendingSheets[ownKey] != nil {
+				continue // getSessionSheet serves the session's own sheet under this key
+			}
+			listing.Shared = true
+			shared = append(shared, listing)
+		}
+	}
+	storeMutex.RUnlock()
+
+	for _, list := range [][]sheetListing{own, shared} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Sheet < list[j].Sheet })
+	}
+	return append(append(make([]sheetListing, 0, len(own)+len(shared)), own...), shared...)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Similarity output formats for MatchResult.Similarity:
+//
+//	"distance"   - raw Levenshtein edit distance between the normalized values (0 = identical)
+//	"percentage" - 0-100, where 100 means identical (default)
+//	"ratio"      - 0-1, where 1 means identical
+const (
+	similarityDistance   = "distance"
+	similarityPercentage = "percentage"
+	similarityRatio      = "ratio"
+)
+
+// validateSimilarityFormat rejects unknown formats; an empty format means percentage.
+func validateSimilarityFormat(format string) error {
+	switch format {
+	case "", similarityDistance, similarityPercentage, similarityRatio:
+		return nil
+	}
+	return fmt.Errorf("unknown similarityFormat '%s' (expected distance, percentage or ratio)", format)
+}
+
+// keySimilarity returns the edit distance between two normalized values and the
+// corresponding 0-1 similarity ratio (1 - distance/longer length).
+func keySimilarity(s1, s2 string) (int, float64) {
+	maxLen := max(len(s1), len(s2))
+	if maxLen == 0 {
+		return 0, 1
+	}
+	dist := levenshteinDistance(s1, s2)
+	return dist, 1 - float64(dist)/float64(maxLen)
+}
+
+// editRatio converts an edit distance between two normalized values into a 0-1 similarity ratio.
+func editRatio(dist int, s1, s2 string) float64 {
+	maxLen := max(len(s1), len(s2))
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(dist)/float64(maxLen)
+}
+
+// formatSimilarity expresses a match score in the requested format.
+func formatSimilarity(format string, dist int, ratio float64) float64 {
+	switch format {
+	case similarityDistance:
+		return float64(dist)
+	case similarityRatio:
+		return math.Round(ratio*10000) / 10000
+	default:
+		return math.Round(ratio*10000) / 100
+	}
+}
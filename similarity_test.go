@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSimilarityFormats(t *testing.T) {
+	sheet1 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Kitten"}}}
+	sheet2 := SheetData{Headers: []string{"Name"}, Rows: [][]string{{"Sitten"}}}
+	tests := []struct {
+		format string
+		want   float64
+	}{
+		{"", 83.33}, // percentage by default
+		{"percentage", 83.33},
+		{"ratio", 0.8333},
+		{"distance", 1},
+	}
+	for _, tt := range tests {
+		t.Run("format "+tt.format, func(t *testing.T) {
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", UseFuzzy: true, FuzzyThreshold: 20, SimilarityFormat: tt.format}
+			groups, _, err := findMatches(context.Background(), req, sheet1, sheet2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(groups) != 1 || len(groups[0].Matches) != 1 {
+				t.Fatalf("got %+v, want one match", groups)
+			}
+			if got := groups[0].Matches[0].Similarity; got != tt.want {
+				t.Fatalf("similarity %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	req := MatchRequest{Sheet1: "A", Sheet2: "B", SimilarityFormat: "score"}
+	if _, _, err := findMatches(context.Background(), req, sheet1, sheet2); err == nil {
+		t.Error("an unknown format was accepted")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Store Snapshots ---
+// ---------------------------------------------------------------------
+
+// GET /api/snapshot downloads every dataset of the request's session, with its sheets and
+// metadata, as one gzipped JSON file; POST /api/snapshot loads such a file back, on this or
+// another server, so a working session can be moved between machines. Only current contents
+// travel: versions stay behind, and lazy sheets are read in full for the download. Keys in
+// the file are the client's, so a snapshot can be loaded into any session.
+
+// snapshotFormat numbers the layout of storeSnapshot.
+const snapshotFormat = 1
+
+// snapshotMaxBytes caps the size of a snapshot loaded by POST /api/snapshot, once
+// decompressed. It is set from a flag in main.
+var snapshotMaxBytes int64 = 1 << 30
+
+// storeSnapshot is the content of a snapshot file.
+type storeSnapshot struct {
+	Format   int                    `json:"format"`
+	Created  time.Time              `json:"created"`
+	Datasets map[string]datasetInfo `json:"datasets"` // by dataset name
+	Sheets   map[string]SheetData   `json:"sheets"`   // by "dataset/sheet" key
+}
+
+// rekeyInfo returns a copy of info with its sheet keys passed through rekey.
+func rekeyInfo(info datasetInfo, rekey func(string) string) datasetInfo {
+	sheets := make([]string, len(info.Sheets))
+	for i, key := range info.Sheets {
+		sheets[i] = rekey(key)
+	}
+	var meta map[string]sheetMeta
+	if info.Meta != nil {
+		meta = make(map[string]sheetMeta, len(info.Meta))
+		for key, m := range info.Meta {
+			meta[rekey(key)] = m
+		}
+	}
+	info.Sheets, info.Meta, info.books, info.Sources = sheets, meta, nil, nil
+	return info
+}
+
+// snapshotHandler serves GET and POST /api/snapshot.
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		exportSnapshot(w, session)
+	case "POST":
+		importSnapshot(w, r, session)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// exportSnapshot writes the session's datasets as a snapshot file.
+func exportSnapshot(w http.ResponseWriter, session string) {
+	storeMutex.RLock()
+	infos := make(map[string]datasetInfo)
+	for id, info := range datasets {
+		if inScope(session, id) {
+			infos[id] = info
+		}
+	}
+	storeMutex.RUnlock()
+
+	snap := storeSnapshot{
+		Format:   snapshotFormat,
+		Created:  time.Now().UTC(),
+		Datasets: make(map[string]datasetInfo, len(infos)),
+		Sheets:   make(map[string]SheetData),
+	}
+	unscope := func(key string) string { return unscopedKey(session, key) }
+	for id, info := range infos {
+		for _, key := range info.Sheets {
+			data, found, err := getSheet(key)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error reading sheet '%s': %v", unscope(key), err), http.StatusInternalServerError)
+				return
+			}
+			if found {
+				snap.Sheets[unscope(key)] = data
+			}
+		}
+		snap.Datasets[unscope(id)] = rekeyInfo(info, unscope)
+	}
+
+	log.Printf("INFO: Exporting snapshot of %d dataset(s) with %d sheet(s).", len(snap.Datasets), len(snap.Sheets))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="edms-snapshot.json.gz"`)
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(snap); err != nil {
+		log.Printf("ERROR: Failed to write snapshot: %v", err)
+		return
+	}
+	gz.Close()
+}
+
+// importSnapshot loads a snapshot file from the request body, gzipped or not, into the
+// session, replacing datasets of the same name. Each replaced dataset keeps its previous
+// contents as a version. A request without a session starts one, as an upload does.
+func importSnapshot(w http.ResponseWriter, r *http.Request, session string) {
+	if session == "" {
+		session = newSessionToken()
+	}
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, snapshotMaxBytes))
+	var src io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid snapshot: %v", err), http.StatusBadRequest)
+			return
+		}
+		src = gz
+	}
+	var snap storeSnapshot
+	if err := json.NewDecoder(io.LimitReader(src, snapshotMaxBytes)).Decode(&snap); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, io.ErrUnexpectedEOF) {
+			http.Error(w, fmt.Sprintf("Snapshot truncated or larger than %d bytes.", snapshotMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Invalid snapshot: %v", err), http.StatusBadRequest)
+		return
+	}
+	if snap.Format != snapshotFormat {
+		http.Error(w, fmt.Sprintf("Unsupported snapshot format %d (expected %d).", snap.Format, snapshotFormat), http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]string, 0, len(snap.Datasets))
+	for id, info := range snap.Datasets {
+		if _, err := datasetID(id, ""); id == "" || strings.TrimSpace(id) != id || err != nil {
+			http.Error(w, fmt.Sprintf("Invalid snapshot: bad dataset name '%s'.", id), http.StatusBadRequest)
+			return
+		}
+		for _, key := range info.Sheets {
+			if _, ok := snap.Sheets[key]; !ok || !strings.HasPrefix(key, sheetKey(id, "")) {
+				http.Error(w, fmt.Sprintf("Invalid snapshot: dataset '%s' lists sheet '%s' it does not contain.", id, key), http.StatusBadRequest)
+				return
+			}
+			if err := checkSheetLimits(strings.TrimPrefix(key, sheetKey(id, "")), snap.Sheets[key]); err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	restored, loaded := make([]string, 0, len(ids)), 0
+	for _, id := range ids {
+		scoped := scopedKey(session, id)
+		info := rekeyInfo(snap.Datasets[id], func(key string) string { return scopedKey(session, key) })
+		names := make([]string, len(info.Sheets))
+		sheets := make(map[string]SheetData, len(info.Sheets))
+		info.Bytes = 0
+		for i, key := range snap.Datasets[id].Sheets {
+			names[i] = strings.TrimPrefix(key, sheetKey(id, ""))
+			sheets[names[i]] = spillSheet(snap.Sheets[key])
+			info.Bytes += sheets[names[i]].bytes()
+		}
+		info.Uploaded, info.RestoredFrom = time.Now(), 0
+		if _, _, err := replaceDataset(scoped, info, names, sheets, nil); err != nil {
+			msg := err.Error()
+			if len(restored) > 0 {
+				msg = fmt.Sprintf("%s (already loaded: %s)", msg, strings.Join(restored, ", "))
+			}
+			http.Error(w, msg, http.StatusInsufficientStorage)
+			return
+		}
+		persistDataset(scoped)
+		restored = append(restored, id)
+		loaded += len(names)
+	}
+
+	log.Printf("INFO: Loaded snapshot of %d dataset(s) taken %s.", len(restored), snap.Created.Format(time.RFC3339))
+	w.Header().Set(sessionHeader, session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"datasets": restored,
+		"sheets":   loaded,
+		"session":  session,
+		"message":  "Snapshot loaded.",
+	})
+}
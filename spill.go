@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"unsafe"
+)
+
+// ---------------------------------------------------------------------
+// --- Disk Spilling ---
+// ---------------------------------------------------------------------
+
+// A million-row sheet holds most of its memory in cell text. With -spill-rows set, the text of
+// every sheet with at least that many rows is written column by column to a file in spillDir
+// and memory-mapped, and the sheet's cells become strings pointing into the mapping, so the
+// operating system pages the text in and out as matching reads it while the rest of the code
+// keeps working on [][]string. Only the row and cell headers stay on the heap. The file is
+// unlinked as soon as it is mapped. The mapping is never released: cell strings outlive their
+// sheet in match indexes, results and map keys, so unmapping could change live strings under
+// them. A spilled sheet's disk space is therefore only freed when the process exits. Spilling
+// needs mmap and is skipped on platforms without it.
+
+// Spill settings, set from flags in main.
+var (
+	spillRows int // 0 keeps every sheet in memory
+	spillDir  = os.TempDir()
+)
+
+// spillSheet returns the sheet with its cell text moved into a mapped file when it is large
+// enough, or the sheet unchanged. A failure to spill is logged and the sheet stays in memory.
+func spillSheet(d SheetData) SheetData {
+	if spillRows <= 0 || len(d.Rows) < spillRows || d.spilled {
+		return d
+	}
+	spilled, err := spillRowsToDisk(d.Rows)
+	if err != nil {
+		log.Printf("WARN: Keeping %d-row sheet in memory; spilling failed: %v", len(d.Rows), err)
+		return d
+	}
+	d.Rows, d.spilled = spilled, true
+	return d
+}
+
+// spillRowsToDisk writes rows column by column to a new file in spillDir and rebuilds them as
+// strings pointing into the file's mapping.
+func spillRowsToDisk(rows [][]string) ([][]string, error) {
+	cols, cells, size := 0, 0, 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+		cells += len(row)
+		for _, cell := range row {
+			size += len(cell)
+		}
+	}
+
+	f, err := os.CreateTemp(spillDir, "edms-spill-*.col")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	defer os.Remove(f.Name()) // the mapping keeps the data until the process exits
+	w := bufio.NewWriterSize(f, 1<<20)
+	for c := 0; c < cols; c++ {
+		for _, row := range rows {
+			if c < len(row) {
+				w.WriteString(row[c])
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	mapped, err := mapSpillFile(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("mapping %s: %v", f.Name(), err)
+	}
+
+	// One backing array holds every cell, row after row, in place of a slice per row.
+	backing := make([]string, cells)
+	starts := make([]int, len(rows))
+	pos := 0
+	for i, row := range rows {
+		starts[i] = pos
+		pos += len(row)
+	}
+	off := 0
+	for c := 0; c < cols; c++ {
+		for i, row := range rows {
+			if c < len(row) && len(row[c]) > 0 {
+				backing[starts[i]+c] = unsafe.String(&mapped[off], len(row[c]))
+				off += len(row[c])
+			}
+		}
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		if row != nil {
+			out[i] = backing[starts[i] : starts[i]+len(row) : starts[i]+len(row)]
+		}
+	}
+	return out, nil
+}
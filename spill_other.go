@@ -0,0 +1,13 @@
+//go:build !(linux || darwin)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mapSpillFile fails where mmap is not available, so sheets stay in memory.
+func mapSpillFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("memory-mapped spilling is not supported on this platform")
+}
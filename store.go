@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ---------------------------------------------------------------------
+// --- Persistent Store ---
+// ---------------------------------------------------------------------
+
+// By default datasets live only in memory. With -store set, every dataset is also written to a
+// sheetStore whenever an upload or deletion changes it, and the store is read back at startup,
+// so uploads survive restarts. dataStore and datasets remain the working set that requests
+// read; a shared store is polled in the background, and only queried while serving for a sheet
+// not held yet (see fetchSheet). Stores can also keep match results; see results.go.
+
+// sheetStore persists datasets: their datasetInfo and parsed sheets, keyed as in dataStore.
+type sheetStore interface {
+	load() (map[string]datasetInfo, map[string]SheetData, error)
+	save(id string, info datasetInfo, sheets map[string]SheetData) error // replaces all the dataset held before
+	remove(id string) error
+	close() error
+}
+
+// store is the configured sheetStore; nil keeps datasets in memory only.
+var store sheetStore
+
+// persistMutex orders writes to store, so a dataset's last change is also the last saved.
+var persistMutex sync.Mutex
+
+// sharedStore is a sheetStore that several instances write to at once. syncStore polls it so
+// each instance picks up the datasets the others save or delete.
+type sharedStore interface {
+	sheetStore
+	stamps() (map[string]int64, error) // Uploaded in Unix nanoseconds of every stored dataset, as saved
+	loadDataset(id string) (datasetInfo, map[string]SheetData, bool, error)
+}
+
+// sharedDatasets is the configured store when it is a sharedStore; nil otherwise.
+var sharedDatasets sharedStore
+
+// storeSyncInterval is how often a sharedStore is polled; set from a flag in main.
+var storeSyncInterval = 10 * time.Second
+
+// storedStamps holds the Uploaded stamp, in Unix nanoseconds, of each dataset as this instance
+// last saved it to or loaded it from the store. It is guarded by persistMutex.
+var storedStamps = make(map[string]int64)
+
+// openStore opens the store a -store value names: bolt:PATH for an embedded bbolt file, or a
+// postgres:// or redis:// URL.
+func openStore(spec string) (sheetStore, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "bolt":
+		if target == "" {
+			return nil, fmt.Errorf("store '%s' needs a file path, e.g. bolt:edms.db", spec)
+		}
+		return openBoltStore(target)
+	case "postgres", "postgresql":
+		return openPGStore(spec)
+	case "redis", "rediss":
+		return openRedisStore(spec)
+	}
+	return nil, fmt.Errorf("unknown store kind '%s' (expected bolt:PATH, postgres://... or redis://...)", kind)
+}
+
+// restoreStore loads every persisted dataset into the in-memory store.
+func restoreStore() error {
+	infos, sheets, err := store.load()
+	if err != nil {
+		return err
+	}
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	for key, data := range sheets {
+		dataStore[key] = spillSheet(data)
+	}
+	for id, info := range infos {
+		storedStamps[id] = info.Uploaded.UnixNano()
+		if info.Uploaded.IsZero() { // saved before uploads were timestamped
+			info.Uploaded = time.Now()
+		}
+		info.Bytes = 0
+		for _, key := range info.Sheets {
+			info.Bytes += dataStore[key].bytes()
+		}
+		reopenLazySourcesLocked(&info)
+		datasets[id] = info
+	}
+	log.Printf("INFO: Restored %d dataset(s) with %d sheet(s) from the store.", len(infos), len(sheets))
+	return nil
+}
+
+// persistDataset writes a dataset's current contents to the store. Lazy sheets not parsed yet
+// are saved as their workbook, and only those of a password-protected one are parsed for it. A
+// failure is logged and leaves the dataset usable in memory.
+func persistDataset(id string) {
+	if store == nil {
+		return
+	}
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+
+	storeMutex.RLock()
+	info, ok := datasets[id]
+	sources, covered := lazySourcesLocked(info)
+	storeMutex.RUnlock()
+	if !ok {
+		return
+	}
+	info.Sources = sources
+	sheets := make(map[string]SheetData, len(info.Sheets))
+	for _, key := range info.Sheets {
+		if covered[key] {
+			continue
+		}
+		data, found, err := getSheet(key)
+		if err != nil || !found {
+			log.Printf("WARN: Not persisting sheet '%s': %v", key, err)
+			continue
+		}
+		sheets[key] = data
+	}
+	if err := store.save(id, info, sheets); err != nil {
+		log.Printf("ERROR: Failed to persist dataset '%s': %v", id, err)
+		return
+	}
+	storedStamps[id] = info.Uploaded.UnixNano()
+}
+
+// unpersistDataset removes a deleted dataset from the store.
+func unpersistDataset(id string) {
+	if store == nil {
+		return
+	}
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	if err := store.remove(id); err != nil {
+		log.Printf("ERROR: Failed to remove dataset '%s' from the store: %v", id, err)
+		return
+	}
+	delete(storedStamps, id)
+}
+
+// runStoreSync polls a shared store until the process exits.
+func runStoreSync(s sharedStore) {
+	for range time.Tick(storeSyncInterval) {
+		syncStore(s)
+	}
+}
+
+// syncStore brings the in-memory store up to date with a shared store: datasets this instance
+// saved or loaded that have since gone from it are removed, and those it holds at another stamp
+// than this instance last saw are loaded, their local contents becoming a version. Datasets
+// not yet saved from here are left alone.
+func syncStore(s sharedStore) {
+	persistMutex.Lock()
+	defer persistMutex.Unlock()
+	remote, err := s.stamps()
+	if err != nil {
+		log.Printf("ERROR: Failed to poll the store: %v", err)
+		return
+	}
+	for id := range storedStamps {
+		if _, ok := remote[id]; !ok {
+			storeMutex.Lock()
+			removeDatasetLocked(id)
+			storeMutex.Unlock()
+			delete(storedStamps, id)
+			log.Printf("INFO: Dataset '%s' was deleted by another instance.", id)
+		}
+	}
+	for id, stamp := range remote {
+		if known, ok := storedStamps[id]; ok && known == stamp {
+			continue
+		}
+		if _, err := loadStoredDataset(s, id); err != nil {
+			log.Printf("ERROR: Failed to load dataset '%s' from the store: %v", id, err)
+		}
+	}
+}
+
+// loadStoredDataset loads a dataset from a shared store unless this instance already holds it
+// at the stamp saved, its local contents becoming a version. found is false if the store does
+// not hold the dataset. Callers must hold persistMutex.
+func loadStoredDataset(s sharedStore, id string) (found bool, err error) {
+	info, sheets, found, err := s.loadDataset(id)
+	if err != nil || !found {
+		return found, err
+	}
+	stamp := info.Uploaded.UnixNano()
+	if known, ok := storedStamps[id]; ok && known == stamp {
+		return true, nil
+	}
+	if err := checkDatasetLimits(sheets); err != nil {
+		storedStamps[id] = stamp // not retried until it is saved again
+		return true, err
+	}
+	storeMutex.Lock()
+	prev := datasets[id]
+	archiveDatasetLocked(id)
+	detachDatasetLocked(id)
+	info.Bytes = 0
+	for key, data := range sheets {
+		data = spillSheet(data)
+		dataStore[key] = data
+		info.Bytes += data.bytes()
+	}
+	reopenLazySourcesLocked(&info)
+	datasets[id] = info
+	closeUnusedBooksLocked(id, prev.books)
+	storeMutex.Unlock()
+	storedStamps[id] = stamp
+	log.Printf("INFO: Loaded dataset '%s' (version %d) saved by another instance.", id, info.Version)
+	return true, nil
+}
+
+// fetchSheet is getSheet that, when the sheet is not held here, first loads its dataset from
+// the shared store in case another instance saved it since the last poll, so a sheet uploaded
+// through one instance can be read through any other at once.
+func fetchSheet(key string) (SheetData, bool, error) {
+	data, ok, err := getSheet(key)
+	if ok || sharedDatasets == nil {
+		return data, ok, err
+	}
+	id := keyDataset(key)
+	if id == "" {
+		return data, ok, err
+	}
+	persistMutex.Lock()
+	found, loadErr := loadStoredDataset(sharedDatasets, id)
+	persistMutex.Unlock()
+	if loadErr != nil {
+		log.Printf("ERROR: Failed to load dataset '%s' from the store: %v", id, loadErr)
+	}
+	if !found {
+		return data, ok, err
+	}
+	return getSheet(key)
+}
+
+// boltStore keeps datasets in a bbolt file: datasetInfo as JSON by dataset ID in one bucket,
+// sheets as JSON by sheet key in another. Match results are kept in a third, each as its
+// expiry in Unix nanoseconds followed by the response body.
+type boltStore struct {
+	db *bolt.DB
+}
+
+var (
+	boltDatasets = []byte("datasets")
+	boltSheets   = []byte("sheets")
+	boltResults  = []byte("results")
+)
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second}) // fail rather than wait on another process's lock
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltDatasets, boltSheets, boltResults} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) load() (map[string]datasetInfo, map[string]SheetData, error) {
+	infos := make(map[string]datasetInfo)
+	sheets := make(map[string]SheetData)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltDatasets).ForEach(func(k, v []byte) error {
+			var info datasetInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return fmt.Errorf("dataset '%s': %v", k, err)
+			}
+			infos[string(k)] = info
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltSheets).ForEach(func(k, v []byte) error {
+			var data SheetData
+			if err := json.Unmarshal(v, &data); err != nil {
+				return fmt.Errorf("sheet '%s': %v", k, err)
+			}
+			sheets[string(k)] = data
+			return nil
+		})
+	})
+	return infos, sheets, err
+}
+
+func (s *boltStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteBoltSheets(tx, id); err != nil {
+			return err
+		}
+		b := tx.Bucket(boltSheets)
+		for key, data := range sheets {
+			v, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), v); err != nil {
+				return err
+			}
+		}
+		v, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltDatasets).Put([]byte(id), v)
+	})
+}
+
+func (s *boltStore) remove(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteBoltSheets(tx, id); err != nil {
+			return err
+		}
+		return tx.Bucket(boltDatasets).Delete([]byte(id))
+	})
+}
+
+// saveResult stores a result and drops those that have expired.
+func (s *boltStore) saveResult(key string, body []byte, expires time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltResults)
+		now := time.Now().UnixNano()
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; {
+			if len(v) < 8 || int64(binary.BigEndian.Uint64(v)) <= now {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				k, v = c.Seek(k)
+				continue
+			}
+			k, v = c.Next()
+		}
+		v := make([]byte, 8, 8+len(body))
+		binary.BigEndian.PutUint64(v, uint64(expires.UnixNano()))
+		return b.Put([]byte(key), append(v, body...))
+	})
+}
+
+func (s *boltStore) loadResult(key string) ([]byte, bool, error) {
+	var body []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltResults).Get([]byte(key))
+		if len(v) >= 8 && int64(binary.BigEndian.Uint64(v)) > time.Now().UnixNano() {
+			body = append([]byte(nil), v[8:]...) // v is only valid during the transaction
+		}
+		return nil
+	})
+	return body, body != nil, err
+}
+
+func (s *boltStore) close() error {
+	return s.db.Close()
+}
+
+// deleteBoltSheets deletes the stored sheets of a dataset.
+func deleteBoltSheets(tx *bolt.Tx, id string) error {
+	prefix := []byte(sheetKey(id, ""))
+	c := tx.Bucket(boltSheets).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
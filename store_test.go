@@ -0,0 +1,263 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+// useBoltStore points store and results at a bbolt file in a temporary directory for the
+// rest of the test.
+func useBoltStore(t *testing.T) *boltStore {
+	t.Helper()
+	s, err := openBoltStore(filepath.Join(t.TempDir(), "edms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevStore, prevResults := store, results
+	store, results = s, s
+	t.Cleanup(func() {
+		store, results = prevStore, prevResults
+		s.close()
+	})
+	return s
+}
+
+func TestPersistLazySheetsAsWorkbook(t *testing.T) {
+	useBoltStore(t)
+
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"id", "name"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{1, "Ann"})
+	f.NewSheet("Other")
+	f.SetSheetRow("Other", "A1", &[]interface{}{"code"})
+	f.SetSheetRow("Other", "A2", &[]interface{}{"x"})
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const dataset = "lazy-store-test"
+	defer func() {
+		storeMutex.Lock()
+		removeDatasetLocked(dataset)
+		storeMutex.Unlock()
+	}()
+	opts := uploadOptions{Dataset: dataset, Filename: "book.xlsx", Lazy: true}
+	if _, status, err := ingestUpload(buf.Bytes(), opts, parseWorkbook, http.StatusBadRequest); err != nil {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+	key1, key2 := sheetKey(dataset, "Sheet1"), sheetKey(dataset, "Other")
+
+	tests := []struct {
+		name    string
+		prepare func()
+	}{
+		{"saving leaves the sheets unparsed", func() {}},
+		{"sheets restored from the store are pending again", func() {
+			storeMutex.Lock()
+			removeDatasetLocked(dataset)
+			storeMutex.Unlock()
+			if err := restoreStore(); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+			storeMutex.RLock()
+			_, parsed := dataStore[key1]
+			pending := pendingSheets[key1] != nil && pendingSheets[key2] != nil
+			storeMutex.RUnlock()
+			if parsed || !pending {
+				t.Fatalf("parsed %v, pending %v; want both sheets pending", parsed, pending)
+			}
+			data, found, err := getSheet(key1)
+			if err != nil || !found {
+				t.Fatalf("getSheet: %v %v", found, err)
+			}
+			if len(data.Rows) != 1 || cellValue(data.Rows[0], 1) != "Ann" {
+				t.Fatalf("rows %v, want [[1 Ann]]", data.Rows)
+			}
+		})
+	}
+}
+
+func TestStoredResults(t *testing.T) {
+	s := useBoltStore(t)
+	prevTTL := resultTTL
+	defer func() { resultTTL = prevTTL }()
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		session  string // of the request that ran the job
+		fetchAs  string // session fetching the result
+		job      string
+		wantCode int
+	}{
+		{"a result is served again", time.Hour, "", "", "job-a", http.StatusOK},
+		{"a result is served within its session", time.Hour, "s1", "s1", "job-b", http.StatusOK},
+		{"another session cannot read it", time.Hour, "s1", "s2", "job-c", http.StatusNotFound},
+		{"an expired result is gone", time.Nanosecond, "", "", "job-d", http.StatusNotFound},
+		{"a zero TTL keeps nothing", 0, "", "", "job-e", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultTTL = tt.ttl
+			run := httptest.NewRequest("POST", "/api/match", nil)
+			run.Header.Set(sessionHeader, tt.session)
+			w := httptest.NewRecorder()
+			w.Header().Set(jobHeader, tt.job)
+			keepResult(w, run, []byte("[]\n"))
+			time.Sleep(time.Millisecond)
+
+			fetch := httptest.NewRequest("GET", "/api/results/"+tt.job, nil)
+			fetch.Header.Set(sessionHeader, tt.fetchAs)
+			got := httptest.NewRecorder()
+			resultsHandler(got, fetch)
+			if got.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", got.Code, tt.wantCode, got.Body)
+			}
+			if tt.wantCode == http.StatusOK && got.Body.String() != "[]\n" {
+				t.Fatalf("body %q, want the stored one", got.Body)
+			}
+		})
+	}
+
+	// Saving prunes the expired results.
+	resultTTL = time.Hour
+	w := httptest.NewRecorder()
+	w.Header().Set(jobHeader, "job-f")
+	keepResult(w, httptest.NewRequest("POST", "/api/match", nil), []byte("[]\n"))
+	count := 0
+	s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(boltResults).Stats().KeyN
+		return nil
+	})
+	if count != 4 {
+		t.Fatalf("%d results kept, want the 4 unexpired", count)
+	}
+}
+
+// memSharedStore is a sharedStore held in memory, standing in for a database other instances
+// write to.
+type memSharedStore struct {
+	infos  map[string]datasetInfo
+	sheets map[string]map[string]SheetData
+	loads  int
+}
+
+func newMemSharedStore() *memSharedStore {
+	return &memSharedStore{infos: make(map[string]datasetInfo), sheets: make(map[string]map[string]SheetData)}
+}
+
+func (s *memSharedStore) load() (map[string]datasetInfo, map[string]SheetData, error) {
+	return nil, nil, nil
+}
+
+func (s *memSharedStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	s.infos[id], s.sheets[id] = info, sheets
+	return nil
+}
+
+func (s *memSharedStore) remove(id string) error {
+	delete(s.infos, id)
+	delete(s.sheets, id)
+	return nil
+}
+
+func (s *memSharedStore) close() error { return nil }
+
+func (s *memSharedStore) stamps() (map[string]int64, error) {
+	stamps := make(map[string]int64)
+	for id, info := range s.infos {
+		stamps[id] = info.Uploaded.UnixNano()
+	}
+	return stamps, nil
+}
+
+func (s *memSharedStore) loadDataset(id string) (datasetInfo, map[string]SheetData, bool, error) {
+	s.loads++
+	info, ok := s.infos[id]
+	return info, s.sheets[id], ok, nil
+}
+
+func TestKeyDataset(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"sales/Sheet1", "sales"},
+		{"sales/a/b", "sales"},
+		{"@token/sales/Sheet1", "@token/sales"},
+		{"@token/sales", ""},
+		{"sales", ""},
+		{"/Sheet1", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := keyDataset(tt.key); got != tt.want {
+			t.Errorf("keyDataset(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSheetsSavedByAnotherInstance(t *testing.T) {
+	remote := newMemSharedStore()
+	prev := sharedDatasets
+	sharedDatasets = remote
+	defer func() { sharedDatasets = prev }()
+
+	// Another instance saved these since the last poll.
+	sheet := SheetData{Headers: []string{"id"}, Rows: [][]string{{"1"}}}
+	for _, id := range []string{"remote-a", scopedKey("s1", "remote-b")} {
+		key := sheetKey(id, "Sheet1")
+		remote.save(id, datasetInfo{Sheets: []string{key}, Version: 1, Uploaded: time.Now()}, map[string]SheetData{key: sheet})
+		defer func(id string) {
+			storeMutex.Lock()
+			removeDatasetLocked(id)
+			storeMutex.Unlock()
+			delete(storedStamps, id)
+		}(id)
+	}
+
+	tests := []struct {
+		name      string
+		session   string
+		key       string
+		wantFound bool
+		wantLoads int // of the store, for this read
+	}{
+		{"a shared sheet is loaded on first use", "", "remote-a/Sheet1", true, 1},
+		{"it is then read locally", "", "remote-a/Sheet1", true, 0},
+		{"a session's sheet is loaded within its scope", "s1", "remote-b/Sheet1", true, 1},
+		{"another session does not see it", "s2", "remote-b/Sheet1", false, 2},
+		{"a session falls back to the shared sheet", "s2", "remote-a/Sheet1", true, 1},
+		{"a dataset the store lacks is not found", "", "missing/Sheet1", false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := remote.loads
+			data, found, err := getSessionSheet(tt.session, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound {
+				t.Fatalf("found %v, want %v", found, tt.wantFound)
+			}
+			if found && !reflect.DeepEqual(data.Rows, sheet.Rows) {
+				t.Fatalf("rows %v, want %v", data.Rows, sheet.Rows)
+			}
+			if loads := remote.loads - before; loads != tt.wantLoads {
+				t.Fatalf("%d store loads, want %d", loads, tt.wantLoads)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ---------------------------------------------------------------------
+// --- Cell Styles ---
+// ---------------------------------------------------------------------
+
+// Color modes for MatchRequest.ColorMode. They need sheets uploaded with captureStyles.
+const (
+	colorModeSame    = "same"    // a pair only matches when both cells have the same fill color
+	colorModeColored = "colored" // only cells with a fill color take part, on both sides
+)
+
+// readFills returns the fill color of every cell in rows as uppercase RGB hex ("" when unfilled),
+// parallel to rows, which start on the sheet's 1-based row firstRow. Style lookups are cached per style ID since most cells share a few styles.
+func readFills(f *excelize.File, sheet string, rows [][]string, firstRow int) ([][]string, error) {
+	byStyle := make(map[int]string)
+	fills := make([][]string, len(rows))
+	for i, row := range rows {
+		fills[i] = make([]string, len(row))
+		for j := range row {
+			cell, err := excelize.CoordinatesToCellName(j+1, firstRow+i)
+			if err != nil {
+				return nil, err
+			}
+			styleID, err := f.GetCellStyle(sheet, cell)
+			if err != nil {
+				return nil, err
+			}
+			color, ok := byStyle[styleID]
+			if !ok {
+				style, err := f.GetStyle(styleID)
+				if err != nil {
+					return nil, err
+				}
+				color = fillColor(style)
+				byStyle[styleID] = color
+			}
+			fills[i][j] = color
+		}
+	}
+	return fills, nil
+}
+
+// fillColor extracts the solid fill color of a style, dropping any "#" or alpha prefix.
+func fillColor(style *excelize.Style) string {
+	if style == nil || len(style.Fill.Color) == 0 || (style.Fill.Type == "pattern" && style.Fill.Pattern == 0) {
+		return ""
+	}
+	color := strings.ToUpper(strings.TrimPrefix(style.Fill.Color[0], "#"))
+	if len(color) == 8 {
+		color = color[2:]
+	}
+	return color
+}
+
+// validateColorMode checks the request's color mode against what the sheets captured.
+func validateColorMode(mode string, sheets map[string]SheetData) error {
+	switch mode {
+	case "":
+		return nil
+	case colorModeSame, colorModeColored:
+	default:
+		return fmt.Errorf("unknown colorMode '%s' (expected %s or %s)", mode, colorModeSame, colorModeColored)
+	}
+	for name, data := range sheets {
+		if data.Fills == nil {
+			return fmt.Errorf("colorMode needs cell colors, but sheet '%s' was uploaded without captureStyles", name)
+		}
+	}
+	return nil
+}
+
+// colorFilter returns the cell pair check for a color mode, or nil when colors are ignored.
+// Rows are 0-based data row positions.
+func colorFilter(mode string, fills1, fills2 [][]string) func(r1, c1, r2, c2 int) bool {
+	switch mode {
+	case colorModeSame:
+		return func(r1, c1, r2, c2 int) bool { return fillAt(fills1, r1, c1) == fillAt(fills2, r2, c2) }
+	case colorModeColored:
+		return func(r1, c1, r2, c2 int) bool { return fillAt(fills1, r1, c1) != "" && fillAt(fills2, r2, c2) != "" }
+	}
+	return nil
+}
+
+func fillAt(fills [][]string, r, c int) string {
+	if r < len(fills) && c < len(fills[r]) {
+		return fills[r][c]
+	}
+	return ""
+}
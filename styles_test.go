@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// coloredWorkbook returns a workbook of one Name column whose cells are filled with the given
+// colors, "" leaving a cell unfilled.
+func coloredWorkbook(t *testing.T, names, colors []string) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	f.SetCellValue("Sheet1", "A1", "Name")
+	for i, name := range names {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		f.SetCellValue("Sheet1", cell, name)
+		if colors[i] == "" {
+			continue
+		}
+		style, err := f.NewStyle(&excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{colors[i]}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.SetCellStyle("Sheet1", cell, cell, style)
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestColorModes(t *testing.T) {
+	names := []string{"Ann", "Bob", "Cy"}
+	book1 := coloredWorkbook(t, names, []string{"#FFFF00", "", "#00FF00"})
+	book2 := coloredWorkbook(t, names, []string{"#ffff00", "#FFFF00", "#FFFF00"})
+	tests := []struct {
+		name          string
+		mode          string
+		captureStyles bool
+		want          []string // matched values
+		wantErr       bool
+	}{
+		{"colors are ignored by default", "", true, []string{"Ann", "Bob", "Cy"}, false},
+		{"same needs equal fill colors", colorModeSame, true, []string{"Ann"}, false},
+		{"colored needs a fill on both sides", colorModeColored, true, []string{"Ann", "Cy"}, false},
+		{"a color mode needs captured styles", colorModeSame, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := uploadOptions{CaptureStyles: tt.captureStyles}
+			up1, err := parseWorkbook(book1, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			up2, err := parseWorkbook(book2, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := MatchRequest{Sheet1: "A", Sheet2: "B", ColorMode: tt.mode}
+			groups, _, err := findMatches(context.Background(), req, up1.sheets["Sheet1"], up2.sheets["Sheet1"])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want one: %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, g := range groups {
+				for _, m := range g.Matches {
+					got = append(got, m.Val1)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// runSummary describes a match run for the header block of an export.
+type runSummary struct {
+	Sheet1, Sheet2         string
+	Algorithm              string
+	Threshold              int // only meaningful for fuzzy algorithms
+	Comparisons            int
+	Groups, Matches, Fuzzy int
+	Rows1, Rows2           int // non-blank data rows
+	Matched1, Matched2     int // non-blank data rows appearing in at least one match
+	Generated              time.Time
+}
+
+// summarizeRun computes the summary of a finished match run.
+func summarizeRun(req MatchRequest, groups []MatchGroup, comparisons int, sheet1Data, sheet2Data SheetData) runSummary {
+	alg, _ := resolveAlgorithm(req)
+	s := runSummary{
+		Sheet1: req.Sheet1, Sheet2: req.Sheet2,
+		Algorithm: alg, Threshold: req.FuzzyThreshold,
+		Comparisons: comparisons, Groups: len(groups),
+		Generated: time.Now().UTC(),
+	}
+	for _, g := range groups {
+		s.Matches += len(g.Matches)
+		for _, m := range g.Matches {
+			if m.IsFuzzy {
+				s.Fuzzy++
+			}
+		}
+	}
+	matched1, matched2 := matchedRows(groups)
+	s.Rows1, s.Matched1 = countCoverage(sheet1Data, matched1)
+	s.Rows2, s.Matched2 = countCoverage(sheet2Data, matched2)
+	return s
+}
+
+// countCoverage counts the non-blank data rows and how many of them are matched.
+func countCoverage(data SheetData, matched map[int]bool) (rows, covered int) {
+	for i, row := range data.Rows {
+		if isBlankRow(row) {
+			continue
+		}
+		rows++
+		if matched[data.rowNumber(i)] {
+			covered++
+		}
+	}
+	return rows, covered
+}
+
+// coveragePercent formats covered/rows as a percentage with one decimal.
+func coveragePercent(covered, rows int) string {
+	if rows == 0 {
+		return "0%"
+	}
+	return strconv.FormatFloat(float64(covered)*100/float64(rows), 'f', 1, 64) + "%"
+}
+
+// lines returns the summary as label/value pairs, in display order.
+func (s runSummary) lines() [][2]string {
+	threshold := "n/a"
+	if s.Algorithm != algorithmExact {
+		threshold = strconv.Itoa(s.Threshold)
+	}
+	return [][2]string{
+		{"Sheet 1", s.Sheet1},
+		{"Sheet 2", s.Sheet2},
+		{"Algorithm", s.Algorithm},
+		{"Threshold", threshold},
+		{"Comparisons", strconv.Itoa(s.Comparisons)},
+		{"Match groups", strconv.Itoa(s.Groups)},
+		{"Matches", strconv.Itoa(s.Matches)},
+		{"Exact matches", strconv.Itoa(s.Matches - s.Fuzzy)},
+		{"Fuzzy matches", strconv.Itoa(s.Fuzzy)},
+		{"Coverage " + s.Sheet1, fmt.Sprintf("%s (%d of %d rows)", coveragePercent(s.Matched1, s.Rows1), s.Matched1, s.Rows1)},
+		{"Coverage " + s.Sheet2, fmt.Sprintf("%s (%d of %d rows)", coveragePercent(s.Matched2, s.Rows2), s.Matched2, s.Rows2)},
+		{"Generated", s.Generated.Format(time.RFC3339)},
+	}
+}
+
+// writeCSVComments writes the summary as "# Label: value" lines ahead of the CSV header.
+func (s runSummary) writeCSVComments(cw *csv.Writer) error {
+	for _, l := range s.lines() {
+		if err := cw.Write([]string{"# " + l[0] + ": " + l[1]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSheet fills a two-column Label/Value sheet with the summary.
+func (s runSummary) writeSheet(f *excelize.File, sheet string) error {
+	if err := f.SetSheetRow(sheet, "A1", &[]interface{}{"Run summary"}); err != nil {
+		return err
+	}
+	for i, l := range s.lines() {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(sheet, cell, &[]interface{}{l[0], l[1]}); err != nil {
+			return err
+		}
+	}
+	return f.SetColWidth(sheet, "A", "B", 30)
+}
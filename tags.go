@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Sheet Tags ---
+// ---------------------------------------------------------------------
+
+// An upload can tag its sheets with uploadOptions.Tags, as "key=value" or a bare "key", such
+// as "vendor=acme" or "month=Jan". The tags are kept with each sheet, listed by /api/sheets,
+// and searched by GET /api/sheets/search, which keeps a long-running server with dozens of
+// datasets navigable. Keys and values are compared without regard to case.
+
+// maxTags and maxTagLength bound the tags of an upload.
+const (
+	maxTags      = 32
+	maxTagLength = 128
+)
+
+// parseTags turns an upload's tags into a map from key to value, "" for a bare key. A later
+// tag with the same key wins. It returns nil for no tags.
+func parseTags(tags []string) (map[string]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("too many tags (%d, at most %d)", len(tags), maxTags)
+	}
+	var parsed map[string]string
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("invalid tag '%s': use key=value or key, up to %d characters", tag, maxTagLength)
+		}
+		if parsed == nil {
+			parsed = make(map[string]string)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// hasTag reports whether tags hold a key, and the value too unless want has none.
+func hasTag(tags map[string]string, want string) bool {
+	key, value, withValue := strings.Cut(want, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	for k, v := range tags {
+		if strings.EqualFold(k, key) && (!withValue || strings.EqualFold(v, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchSheetsHandler serves GET /api/sheets/search?tag=vendor=acme&tag=month&q=text, listing
+// like /api/sheets the sheets carrying every given tag (a bare key matches any value) whose key
+// contains q. Each tag parameter may also hold several tags separated by commas.
+func searchSheetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := requestSession(w, r)
+	if !ok {
+		return
+	}
+	q := strings.ToLower(strings.TrimSpace(r.FormValue("q"))) // parses the query for formList
+	tags := formList(r, "tag")
+
+	sheets := make([]sheetListing, 0)
+	for _, sheet := range listSheets(session) {
+		if !strings.Contains(strings.ToLower(sheet.Sheet), q) {
+			continue
+		}
+		matched := true
+		for _, tag := range tags {
+			matched = matched && hasTag(sheet.Tags, tag)
+		}
+		if matched {
+			sheets = append(sheets, sheet)
+		}
+	}
+	log.Printf("INFO: Sheet search for tags %v and '%s' found %d sheet(s).", tags, q, len(sheets))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sheets": sheets})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------------------------------------------------------------------
+// --- TF-IDF Matching ---
+// ---------------------------------------------------------------------
+
+// The "tfidf" algorithm is meant for columns of descriptions rather than short keys. Each
+// value becomes a vector of its words, weighted by how often the word occurs in the value
+// times how rare it is in the sheet2 column (its inverse document frequency), and a pair is
+// scored by the cosine of the angle between its vectors. Words every description shares, like
+// "the" or "steel", therefore count for little, and a pair sharing its rare words scores high
+// whatever else the descriptions say, where an edit distance over 200 characters would be
+// both slow and dominated by noise. The ratio is the cosine, under the usual threshold rule,
+// and the distance reported is the number of distinct words only one of the values contains.
+// Words shorter than MinTokenLen are ignored.
+
+// tfidfVector is a value's word weights with their Euclidean norm.
+type tfidfVector struct {
+	weights map[string]float64
+	norm    float64
+}
+
+// tfidfColumn returns the score function for sheet2 column c, weighting words by their
+// document frequency in it. Sheet2 vectors are computed up front; the sheet1 key is scored
+// against every candidate in turn, so its vector is kept until the key changes.
+func tfidfColumn(ix *matchIndex, c int, p scoreParams) scoreFunc {
+	df := make(map[string]int)
+	docs := 0
+	for _, keys := range ix.keys {
+		if c >= len(keys) || keys[c] == "" {
+			continue
+		}
+		docs++
+		for t := range tfidfTerms(keys[c], p.minTokenLen) {
+			df[t]++
+		}
+	}
+	// Smoothed IDF, so a word in every row still weighs something and an unseen one the most.
+	idf := func(t string) float64 {
+		return math.Log(float64(1+docs)/float64(1+df[t])) + 1
+	}
+
+	vectors := make(map[string]tfidfVector)
+	for _, keys := range ix.keys {
+		if c < len(keys) && keys[c] != "" {
+			if _, ok := vectors[keys[c]]; !ok {
+				vectors[keys[c]] = newTFIDFVector(keys[c], p.minTokenLen, idf)
+			}
+		}
+	}
+
+	var last1 string
+	var vec1 tfidfVector
+	return func(key1, key2 string, p scoreParams) (int, float64, bool) {
+		if key1 != last1 || vec1.weights == nil {
+			last1, vec1 = key1, newTFIDFVector(key1, p.minTokenLen, idf)
+		}
+		vec2, ok := vectors[key2]
+		if !ok || vec1.norm == 0 || vec2.norm == 0 {
+			return 0, 0, false
+		}
+		small, large := vec1.weights, vec2.weights
+		if len(small) > len(large) {
+			small, large = large, small
+		}
+		dot, shared := 0.0, 0
+		for t, w := range small {
+			if w2, ok := large[t]; ok {
+				dot += w * w2
+				shared++
+			}
+		}
+		if shared == 0 {
+			return 0, 0, false
+		}
+		ratio := math.Min(dot/(vec1.norm*vec2.norm), 1)
+		return thresholdRatio(len(small)+len(large)-2*shared, ratio, p)
+	}
+}
+
+// newTFIDFVector weighs the words of a key by their count times idf.
+func newTFIDFVector(key string, minLen int, idf func(string) float64) tfidfVector {
+	terms := tfidfTerms(key, minLen)
+	vec := tfidfVector{weights: make(map[string]float64, len(terms))}
+	for t, n := range terms {
+		w := float64(n) * idf(t)
+		vec.weights[t] = w
+		vec.norm += w * w
+	}
+	vec.norm = math.Sqrt(vec.norm)
+	return vec
+}
+
+// tfidfTerms counts the words of a key, dropping those shorter than minLen runes.
+func tfidfTerms(key string, minLen int) map[string]int {
+	terms := make(map[string]int)
+	for _, f := range strings.FieldsFunc(key, notAlphanumeric) {
+		if utf8.RuneCountInString(f) >= minLen {
+			terms[f]++
+		}
+	}
+	return terms
+}
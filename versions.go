@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ---------------------------------------------------------------------
+// --- Dataset Versions ---
+// ---------------------------------------------------------------------
+
+// Uploading into a dataset that already exists, in either mode, keeps what it held before as
+// a numbered version, up to maxVersions of them, so a bad re-upload can be undone:
+//
+//	GET  /api/dataset/{id}/versions                  lists the versions with their row counts
+//	GET  /api/dataset/{id}/versions/diff?from=&to=   compares two versions' row counts by sheet
+//	POST /api/dataset/{id}/rollback {"version": n}   makes version n current again
+//
+// A rollback is itself a new version, so it can be rolled back in turn. Versions are kept in
+// memory only; a persistent store holds just the current contents.
+
+// maxVersions caps the previous versions kept per dataset; 0 keeps none.
+var maxVersions = 5
+
+// versions holds each dataset's previous versions, oldest first. It is guarded by storeMutex.
+var versions = make(map[string][]datasetVersion)
+
+// datasetVersion is the contents of a dataset at one version, sheets keyed as in dataStore.
+type datasetVersion struct {
+	info    datasetInfo
+	sheets  map[string]SheetData
+	pending map[string]*lazySheet
+}
+
+// captureDatasetLocked returns the current contents of a dataset. Callers must hold storeMutex.
+func captureDatasetLocked(id string) (datasetVersion, bool) {
+	info, ok := datasets[id]
+	if !ok {
+		return datasetVersion{}, false
+	}
+	info.Version = max(info.Version, 1) // datasets restored from before versions existed
+	v := datasetVersion{info: info, sheets: make(map[string]SheetData), pending: make(map[string]*lazySheet)}
+	for _, key := range info.Sheets {
+		if data, ok := dataStore[key]; ok {
+			v.sheets[key] = data
+		} else if sheet := pendingSheets[key]; sheet != nil {
+			v.pending[key] = sheet
+		}
+	}
+	return v, true
+}
+
+// archiveDatasetLocked adds a dataset's current contents to its versions, dropping the oldest
+// beyond maxVersions, and returns the number of the version about to replace them. The books
+// of dropped versions are closed unless listed in keep. Callers must hold storeMutex.
+func archiveDatasetLocked(id string, keep ...*lazyWorkbook) int {
+	current, ok := captureDatasetLocked(id)
+	if !ok {
+		return 1
+	}
+	if maxVersions > 0 {
+		history := append(versions[id], current)
+		var evicted []*lazyWorkbook
+		if n := len(history) - maxVersions; n > 0 {
+			for _, v := range history[:n] {
+				evicted = append(evicted, v.info.books...)
+			}
+			history = append([]datasetVersion(nil), history[n:]...)
+		}
+		versions[id] = history
+		closeUnusedBooksLocked(id, evicted, keep...)
+	}
+	return current.info.Version + 1
+}
+
+// closeUnusedBooksLocked closes those of books that neither the dataset nor any of its versions
+// still reads, nor are listed in keep. Callers must hold storeMutex.
+func closeUnusedBooksLocked(id string, books []*lazyWorkbook, keep ...*lazyWorkbook) {
+	if len(books) == 0 {
+		return
+	}
+	inUse := make(map[*lazyWorkbook]bool)
+	for _, book := range keep {
+		inUse[book] = true
+	}
+	for _, book := range datasets[id].books {
+		inUse[book] = true
+	}
+	for _, v := range versions[id] {
+		for _, book := range v.info.books {
+			inUse[book] = true
+		}
+	}
+	for _, book := range books {
+		if !inUse[book] {
+			inUse[book] = true // a book may be listed twice
+			book.close()
+		}
+	}
+}
+
+// findVersionLocked returns version n of a dataset, current or previous. Callers must hold
+// storeMutex.
+func findVersionLocked(id string, n int) (datasetVersion, bool) {
+	if current, ok := captureDatasetLocked(id); ok && current.info.Version == n {
+		return current, true
+	}
+	for _, v := range versions[id] {
+		if v.info.Version == n {
+			return v, true
+		}
+	}
+	return datasetVersion{}, false
+}
+
+// rowCounts returns the rows of each sheet of the version, parsing lazy sheets if need be.
+// A sheet that cannot be read counts -1.
+func (v datasetVersion) rowCounts() map[string]int {
+	counts := make(map[string]int, len(v.info.Sheets))
+	for _, key := range v.info.Sheets {
+		if data, ok := v.sheets[key]; ok {
+			counts[key] = len(data.Rows)
+		} else if sheet := v.pending[key]; sheet != nil {
+			data, err := sheet.load()
+			counts[key] = len(data.Rows)
+			if err != nil {
+				counts[key] = -1
+			}
+		}
+	}
+	return counts
+}
+
+// versionSummary describes a version in the version list.
+type versionSummary struct {
+	Version      int            `json:"version"`
+	Current      bool           `json:"current"`
+	Uploaded     string         `json:"uploaded,omitempty"` // RFC 3339
+	RestoredFrom int            `json:"restoredFrom,omitempty"`
+	ContentHash  string         `json:"contentHash"`
+	Sheets       map[string]int `json:"sheets"` // rows by sheet key
+	Rows         int            `json:"rows"`
+}
+
+// versionDiff compares one sheet across two versions; a sheet missing from a version has no
+// rows there.
+type versionDiff struct {
+	Sheet    string `json:"sheet"`
+	Status   string `json:"status"` // "added", "removed", "changed" or "unchanged" (row count only)
+	RowsFrom int    `json:"rowsFrom"`
+	RowsTo   int    `json:"rowsTo"`
+	Delta    int    `json:"delta"`
+}
+
+// versionsHandler serves the version endpoints below /api/dataset/{id}/. id is the dataset as
+// the client names it and scoped its internal ID.
+func versionsHandler(w http.ResponseWriter, r *http.Request, session, id, scoped, sub string) {
+	switch sub {
+	case "versions":
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		listVersions(w, session, id, scoped)
+	case "versions/diff":
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		diffVersions(w, r, session, id, scoped)
+	case "rollback":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rollbackDataset(w, r, session, id, scoped)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// listVersions writes the dataset's versions, newest first.
+func listVersions(w http.ResponseWriter, session, id, scoped string) {
+	storeMutex.RLock()
+	current, ok := captureDatasetLocked(scoped)
+	all := append([]datasetVersion{current}, versions[scoped]...)
+	storeMutex.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("Dataset '%s' not found.", id), http.StatusNotFound)
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].info.Version > all[j].info.Version })
+
+	list := make([]versionSummary, len(all))
+	for i, v := range all {
+		s := versionSummary{
+			Version:      v.info.Version,
+			Current:      v.info.Version == current.info.Version,
+			RestoredFrom: v.info.RestoredFrom,
+			ContentHash:  v.info.Hash,
+			Sheets:       make(map[string]int),
+		}
+		if !v.info.Uploaded.IsZero() {
+			s.Uploaded = v.info.Uploaded.Format(time.RFC3339)
+		}
+		for key, rows := range v.rowCounts() {
+			s.Sheets[unscopedKey(session, key)] = rows
+			s.Rows += max(rows, 0)
+		}
+		list[i] = s
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dataset":  id,
+		"versions": list,
+	})
+}
+
+// diffVersions writes the per-sheet row count changes from one version to another. to
+// defaults to the current version and from to the one before it.
+func diffVersions(w http.ResponseWriter, r *http.Request, session, id, scoped string) {
+	storeMutex.RLock()
+	current, ok := captureDatasetLocked(scoped)
+	storeMutex.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("Dataset '%s' not found.", id), http.StatusNotFound)
+		return
+	}
+	to, err := queryInt(r, "to", current.info.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := queryInt(r, "from", to-1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	storeMutex.RLock()
+	vFrom, okFrom := findVersionLocked(scoped, from)
+	vTo, okTo := findVersionLocked(scoped, to)
+	storeMutex.RUnlock()
+	for _, missing := range []struct {
+		n  int
+		ok bool
+	}{{from, okFrom}, {to, okTo}} {
+		if !missing.ok {
+			http.Error(w, fmt.Sprintf("Dataset '%s' has no version %d.", id, missing.n), http.StatusNotFound)
+			return
+		}
+	}
+
+	rowsFrom, rowsTo := vFrom.rowCounts(), vTo.rowCounts()
+	keys := make(map[string]bool)
+	for key := range rowsFrom {
+		keys[key] = true
+	}
+	for key := range rowsTo {
+		keys[key] = true
+	}
+	diffs := make([]versionDiff, 0, len(keys))
+	for key := range keys {
+		a, inFrom := rowsFrom[key]
+		b, inTo := rowsTo[key]
+		d := versionDiff{Sheet: unscopedKey(session, key), RowsFrom: a, RowsTo: b, Delta: b - a}
+		switch {
+		case !inFrom:
+			d.Status = "added"
+		case !inTo:
+			d.Status = "removed"
+		case a != b:
+			d.Status = "changed"
+		default:
+			d.Status = "unchanged"
+		}
+		diffs = append(diffs, d)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Sheet < diffs[j].Sheet })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dataset": id,
+		"from":    from,
+		"to":      to,
+		"sheets":  diffs,
+	})
+}
+
+// rollbackDataset makes a previous version current again, as a new version.
+func rollbackDataset(w http.ResponseWriter, r *http.Request, session, id, scoped string) {
+	var req struct {
+		Version int `json:"version"`
+	}
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	storeMutex.Lock()
+	current, exists := captureDatasetLocked(scoped)
+	var target datasetVersion
+	found := false
+	for _, v := range versions[scoped] {
+		if v.info.Version == req.Version {
+			target, found = v, true
+		}
+	}
+	if !exists || !found {
+		storeMutex.Unlock()
+		msg := fmt.Sprintf("Dataset '%s' has no previous version %d.", id, req.Version)
+		if !exists {
+			msg = fmt.Sprintf("Dataset '%s' not found.", id)
+		} else if req.Version == current.info.Version {
+			msg = fmt.Sprintf("Version %d is already current.", req.Version)
+		}
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+
+	// The target's workbooks must stay open even if making room or archiving the current
+	// contents drops the target from the versions.
+	if err := reserveLocked(target.info.Bytes, target.info.books...); err != nil {
+		storeMutex.Unlock()
+		log.Printf("ERROR: Rollback of dataset '%s' rejected: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	info := target.info
+	info.Version = archiveDatasetLocked(scoped, target.info.books...)
+	info.Uploaded = time.Now()
+	info.RestoredFrom = req.Version
+	detachDatasetLocked(scoped)
+	for key, data := range target.sheets {
+		dataStore[key] = data
+	}
+	for key, sheet := range target.pending {
+		pendingSheets[key] = sheet
+	}
+	datasets[scoped] = info
+	closeUnusedBooksLocked(scoped, current.info.books)
+	storeMutex.Unlock()
+	persistDataset(scoped)
+	log.Printf("INFO: Rolled dataset '%s' back to version %d as version %d.", id, req.Version, info.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dataset":      id,
+		"version":      info.Version,
+		"restoredFrom": req.Version,
+		"sheetNames":   unscopedKeys(session, info.Sheets),
+		"message":      fmt.Sprintf("Dataset restored to version %d.", req.Version),
+	})
+}
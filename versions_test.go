@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRollbackDataset(t *testing.T) {
+	const dataset = "rollback-test"
+	defer func(n int, quota int64) {
+		maxVersions, storeMaxBytes = n, quota
+		storeMutex.Lock()
+		removeDatasetLocked(dataset)
+		storeMutex.Unlock()
+	}(maxVersions, storeMaxBytes)
+	maxVersions = 1
+
+	tests := []struct {
+		name       string
+		first      func() // uploads version 1, before version 2 and the rollback to 1
+		quota      func() int64
+		wantStatus int
+	}{
+		{"the oldest kept version is restored with its lazy sheets", func() {
+			upload(t, withBrokenSheet(t), uploadOptions{Dataset: dataset, Filename: "book.xlsx", Lazy: true}, parseWorkbook)
+		}, func() int64 { return 0 }, http.StatusOK},
+		{"a version over the quota is refused", func() {
+			upload(t, []byte("id\n"+strings.Repeat("1234567890\n", 200)), uploadOptions{Dataset: dataset, Filename: "a.csv"}, parseDelimitedUpload)
+		}, func() int64 {
+			storeMutex.RLock()
+			defer storeMutex.RUnlock()
+			return storeBytesLocked() - datasets[dataset].Bytes // no room for version 1 beside version 2
+		}, http.StatusInsufficientStorage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeMutex.Lock()
+			removeDatasetLocked(dataset)
+			storeMutex.Unlock()
+			storeMaxBytes = 0
+			tt.first()
+			upload(t, []byte("id\n1\n"), uploadOptions{Dataset: dataset, Filename: "b.csv"}, parseDelimitedUpload)
+			storeMaxBytes = tt.quota()
+
+			w := serveJSON(datasetHandler, "POST", fmt.Sprintf("/api/dataset/%s/rollback", dataset), `{"version": 1}`)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("rollback: %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if data, _, err := getSheet(sheetKey(dataset, "Good")); err != nil || len(data.Headers) == 0 {
+				t.Fatalf("restored sheet %+v: %v", data, err)
+			}
+		})
+	}
+}
+
+// upload stores a file the way the upload endpoints do.
+func upload(t *testing.T, data []byte, opts uploadOptions, parse func([]byte, uploadOptions) (parsedUpload, error)) {
+	t.Helper()
+	if _, status, err := ingestUpload(data, opts, parse, http.StatusBadRequest); err != nil {
+		t.Fatalf("upload %s: %d %v", opts.Filename, status, err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// ---------------------------------------------------------------------
+// --- Store Write-Ahead Log ---
+// ---------------------------------------------------------------------
+
+// With -store-wal set, every write to the store is first appended to a log file and synced to
+// disk, then applied, and the log is emptied once everything in it has been applied. A write
+// that fails, say because the store was unreachable, is retried with each later write until
+// it succeeds or a later write for the same dataset replaces it. A write cut short by a crash,
+// or still failing at exit, is in the log at the next start and is applied again before the
+// store is read, so the store ends up with the dataset as it was last accepted rather than
+// half of it. Saves and removals replace whatever the store held for the dataset, so
+// replaying one twice is harmless. A record torn by a crash while it was being appended is
+// discarded, as the write it describes was never started.
+
+// walRecord is one logged store write: Op is "save" or "remove".
+type walRecord struct {
+	Op     string               `json:"op"`
+	ID     string               `json:"id"`
+	Info   datasetInfo          `json:"info"`
+	Sheets map[string]SheetData `json:"sheets,omitempty"`
+}
+
+// walStore is a sheetStore whose writes go through a write-ahead log.
+type walStore struct {
+	sheetStore
+	f       *os.File
+	pending map[string]walRecord // logged writes that failed, by dataset ID; the log is kept while any are left
+}
+
+// openWAL opens the log at path for the store, first applying any writes left in it.
+func openWAL(path string, inner sheetStore) (*walStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &walStore{sheetStore: inner, f: f, pending: make(map[string]walRecord)}
+	if err := w.replay(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("replaying %s: %v", path, err)
+	}
+	return w, nil
+}
+
+// replay applies the complete records of the log in order, then empties it.
+func (w *walStore) replay() error {
+	r := bufio.NewReader(w.f)
+	applied := 0
+	for {
+		rec, err := readWALRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("WARN: Discarding a torn record at the end of the write-ahead log: %v", err)
+			break
+		}
+		if err := w.perform(rec); err != nil {
+			return fmt.Errorf("dataset '%s': %v", rec.ID, err)
+		}
+		applied++
+	}
+	if applied > 0 {
+		log.Printf("INFO: Applied %d store write(s) left in the write-ahead log.", applied)
+	}
+	return w.reset()
+}
+
+// perform applies a record to the store.
+func (w *walStore) perform(rec walRecord) error {
+	switch rec.Op {
+	case "save":
+		return w.sheetStore.save(rec.ID, rec.Info, rec.Sheets)
+	case "remove":
+		return w.sheetStore.remove(rec.ID)
+	}
+	return fmt.Errorf("unknown operation '%s'", rec.Op)
+}
+
+// readWALRecord reads one record: its length and CRC-32 as big-endian uint32s, then its JSON.
+func readWALRecord(r io.Reader) (walRecord, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return walRecord{}, errors.New("truncated header")
+		}
+		return walRecord{}, err // io.EOF at a record boundary
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[:4]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return walRecord{}, errors.New("truncated record")
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return walRecord{}, errors.New("checksum mismatch")
+	}
+	var rec walRecord
+	err := json.Unmarshal(payload, &rec)
+	return rec, err
+}
+
+// append writes a record to the end of the log and syncs it to disk.
+func (w *walStore) append(rec walRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if uint64(len(payload)) > math.MaxUint32 {
+		return fmt.Errorf("record of %d bytes is too large to log", len(payload))
+	}
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	if _, err := w.f.Write(append(header[:], payload...)); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// reset empties the log.
+func (w *walStore) reset() error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// apply logs a write and performs it, then retries the writes that failed before and empties
+// the log once nothing in it is left unapplied.
+func (w *walStore) apply(rec walRecord) error {
+	if err := w.append(rec); err != nil {
+		return fmt.Errorf("writing the write-ahead log: %v", err)
+	}
+	if err := w.perform(rec); err != nil {
+		w.pending[rec.ID] = rec
+		return fmt.Errorf("%v (kept in the write-ahead log to retry)", err)
+	}
+	delete(w.pending, rec.ID) // the write supersedes any earlier one for the dataset
+	for id, old := range w.pending {
+		if err := w.perform(old); err != nil {
+			log.Printf("WARN: Store write for dataset '%s' still failing: %v", id, err)
+			continue
+		}
+		log.Printf("INFO: Applied the earlier store write for dataset '%s'.", id)
+		delete(w.pending, id)
+	}
+	if len(w.pending) > 0 {
+		return nil
+	}
+	return w.reset()
+}
+
+func (w *walStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	return w.apply(walRecord{Op: "save", ID: id, Info: info, Sheets: sheets})
+}
+
+func (w *walStore) remove(id string) error {
+	return w.apply(walRecord{Op: "remove", ID: id})
+}
+
+func (w *walStore) close() error {
+	w.f.Close()
+	return w.sheetStore.close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// flakyStore is a sheetStore that fails writes for the datasets in down.
+type flakyStore struct {
+	down  map[string]bool
+	saved map[string]bool
+}
+
+func (s *flakyStore) load() (map[string]datasetInfo, map[string]SheetData, error) {
+	return nil, nil, nil
+}
+
+func (s *flakyStore) save(id string, info datasetInfo, sheets map[string]SheetData) error {
+	if s.down[id] {
+		return errors.New("store unreachable")
+	}
+	s.saved[id] = true
+	return nil
+}
+
+func (s *flakyStore) remove(id string) error {
+	if s.down[id] {
+		return errors.New("store unreachable")
+	}
+	delete(s.saved, id)
+	return nil
+}
+
+func (s *flakyStore) close() error { return nil }
+
+func TestWALRetriesFailedWrites(t *testing.T) {
+	type step struct {
+		op      string // "save" or "remove"
+		id      string
+		down    []string // datasets whose writes fail from this step on
+		wantErr bool
+		pending int  // failed writes left
+		empty   bool // whether the log is empty afterwards
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"writes that succeed empty the log", []step{
+			{op: "save", id: "a", empty: true},
+			{op: "remove", id: "a", empty: true},
+		}},
+		{"a failed write is retried with the next", []step{
+			{op: "save", id: "a", down: []string{"a"}, wantErr: true, pending: 1},
+			{op: "save", id: "b", down: []string{"a"}, pending: 1},
+			{op: "save", id: "b", down: []string{}, pending: 0, empty: true},
+		}},
+		{"a later write for the dataset supersedes the failed one", []step{
+			{op: "save", id: "a", down: []string{"a"}, wantErr: true, pending: 1},
+			{op: "remove", id: "a", down: []string{}, pending: 0, empty: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyStore{down: map[string]bool{}, saved: map[string]bool{}}
+			w, err := openWAL(filepath.Join(t.TempDir(), "store.wal"), inner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.close()
+			for i, st := range tt.steps {
+				if st.down != nil {
+					inner.down = map[string]bool{}
+					for _, id := range st.down {
+						inner.down[id] = true
+					}
+				}
+				if st.op == "save" {
+					err = w.save(st.id, datasetInfo{}, nil)
+				} else {
+					err = w.remove(st.id)
+				}
+				if (err != nil) != st.wantErr {
+					t.Fatalf("step %d: err = %v, want error %t", i+1, err, st.wantErr)
+				}
+				if len(w.pending) != st.pending {
+					t.Errorf("step %d: %d pending writes, want %d", i+1, len(w.pending), st.pending)
+				}
+				fi, err := w.f.Stat()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (fi.Size() == 0) != st.empty {
+					t.Errorf("step %d: log is %d bytes, want empty %t", i+1, fi.Size(), st.empty)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ---------------------------------------------------------------------
+// --- Watched Directory Ingestion ---
+// ---------------------------------------------------------------------
+
+// With -watch-dir set, a background ingester polls a local directory or an SFTP path
+// (sftp://user@host[:port]/path) and loads every spreadsheet that appears there, so nightly
+// drops are matched without anyone uploading them. A file is loaded once it has been seen
+// unchanged on two polls in a row, so one still being written is not picked up half done.
+// Each file becomes the dataset named after it without its extension, replacing whatever
+// that dataset held; a file that changes is loaded again.
+
+// Watcher settings, set from flags in main.
+var (
+	watchDir        string // "" disables the watcher
+	watchInterval   = time.Minute
+	watchSFTPKey    string // private key file for SFTP; the password may instead be in the URL or WATCH_SFTP_PASSWORD
+	watchKnownHosts = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+)
+
+// watchedFile is a directory entry as seen on one poll.
+type watchedFile struct {
+	name    string
+	size    int64
+	modTime int64 // Unix nanoseconds, so entries compare with ==
+}
+
+// watchSource lists and reads the files of a watched directory.
+type watchSource interface {
+	list() ([]watchedFile, error)
+	read(name string) ([]byte, error)
+	close()
+}
+
+// newWatchSource opens the directory a -watch-dir value names.
+func newWatchSource(spec string) (watchSource, error) {
+	if strings.HasPrefix(spec, "sftp://") {
+		return dialSFTPSource(spec)
+	}
+	st, err := os.Stat(spec)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", spec)
+	}
+	return localWatchSource(spec), nil
+}
+
+// redactWatchDir hides the password of an SFTP -watch-dir for logging.
+func redactWatchDir(spec string) string {
+	if u, err := url.Parse(spec); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return spec
+}
+
+// watchable reports whether a directory entry looks like a finished spreadsheet: a known
+// extension, and not hidden or a partial transfer.
+func watchable(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return false
+	}
+	_, known := formatExtensions[strings.ToLower(path.Ext(name))]
+	return known
+}
+
+// readWatched reads a watched file under the same size cap as remote fetches.
+func readWatched(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, remoteMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > remoteMaxBytes {
+		return nil, fmt.Errorf("file exceeds %d bytes", remoteMaxBytes)
+	}
+	return data, nil
+}
+
+// localWatchSource is a watched directory on the local file system.
+type localWatchSource string
+
+func (dir localWatchSource) list() ([]watchedFile, error) {
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		return nil, err
+	}
+	var files []watchedFile
+	for _, e := range entries {
+		if e.IsDir() || !watchable(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since the listing
+		}
+		files = append(files, watchedFile{name: e.Name(), size: info.Size(), modTime: info.ModTime().UnixNano()})
+	}
+	return files, nil
+}
+
+func (dir localWatchSource) read(name string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(string(dir), name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readWatched(f)
+}
+
+func (dir localWatchSource) close() {}
+
+// sftpWatchSource is a watched directory on an SFTP server.
+type sftpWatchSource struct {
+	dir    string
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// dialSFTPSource connects to the server of an sftp:// URL, checking its host key against
+// watchKnownHosts.
+func dialSFTPSource(spec string) (*sftpWatchSource, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" || u.User == nil {
+		return nil, fmt.Errorf("invalid SFTP URL '%s': expected sftp://user@host[:port]/path", redactWatchDir(spec))
+	}
+	hostKeys, err := knownhosts.New(watchKnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %v", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if watchSFTPKey != "" {
+		key, err := os.ReadFile(watchSFTPKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SFTP key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		password = os.Getenv("WATCH_SFTP_PASSWORD")
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            u.User.Username(),
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         remoteTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %v", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("starting SFTP session: %v", err)
+	}
+	dir := u.Path
+	if dir == "" {
+		dir = "."
+	}
+	return &sftpWatchSource{dir: dir, conn: conn, client: client}, nil
+}
+
+func (s *sftpWatchSource) list() ([]watchedFile, error) {
+	entries, err := s.client.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []watchedFile
+	for _, e := range entries {
+		if e.IsDir() || !watchable(e.Name()) {
+			continue
+		}
+		files = append(files, watchedFile{name: e.Name(), size: e.Size(), modTime: e.ModTime().UnixNano()})
+	}
+	return files, nil
+}
+
+func (s *sftpWatchSource) read(name string) ([]byte, error) {
+	f, err := s.client.Open(path.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readWatched(f)
+}
+
+func (s *sftpWatchSource) close() {
+	s.client.Close()
+	s.conn.Close()
+}
+
+// runWatcher polls the watched directory until the process exits. An SFTP connection that
+// fails is dropped and dialled again on the next poll.
+func runWatcher(spec string, src watchSource) {
+	label := redactWatchDir(spec)
+	seen := make(map[string]watchedFile)   // as of the previous poll, not yet loaded
+	loaded := make(map[string]watchedFile) // as loaded (or failed to load)
+	for ; ; time.Sleep(watchInterval) {
+		if src == nil {
+			var err error
+			if src, err = newWatchSource(spec); err != nil {
+				log.Printf("ERROR: Watcher cannot open %s: %v", label, err)
+				continue
+			}
+		}
+		files, err := src.list()
+		if err != nil {
+			log.Printf("ERROR: Watcher cannot list %s: %v", label, err)
+			src.close()
+			src = nil
+			continue
+		}
+
+		present := make(map[string]bool, len(files))
+		for _, f := range files {
+			present[f.name] = true
+			switch {
+			case loaded[f.name] == f:
+			case seen[f.name] == f:
+				ingestWatched(src, f)
+				loaded[f.name] = f
+				delete(seen, f.name)
+			default:
+				seen[f.name] = f
+			}
+		}
+		for name := range loaded {
+			if !present[name] {
+				delete(loaded, name)
+			}
+		}
+		for name := range seen {
+			if !present[name] {
+				delete(seen, name)
+			}
+		}
+	}
+}
+
+// ingestWatched loads one watched file as the dataset named after it.
+func ingestWatched(src watchSource, f watchedFile) {
+	data, err := src.read(f.name)
+	if err != nil {
+		log.Printf("ERROR: Watcher cannot read '%s': %v", f.name, err)
+		return
+	}
+	ingestFile("Watcher", f.name, data)
+}
+
+// ingestFile loads a file picked up by a background ingester as the dataset named after it
+// without its extension, logging the outcome under origin.
+func ingestFile(origin, name string, data []byte) {
+	opts := uploadOptions{
+		Dataset:    strings.TrimSuffix(name, path.Ext(name)),
+		Idempotent: true,
+		Filename:   name,
+	}
+	result, _, err := ingestUpload(data, opts, parseUpload, 0)
+	if err != nil {
+		log.Printf("ERROR: %s failed to load '%s': %v", origin, name, err)
+		return
+	}
+	log.Printf("INFO: %s loaded '%s' as dataset '%s' (%d sheets): %s", origin, name, result.Dataset, len(result.SheetNames), strings.Join(result.SheetNames, ", "))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ---------------------------------------------------------------------
+// --- Weighted Scoring ---
+// ---------------------------------------------------------------------
+
+// With MatchRequest.Scoring "weighted", the KeyColumns pairs are scored one by one instead of
+// as one joined key, each with its own algorithm (the request's when unset), and a row pair's
+// score is the weighted mean of its field similarities. A field blank on either side is left
+// out of the mean rather than counted as a mismatch, and a field its algorithm cannot compare
+// (a value that is not a date, say) scores 0. Field similarities are taken in full, without
+// FuzzyThreshold; the pair matches when the combined score reaches MinSimilarity or, when that
+// is 0, when (1-score)*100 <= FuzzyThreshold. Every row pair is scored, so the work grows with
+// the product of the sheets' row counts. Matches form a single group, as for composite keys,
+// and the distance reported is the number of fields that did not agree exactly.
+
+// Values for MatchRequest.Scoring.
+const scoringWeighted = "weighted"
+
+// weightedField is one resolved field of a weighted comparison.
+type weightedField struct {
+	col1, col2 int
+	weight     float64
+	exact      bool      // "exact" algorithm: similarity 1 for equal keys, 0 otherwise
+	score      scoreFunc // for every other algorithm
+}
+
+// validateScoring rejects an unknown scoring mode and, for weighted scoring, bad fields.
+func validateScoring(req MatchRequest) error {
+	switch req.Scoring {
+	case "":
+		return nil
+	case scoringWeighted:
+	default:
+		return fmt.Errorf("unknown scoring '%s' (expected weighted)", req.Scoring)
+	}
+	if len(req.KeyColumns) == 0 {
+		return fmt.Errorf("weighted scoring needs keyColumns")
+	}
+	if req.DistinctOnly {
+		return fmt.Errorf("distinctOnly cannot be combined with weighted scoring")
+	}
+	total := 0.0
+	for i, kc := range req.KeyColumns {
+		if kc.Weight < 0 {
+			return fmt.Errorf("keyColumns entry %d has a negative weight", i+1)
+		}
+		if _, err := resolveAlgorithm(MatchRequest{Algorithm: kc.Algorithm}); err != nil {
+			return fmt.Errorf("keyColumns entry %d: %v", i+1, err)
+		}
+		total += fieldWeight(kc)
+	}
+	if total == 0 {
+		return fmt.Errorf("keyColumns weights must not all be 0")
+	}
+	return nil
+}
+
+// fieldWeight is a key column's weight, 1 when unset.
+func fieldWeight(kc KeyColumn) float64 {
+	if kc.Weight == 0 {
+		return 1
+	}
+	return kc.Weight
+}
+
+// weightedMatches scores every row pair of the sheets on the request's weighted fields. The
+// request's algorithm has been resolved by findMatches.
+func weightedMatches(ctx context.Context, req MatchRequest, side1, side2 matchSide, sheet1Data, sheet2Data SheetData) ([]MatchGroup, int, error) {
+	index := newMatchIndex(side2.Keys)
+	for _, row := range sheet2Data.Rows {
+		index.add(row)
+	}
+
+	// Field similarities are taken in full, so the algorithms score with the widest threshold.
+	params := newScoreParams(req)
+	params.threshold = 100
+	fields := make([]weightedField, len(req.KeyColumns))
+	cols1, cols2 := make([]int, len(fields)), make([]int, len(fields))
+	for i, kc := range req.KeyColumns {
+		f := &fields[i]
+		if f.col1 = findColumn(side1.Headers, kc.Column1); f.col1 < 0 {
+			return nil, 0, fmt.Errorf("key column '%s' not found in sheet '%s'", kc.Column1, req.Sheet1)
+		}
+		if f.col2 = findColumn(side2.Headers, kc.Column2); f.col2 < 0 {
+			return nil, 0, fmt.Errorf("key column '%s' not found in sheet '%s'", kc.Column2, req.Sheet2)
+		}
+		cols1[i], cols2[i] = f.col1, f.col2
+		f.weight = fieldWeight(kc)
+		algorithm := req.Algorithm
+		if kc.Algorithm != "" {
+			algorithm, _ = resolveAlgorithm(MatchRequest{Algorithm: kc.Algorithm})
+		}
+		if alg := fuzzyAlgorithms[algorithm]; alg != nil {
+			f.score = alg.columnScorer(index, f.col2, params)
+		} else {
+			f.exact = true
+		}
+	}
+
+	var matches []MatchResult
+	keys1 := make([]string, len(fields))
+	for r1, row1 := range sheet1Data.Rows {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		for i, f := range fields {
+			keys1[i] = side1.Keys[f.col1](cellValue(row1, f.col1))
+		}
+		for r2, row2 := range index.rows {
+			total, weights, differing := 0.0, 0.0, 0
+			for i, f := range fields {
+				key2 := ""
+				if f.col2 < len(index.keys[r2]) {
+					key2 = index.keys[r2][f.col2]
+				}
+				if keys1[i] == "" || key2 == "" {
+					continue
+				}
+				ratio := 0.0
+				if keys1[i] == key2 {
+					ratio = 1
+				} else if !f.exact {
+					if _, r, ok := f.score(keys1[i], key2, params); ok {
+						ratio = r
+					}
+				}
+				if ratio < 1 {
+					differing++
+				}
+				total += f.weight * ratio
+				weights += f.weight
+			}
+			if weights == 0 {
+				continue
+			}
+			score := total / weights
+			if req.MinSimilarity > 0 && score < req.MinSimilarity || req.MinSimilarity == 0 && (1-score)*100 > float64(req.FuzzyThreshold) {
+				continue
+			}
+			m := MatchResult{
+				OriginalRow1: side1.FirstRow + r1,
+				OriginalRow2: side2.FirstRow + r2,
+				Val1:         joinFields(row1, cols1),
+				Val2:         joinFields(row2, cols2),
+				IsFuzzy:      score < 1,
+				ID1:          cellValue(row1, side1.IDCol),
+				ID2:          cellValue(row2, side2.IDCol),
+				Similarity:   formatSimilarity(req.SimilarityFormat, differing, score),
+				score:        score,
+			}
+			if m.IsFuzzy {
+				m.Algorithm = scoringWeighted
+			}
+			matches = append(matches, m)
+		}
+	}
+
+	if len(matches) == 0 {
+		return []MatchGroup{}, 1, nil
+	}
+	return []MatchGroup{{
+		Tab1: req.Sheet1, Tab2: req.Sheet2,
+		Header1: compositeHeader(side1.Headers, cols1), Header2: compositeHeader(side2.Headers, cols2),
+		Matches: matches,
+		col1:    cols1[0], col2: cols2[0],
+	}}, 1, nil
+}
+
+// joinFields shows the values of a row's weighted fields, separated as composite values are.
+func joinFields(row []string, cols []int) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = cellValue(row, c)
+	}
+	return strings.Join(parts, compositeDisplaySeparator)
+}
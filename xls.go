@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/extrame/xls"
+)
+
+// ---------------------------------------------------------------------
+// --- Legacy .xls Workbooks ---
+// ---------------------------------------------------------------------
+
+// parseXLSWorkbook reads every sheet of a legacy BIFF (.xls) workbook. The reader knows
+// neither fill colors nor lazy loading, so CaptureStyles and Lazy do not apply; sheets are
+// otherwise shaped like parseSheet's, with trailing blank cells dropped.
+func parseXLSWorkbook(data []byte, opts uploadOptions) (up parsedUpload, err error) {
+	// The BIFF reader panics on some malformed files instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed xls workbook: %v", r)
+		}
+	}()
+
+	wb, err := xls.OpenReader(bytes.NewReader(data), "utf-8")
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	if wb == nil {
+		return parsedUpload{}, fmt.Errorf("no workbook stream found")
+	}
+	if opts.CaptureStyles || opts.Lazy {
+		log.Printf("WARN: captureStyles and lazy are not supported for .xls workbooks; ignoring.")
+	}
+
+	up = parsedUpload{
+		sheets:      make(map[string]SheetData, wb.NumSheets()),
+		names:       make([]string, 0, wb.NumSheets()),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	for i := 0; i < wb.NumSheets(); i++ {
+		sheet := wb.GetSheet(i)
+		if !opts.selectsSheet(sheet.Name) {
+			continue
+		}
+		rows, err := xlsSheetRows(sheet, opts.layout())
+		if err != nil {
+			return parsedUpload{}, err
+		}
+		up.addRows(sheet.Name, rows, opts)
+	}
+	return up, nil
+}
+
+// xlsSheetRows returns a sheet's cells as strings, one slice per row from the first row on,
+// refusing a sheet over the upload caps.
+func xlsSheetRows(sheet *xls.WorkSheet, layout sheetLayout) ([][]string, error) {
+	rows := make([][]string, 0, int(sheet.MaxRow)+1)
+	for i := 0; i <= int(sheet.MaxRow); i++ {
+		row := sheet.Row(i)
+		if row == nil {
+			rows = append(rows, []string{})
+			continue
+		}
+		cells := make([]string, 0, row.LastCol()+1)
+		for c := 0; c <= row.LastCol(); c++ {
+			if c < row.FirstCol() {
+				cells = append(cells, "")
+				continue
+			}
+			cells = append(cells, row.Col(c))
+		}
+		end := len(cells)
+		for end > 0 && cells[end-1] == "" {
+			end--
+		}
+		rows = append(rows, cells[:end])
+		if err := checkRowLimits(sheet.Name, layout, len(rows), cells[:end]); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
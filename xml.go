@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// ---------------------------------------------------------------------
+// --- XML Uploads ---
+// ---------------------------------------------------------------------
+
+// An XML upload is a feed of repeated record elements read as one sheet named after the file,
+// a row per record. uploadOptions.XMLRecord names the record element, optionally as a path
+// ("Feed/Invoice"); by default the children of the root element are the records.
+// uploadOptions.XMLFields maps columns to paths within a record, as "name=path" or bare paths
+// separated by commas: "id=@id,customer=Customer/Name,Total". A path's last step may be an
+// attribute ("Customer/@ref"). Without XMLFields, every attribute of a record and every
+// element within it holding text becomes a column, headed by its path, in order of first
+// appearance; "." is the text of the record element itself. A path matching several elements
+// of a record joins their text with ", ".
+// Namespace prefixes are ignored throughout.
+
+// xmlField is a column of an XML upload and the record path it reads.
+type xmlField struct {
+	name, path string
+}
+
+// parseXMLFields parses an XMLFields spec; "" yields no fields.
+func parseXMLFields(s string) ([]xmlField, error) {
+	var fields []xmlField
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	for i, item := range strings.Split(s, ",") {
+		name, p, named := strings.Cut(item, "=")
+		if !named {
+			p = name
+		}
+		name, p = strings.TrimSpace(name), strings.Trim(strings.TrimSpace(p), "/")
+		steps := strings.Split(p, "/")
+		for j, step := range steps {
+			if step == "" || (strings.HasPrefix(step, "@") && (j < len(steps)-1 || step == "@")) {
+				return nil, fmt.Errorf("invalid xmlFields column %d '%s': expected name=path, e.g. customer=Customer/Name or id=@id", i+1, strings.TrimSpace(item))
+			}
+		}
+		fields = append(fields, xmlField{name: name, path: p})
+	}
+	return fields, nil
+}
+
+// xmlRecordMatcher reports whether the element stack, root first, ends at a record.
+func xmlRecordMatcher(record string) func(stack []string) bool {
+	if record = strings.Trim(record, "/"); record == "" {
+		return func(stack []string) bool { return len(stack) == 2 }
+	}
+	steps := strings.Split(record, "/")
+	return func(stack []string) bool {
+		if len(stack) < len(steps) {
+			return false
+		}
+		tail := stack[len(stack)-len(steps):]
+		for i, step := range steps {
+			if tail[i] != step {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// xmlRecord collects the values of one record by path, in order of first appearance.
+type xmlRecord struct {
+	paths  []string
+	values map[string]string
+}
+
+func (rec *xmlRecord) add(path, value string) {
+	old, seen := rec.values[path]
+	switch {
+	case !seen:
+		rec.paths = append(rec.paths, path)
+		rec.values[path] = value
+	case value == "":
+	case old == "":
+		rec.values[path] = value
+	default:
+		rec.values[path] = old + ", " + value
+	}
+}
+
+// parseXMLUpload reads the records of an XML feed as a single sheet. Header row options do not
+// apply, since the mapping is the header.
+func parseXMLUpload(data []byte, opts uploadOptions) (parsedUpload, error) {
+	fields, err := parseXMLFields(opts.XMLFields)
+	if err != nil {
+		return parsedUpload{}, err
+	}
+	isRecord := xmlRecordMatcher(opts.XMLRecord)
+	name := strings.TrimSuffix(filepath.Base(opts.Filename), filepath.Ext(opts.Filename))
+	if name == "" || name == "." {
+		name = "Sheet1"
+	}
+
+	var headers []string
+	columns := make(map[string]int)
+	for _, f := range fields {
+		name := f.name
+		if name == "" {
+			name = f.path
+		}
+		columns[f.path] = len(headers)
+		headers = append(headers, name)
+	}
+	rows := [][]string{nil}
+	emit := func(rec *xmlRecord) error {
+		row := make([]string, len(headers))
+		for _, p := range rec.paths {
+			c, ok := columns[p]
+			if !ok {
+				if fields != nil {
+					continue
+				}
+				c = len(headers)
+				columns[p] = c
+				headers = append(headers, p)
+				row = append(row, "")
+			}
+			row[c] = rec.values[p]
+		}
+		rows = append(rows, row)
+		return checkRowLimits(name, sheetLayout{}, len(rows), row)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = charset.NewReaderLabel
+	var (
+		stack []string   // element names from the root
+		depth int        // stack length at the record element, 0 outside records
+		rec   *xmlRecord // the record being read
+		text  [][]byte   // text of the open elements within the record
+		leaf  []bool     // whether each open element within the record has no children
+	)
+	relPath := func() string { return strings.Join(stack[depth:], "/") }
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return parsedUpload{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if rec == nil {
+				if !isRecord(stack) {
+					continue
+				}
+				depth = len(stack)
+				rec = &xmlRecord{values: make(map[string]string)}
+				text, leaf = text[:0], leaf[:0]
+			} else if len(leaf) > 0 {
+				leaf[len(leaf)-1] = false
+			}
+			prefix := relPath()
+			if prefix != "" {
+				prefix += "/"
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+					rec.add(prefix+"@"+a.Name.Local, strings.TrimSpace(a.Value))
+				}
+			}
+			text = append(text, nil)
+			leaf = append(leaf, true)
+		case xml.CharData:
+			if rec != nil {
+				text[len(text)-1] = append(text[len(text)-1], t...)
+			}
+		case xml.EndElement:
+			if rec != nil {
+				n := len(text) - 1
+				value := strings.TrimSpace(string(text[n]))
+				if p := relPath(); p != "" && (value != "" || leaf[n]) {
+					rec.add(p, value)
+				} else if p == "" && value != "" {
+					rec.add(".", value)
+				}
+				text, leaf = text[:n], leaf[:n]
+				if len(stack) == depth {
+					if err := emit(rec); err != nil {
+						return parsedUpload{}, err
+					}
+					rec, depth = nil, 0
+				}
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if len(rows) == 1 {
+		return parsedUpload{}, fmt.Errorf("no record elements found")
+	}
+	rows[0] = headers
+
+	up := parsedUpload{
+		sheets:      make(map[string]SheetData, 1),
+		sheetErrors: make([]SheetError, 0),
+		dropped:     make([]string, 0),
+	}
+	opts.HeaderRow, opts.HeaderRows = 0, 0
+	up.addRows(name, rows, opts)
+	return up, nil
+}
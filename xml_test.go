@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseXMLUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		xml     string
+		opts    uploadOptions
+		headers []string
+		rows    [][]string
+	}{
+		{
+			name: "indented nested records",
+			xml: `<?xml version="1.0"?>
+<Feed>
+    <Invoice id="1">
+        <Customer ref="c1">
+            <Name>Ada</Name>
+            <City>London</City>
+        </Customer>
+        <Total>10.50</Total>
+    </Invoice>
+    <Invoice id="2">
+        <Customer ref="c2">
+            <Name>Grace</Name>
+        </Customer>
+        <Total>7</Total>
+    </Invoice>
+</Feed>`,
+			headers: []string{"@id", "Customer/@ref", "Customer/Name", "Customer/City", "Total"},
+			rows:    [][]string{{"1", "c1", "Ada", "London", "10.50"}, {"2", "c2", "Grace", "", "7"}},
+		},
+		{
+			name: "mapped fields and repeated elements",
+			xml: `<Feed>
+  <Order>
+    <Line>a</Line>
+    <Line>b</Line>
+    <Ref>r1</Ref>
+  </Order>
+</Feed>`,
+			opts:    uploadOptions{XMLFields: "ref=Ref,Line"},
+			headers: []string{"ref", "Line"},
+			rows:    [][]string{{"r1", "a, b"}},
+		},
+		{
+			name: "record path",
+			xml: `<Root>
+  <Meta><Generated>today</Generated></Meta>
+  <Items>
+    <Item>x</Item>
+    <Item>y</Item>
+  </Items>
+</Root>`,
+			opts:    uploadOptions{XMLRecord: "Items/Item"},
+			headers: []string{"."},
+			rows:    [][]string{{"x"}, {"y"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Filename = "feed.xml"
+			up, err := parseXMLUpload([]byte(tt.xml), tt.opts)
+			if err != nil {
+				t.Fatalf("parseXMLUpload: %v", err)
+			}
+			sheet, ok := up.sheets["feed"]
+			if !ok {
+				t.Fatalf("sheet 'feed' missing; got %v", up.names)
+			}
+			if !reflect.DeepEqual(sheet.Headers, tt.headers) {
+				t.Errorf("headers = %q, want %q", sheet.Headers, tt.headers)
+			}
+			if !reflect.DeepEqual(sheet.Rows, tt.rows) {
+				t.Errorf("rows = %q, want %q", sheet.Rows, tt.rows)
+			}
+		})
+	}
+}